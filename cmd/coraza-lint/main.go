@@ -0,0 +1,55 @@
+// Copyright 2023 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !tinygo
+// +build !tinygo
+
+// coraza-lint reports the issues of SecLang configurations without running them: the
+// directives failing to compile, duplicate rule IDs, chains missing their terminating rule,
+// skipAfter actions without a marker after the rule, variables populated after the phase
+// of their rule and the deprecated or unsupported directives.
+//
+// Usage:
+//
+//	coraza-lint [-strict] FILE...
+//
+// The files may be glob patterns, like the Include directive. It exits with status 1 if
+// there is any error, or any warning with -strict.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/corazawaf/coraza/v3/internal/seclang"
+)
+
+func main() {
+	strict := flag.Bool("strict", false, "Exit with status 1 on warnings too. Default: false")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [-strict] FILE...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	a := seclang.NewAnalyzer()
+	for _, path := range flag.Args() {
+		a.FromFile(path)
+	}
+
+	failed := false
+	for _, f := range a.Findings() {
+		fmt.Println(f)
+		if f.Severity == seclang.SeverityError || *strict {
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
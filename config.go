@@ -64,6 +64,23 @@ type WAFConfig interface {
 
 	// WithRootFS configures the root file system.
 	WithRootFS(fs fs.FS) WAFConfig
+
+	// WithProcessEnv makes the setenv action also set the variables in the process
+	// environment, as done by ModSecurity. The process environment is shared by the
+	// concurrent transactions, by default variables are only set in the transaction
+	// ENV collection.
+	WithProcessEnv() WAFConfig
+
+	// WithParseErrorCollection makes NewWAF report all the directives failing to compile
+	// instead of stopping at the first one. The errors are joined in the error returned by
+	// NewWAF, see ParseErrors. They are not kept in the WAFConfig, which is immutable and
+	// may be shared by several NewWAF calls, each of them reporting its own errors.
+	WithParseErrorCollection() WAFConfig
+
+	// WithDefines sets variables expanded as ${NAME} in the directives, like the Define
+	// directive does. They are set before the directives are parsed, whatever the order of
+	// the options.
+	WithDefines(defines map[string]string) WAFConfig
 }
 
 // NewWAFConfig creates a new WAFConfig with the default settings.
@@ -107,6 +124,9 @@ type wafConfig struct {
 	errorCallback             func(rule types.MatchedRule)
 	fsRoot                    fs.FS
 	persistenceEngineProvider ptypes.PersistenceEngineProvider
+	processEnv                bool
+	collectParseErrors        bool
+	defines                   map[string]string
 }
 
 func (c *wafConfig) WithRules(rules ...*corazawaf.Rule) WAFConfig {
@@ -163,6 +183,30 @@ func (c *wafConfig) WithRootFS(fs fs.FS) WAFConfig {
 	return ret
 }
 
+func (c *wafConfig) WithProcessEnv() WAFConfig {
+	ret := c.clone()
+	ret.processEnv = true
+	return ret
+}
+
+func (c *wafConfig) WithParseErrorCollection() WAFConfig {
+	ret := c.clone()
+	ret.collectParseErrors = true
+	return ret
+}
+
+func (c *wafConfig) WithDefines(defines map[string]string) WAFConfig {
+	ret := c.clone()
+	ret.defines = make(map[string]string, len(c.defines)+len(defines))
+	for k, v := range c.defines {
+		ret.defines[k] = v
+	}
+	for k, v := range defines {
+		ret.defines[k] = v
+	}
+	return ret
+}
+
 func (c *wafConfig) clone() *wafConfig {
 	ret := *c // copy
 	rules := make([]wafRule, len(c.rules))
@@ -17,3 +17,22 @@ type ActionFactory = func() plugintypes.Action
 func RegisterAction(name string, a ActionFactory) {
 	actions.Register(name, a)
 }
+
+// RegisterExecCallback registers a function run synchronously by the exec action
+// of the rules referring to it by name, e.g. `exec:openTicket`. The function can
+// modify the transaction, e.g. setting TX variables.
+// If you register a callback with an existing name, it will be overwritten.
+func RegisterExecCallback(name string, fn plugintypes.ExecCallback) {
+	actions.RegisterExecCallback(name, fn)
+}
+
+// RegisterAsyncExecCallback registers a function run in background by the exec action,
+// so that slow callbacks like alerting do not delay the processing of the transaction.
+// The function receives a snapshot of the transaction taken when the rule matched. At
+// most 16 callbacks run at the same time, the following ones are dropped until a
+// callback returns. The dropped callbacks and the panics of the callbacks are logged as
+// errors by the logger of the WAF.
+// If you register a callback with an existing name, it will be overwritten.
+func RegisterAsyncExecCallback(name string, fn plugintypes.AsyncExecCallback) {
+	actions.RegisterAsyncExecCallback(name, fn)
+}
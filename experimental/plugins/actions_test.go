@@ -4,8 +4,11 @@
 package plugins_test
 
 import (
+	"strconv"
+	"sync"
 	"testing"
 
+	"github.com/corazawaf/coraza/v3"
 	"github.com/corazawaf/coraza/v3/experimental/plugins"
 	"github.com/corazawaf/coraza/v3/experimental/plugins/plugintypes"
 	"github.com/corazawaf/coraza/v3/internal/actions"
@@ -24,3 +27,71 @@ func TestAction(t *testing.T) {
 		}
 	})
 }
+
+func TestExecCallback(t *testing.T) {
+	plugins.RegisterExecCallback("open_ticket", func(tx plugintypes.TransactionState, r plugintypes.RuleMetadata) {
+		tx.Variables().TX().Set("ticket", []string{strconv.Itoa(r.ID())})
+	})
+
+	waf, err := coraza.NewWAF(coraza.NewWAFConfig().
+		WithDirectives(`SecRule REQUEST_URI "@beginsWith /admin" "id:10,phase:1,pass,nolog,exec:open_ticket"`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx := waf.NewTransaction()
+	defer tx.Close()
+	tx.ProcessURI("/admin", "GET", "HTTP/1.1")
+	tx.ProcessRequestHeaders()
+
+	if want, have := []string{"10"}, tx.(plugintypes.TransactionState).Variables().TX().Get("ticket"); len(have) != 1 || want[0] != have[0] {
+		t.Errorf("unexpected ticket, want %v, have %v", want, have)
+	}
+}
+
+// TestAsyncExecCallback runs the callbacks concurrently with the following phases of the
+// transaction, it's meant to be run with -race
+func TestAsyncExecCallback(t *testing.T) {
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var matched []string
+	plugins.RegisterAsyncExecCallback("alert", func(e plugintypes.ExecEvent) {
+		defer wg.Done()
+		mu.Lock()
+		defer mu.Unlock()
+		for _, m := range e.MatchedVars {
+			matched = append(matched, strconv.Itoa(e.Rule.ID())+":"+m.Key()+"="+m.Value())
+		}
+	})
+
+	waf, err := coraza.NewWAF(coraza.NewWAFConfig().WithDirectives(`
+SecRule ARGS:id "@rx ^[0-9]+$" "id:10,phase:1,pass,nolog,exec:alert"
+SecRule ARGS:id "@rx ^[0-9]+$" "id:20,phase:2,pass,nolog,setvar:tx.id=%{MATCHED_VAR}"
+SecRule RESPONSE_HEADERS:content-type "@rx html" "id:30,phase:3,pass,nolog,setvar:tx.html=1"
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const transactions = 10
+	wg.Add(transactions)
+	for i := 0; i < transactions; i++ {
+		tx := waf.NewTransaction()
+		tx.ProcessURI("/?id="+strconv.Itoa(i), "GET", "HTTP/1.1")
+		tx.ProcessRequestHeaders()
+		if _, err := tx.ProcessRequestBody(); err != nil {
+			t.Fatal(err)
+		}
+		tx.AddResponseHeader("Content-Type", "text/html")
+		tx.ProcessResponseHeaders(200, "HTTP/1.1")
+		tx.ProcessLogging()
+		if err := tx.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wg.Wait()
+
+	if len(matched) != transactions {
+		t.Errorf("unexpected matches %v", matched)
+	}
+}
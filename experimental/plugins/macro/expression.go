@@ -0,0 +1,391 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package macro
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/corazawaf/coraza/v3/collection"
+	"github.com/corazawaf/coraza/v3/experimental/plugins/plugintypes"
+	"github.com/corazawaf/coraza/v3/internal/memoize"
+	"github.com/corazawaf/coraza/v3/types"
+	"github.com/corazawaf/coraza/v3/types/variables"
+)
+
+// valueSeparator joins the values of expressions selecting several values,
+// e.g. %{ARGS:/^id_/}, unless join() is used to pick another separator.
+const valueSeparator = ","
+
+// expression is a macro expression richer than the lookup of a single key,
+// e.g. %{&ARGS}, %{ARGS:/^id_/} or %{sha256(REQUEST_HEADERS.host)}
+type expression interface {
+	values(tx plugintypes.TransactionState) []string
+}
+
+// literalExpr is a quoted string, e.g. '|' in %{join(ARGS, '|')}
+type literalExpr struct {
+	value string
+}
+
+func (e *literalExpr) values(plugintypes.TransactionState) []string {
+	return []string{e.value}
+}
+
+// referenceExpr selects values from a collection: the first value of a key,
+// all the values of the keys matching a regex or of the whole collection, or
+// their count when prefixed with &.
+type referenceExpr struct {
+	variable variables.RuleVariable
+	key      string
+	keyRx    *regexp.Regexp
+	count    bool
+}
+
+// isPlain reports whether the reference can be expanded as a simple token
+func (e *referenceExpr) isPlain() bool {
+	return !e.count && e.keyRx == nil
+}
+
+func (e *referenceExpr) values(tx plugintypes.TransactionState) []string {
+	var values []string
+	switch col := tx.Collection(e.variable).(type) {
+	case collection.Keyed:
+		switch {
+		case e.keyRx != nil:
+			values = matchValues(col.FindRegex(e.keyRx))
+		case e.key != "":
+			values = col.Get(e.key)
+			if !e.count && len(values) > 1 {
+				values = values[:1]
+			}
+		default:
+			values = matchValues(col.FindAll())
+		}
+	case collection.Single:
+		if v := col.Get(); v != "" {
+			values = []string{v}
+		}
+	case nil:
+	default:
+		// e.g. ARGS_NAMES, whose keys are filtered here
+		var mds []types.MatchData
+		for _, md := range col.FindAll() {
+			switch {
+			case e.keyRx != nil && !e.keyRx.MatchString(strings.ToLower(md.Key())):
+			case e.keyRx == nil && e.key != "" && !strings.EqualFold(md.Key(), e.key):
+			default:
+				mds = append(mds, md)
+			}
+		}
+		values = matchValues(mds)
+	}
+
+	if e.count {
+		return []string{strconv.Itoa(len(values))}
+	}
+	return values
+}
+
+// matchValues returns the values sorted by key, so that expansions don't depend
+// on the iteration order of the collection
+func matchValues(mds []types.MatchData) []string {
+	sort.SliceStable(mds, func(i, j int) bool { return mds[i].Key() < mds[j].Key() })
+	values := make([]string, 0, len(mds))
+	for _, md := range mds {
+		values = append(values, md.Value())
+	}
+	return values
+}
+
+// functionExpr applies a function to every value of its argument
+type functionExpr struct {
+	fn  func(string) string
+	arg expression
+}
+
+func (e *functionExpr) values(tx plugintypes.TransactionState) []string {
+	values := e.arg.values(tx)
+	res := make([]string, len(values))
+	for i, v := range values {
+		res[i] = e.fn(v)
+	}
+	return res
+}
+
+// joinExpr joins the values of its argument with a custom separator
+type joinExpr struct {
+	arg       expression
+	separator string
+}
+
+func (e *joinExpr) values(tx plugintypes.TransactionState) []string {
+	return []string{strings.Join(e.arg.values(tx), e.separator)}
+}
+
+// macroFunctions are the functions available in macros, indexed by their
+// lowercase name. join(expression, 'separator') is handled by the parser.
+var macroFunctions = map[string]func(string) string{
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+	"trim":  strings.TrimSpace,
+	"length": func(s string) string {
+		return strconv.Itoa(len(s))
+	},
+	"md5": func(s string) string {
+		sum := md5.Sum([]byte(s))
+		return hex.EncodeToString(sum[:])
+	},
+	"sha1": func(s string) string {
+		sum := sha1.Sum([]byte(s))
+		return hex.EncodeToString(sum[:])
+	},
+	"sha256": func(s string) string {
+		sum := sha256.Sum256([]byte(s))
+		return hex.EncodeToString(sum[:])
+	},
+	"hex": func(s string) string {
+		return hex.EncodeToString([]byte(s))
+	},
+	"base64": func(s string) string {
+		return base64.StdEncoding.EncodeToString([]byte(s))
+	},
+	"urlencode": url.QueryEscape,
+}
+
+// exprParser parses the expression enclosed in %{ and } following the grammar:
+//
+//	expression := function "(" expression ")"
+//	            | "join" "(" expression "," literal ")"
+//	            | literal
+//	            | ["&"] variable [("." | ":") key]
+//	key        := name | "/" regex "/"
+//	literal    := "'" text "'"
+type exprParser struct {
+	input string
+	// pos is the position of the next byte to parse
+	pos int
+	// start is the position right after %{, used for error messages
+	start int
+}
+
+// parseMacro parses the expression and the closing brace. Plain references
+// like %{tx.score} are returned as variable tokens, expanded faster.
+func (p *exprParser) parseMacro() (macroToken, error) {
+	p.start = p.pos
+	expr, err := p.parseExpression()
+	if err != nil {
+		return macroToken{}, err
+	}
+	if p.pos >= len(p.input) {
+		return macroToken{}, errors.New("malformed variable: no closing braces")
+	}
+	if p.input[p.pos] != '}' {
+		return macroToken{}, p.malformed()
+	}
+
+	text := p.input[p.start:p.pos]
+	p.pos++ // Skip '}'
+	if ref, ok := expr.(*referenceExpr); ok && ref.isPlain() {
+		return macroToken{text: text, variable: ref.variable, key: ref.key}, nil
+	}
+	return macroToken{text: text, variable: variables.Unknown, expr: expr}, nil
+}
+
+func (p *exprParser) parseExpression() (expression, error) {
+	if p.atQuote() {
+		return p.parseLiteral()
+	}
+
+	count := false
+	if p.peek() == '&' {
+		count = true
+		p.pos++
+	}
+
+	name := p.parseName()
+	if name == "" {
+		return nil, p.malformed()
+	}
+
+	if p.peek() == '(' && !count {
+		return p.parseFunction(name)
+	}
+
+	v, err := variables.Parse(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown variable %q", name)
+	}
+	ref := &referenceExpr{variable: v, count: count}
+
+	if c := p.peek(); c != '.' && c != ':' {
+		return ref, nil
+	}
+	p.pos++ // Skip the key separator
+
+	if p.peek() == '/' {
+		rx, err := p.parseRegex()
+		if err != nil {
+			return nil, err
+		}
+		ref.keyRx = rx
+		return ref, nil
+	}
+
+	start := p.pos
+	for p.pos < len(p.input) && isValidMacroChar(p.input[p.pos]) {
+		p.pos++
+	}
+	if p.pos == start {
+		return nil, errors.New("empty variable key")
+	}
+	ref.key = strings.ToLower(p.input[start:p.pos])
+	return ref, nil
+}
+
+func (p *exprParser) parseFunction(name string) (expression, error) {
+	p.pos++ // Skip '('
+	p.skipSpaces()
+	arg, err := p.parseExpression()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpaces()
+
+	var expr expression
+	fname := strings.ToLower(name)
+	if fname == "join" {
+		if p.peek() != ',' {
+			return nil, fmt.Errorf("missing separator in macro function %q", name)
+		}
+		p.pos++
+		p.skipSpaces()
+		if !p.atQuote() {
+			return nil, fmt.Errorf("separator of macro function %q must be quoted", name)
+		}
+		sep, err := p.parseLiteral()
+		if err != nil {
+			return nil, err
+		}
+		p.skipSpaces()
+		expr = &joinExpr{arg: arg, separator: sep.value}
+	} else {
+		fn, ok := macroFunctions[fname]
+		if !ok {
+			return nil, fmt.Errorf("unknown macro function %q", name)
+		}
+		expr = &functionExpr{fn: fn, arg: arg}
+	}
+
+	if p.peek() != ')' {
+		return nil, fmt.Errorf("malformed call to macro function %q", name)
+	}
+	p.pos++
+	return expr, nil
+}
+
+// parseLiteral parses a quoted literal. Quotes can be escaped as \' when the
+// macro is itself within quotes, e.g. in rule actions: msg:'%{join(ARGS, \'|\')}'
+func (p *exprParser) parseLiteral() (*literalExpr, error) {
+	escapedQuotes := p.input[p.pos] == '\\'
+	if escapedQuotes {
+		p.pos++
+	}
+	p.pos++ // Skip the opening quote
+	var value strings.Builder
+	for ; p.pos < len(p.input); p.pos++ {
+		c := p.input[p.pos]
+		if escapedQuotes && c == '\\' && p.atQuote() {
+			p.pos += 2
+			return &literalExpr{value: value.String()}, nil
+		}
+		if c == '\\' && p.pos+1 < len(p.input) {
+			p.pos++
+			value.WriteByte(p.input[p.pos])
+			continue
+		}
+		if c == '\'' && !escapedQuotes {
+			p.pos++
+			return &literalExpr{value: value.String()}, nil
+		}
+		value.WriteByte(c)
+	}
+	return nil, errors.New("malformed variable: unterminated literal")
+}
+
+// atQuote reports whether the next byte is a quote, escaped or not
+func (p *exprParser) atQuote() bool {
+	if p.peek() == '\\' {
+		return p.pos+1 < len(p.input) && p.input[p.pos+1] == '\''
+	}
+	return p.peek() == '\''
+}
+
+// parseRegex parses a /regex/ key, slashes in the regex are escaped as \/
+func (p *exprParser) parseRegex() (*regexp.Regexp, error) {
+	p.pos++ // Skip the opening slash
+	var rx strings.Builder
+	for ; p.pos < len(p.input); p.pos++ {
+		c := p.input[p.pos]
+		if c == '\\' && p.pos+1 < len(p.input) && p.input[p.pos+1] == '/' {
+			p.pos++
+			rx.WriteByte('/')
+			continue
+		}
+		if c == '/' {
+			p.pos++
+			pattern := rx.String()
+			re, err := memoize.Do("macro:rx:"+pattern, func() (interface{}, error) { return regexp.Compile(pattern) })
+			if err != nil {
+				return nil, fmt.Errorf("invalid key regex %q: %v", pattern, err)
+			}
+			return re.(*regexp.Regexp), nil
+		}
+		rx.WriteByte(c)
+	}
+	return nil, errors.New("malformed variable: unterminated key regex")
+}
+
+func (p *exprParser) parseName() string {
+	start := p.pos
+	for p.pos < len(p.input) {
+		c := p.input[p.pos]
+		if c != '_' && (c < '0' || c > '9') && (c < 'A' || c > 'Z') && (c < 'a' || c > 'z') {
+			break
+		}
+		p.pos++
+	}
+	return p.input[start:p.pos]
+}
+
+func (p *exprParser) skipSpaces() {
+	for p.pos < len(p.input) && p.input[p.pos] == ' ' {
+		p.pos++
+	}
+}
+
+func (p *exprParser) peek() byte {
+	if p.pos < len(p.input) {
+		return p.input[p.pos]
+	}
+	return 0
+}
+
+func (p *exprParser) malformed() error {
+	end := p.pos + 1
+	if end > len(p.input) {
+		end = len(p.input)
+	}
+	return fmt.Errorf("malformed variable starting with %q", "%{"+p.input[p.start:end])
+}
@@ -0,0 +1,84 @@
+// Copyright 2023 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package macro_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/corazawaf/coraza/v3/experimental/plugins/macro"
+	"github.com/corazawaf/coraza/v3/internal/corazawaf"
+)
+
+func TestExpandExpressions(t *testing.T) {
+	tx := corazawaf.NewWAF().NewTransaction()
+	defer tx.Close()
+	tx.ProcessURI("/login?id_b=2&id_a=1&user=Bob&user=Alice", "GET", "HTTP/1.1")
+	tx.AddRequestHeader("Host", "WWW.Example.com")
+	tx.Variables().TX().Set("score", []string{"5"})
+
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"%{tx.score}", "5"},
+		{"%{TX:score}", "5"},
+		{"%{ARGS_GET.user}", "Bob"},
+		{"%{&ARGS}", "4"},
+		{"%{&ARGS:user}", "2"},
+		{"%{&ARGS:/^id_/}", "2"},
+		{"%{&REQUEST_HEADERS:missing}", "0"},
+		{"%{ARGS:/^id_/}", "1,2"},
+		{"%{ARGS_NAMES:/^id_/}", "id_a,id_b"},
+		{"%{&ARGS_NAMES:user}", "2"},
+		{"%{join(ARGS:/^id_/, ' | ')}", "1 | 2"},
+		{"%{join(ARGS:/^id_/,'\\'')}", "1'2"},
+		{"%{join(ARGS:/^id_/, \\'-\\')}", "1-2"},
+		{"%{lower(REQUEST_HEADERS.host)}", "www.example.com"},
+		{"%{UPPER(ARGS_GET.user)}", "BOB"},
+		{"%{length(REQUEST_URI)}", "40"},
+		{"%{sha256(tx.score)}", "ef2d127de37b942baad06145e54b0c619a1f22327b2ebbcfbec78f5564afe39d"},
+		{"%{md5(lower('ABC'))}", "900150983cd24fb0d6963f7d28e17f72"},
+		{"%{base64(upper(ARGS:/^id_/))}", "MQ==,Mg=="},
+		{"%{urlEncode(join(ARGS_GET.user, ' '))}", "Bob"},
+		{"score %{tx.score} for %{&ARGS} args", "score 5 for 4 args"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.input, func(t *testing.T) {
+			m, err := macro.NewMacro(tc.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if have := m.Expand(tx); tc.want != have {
+				t.Errorf("unexpected expansion, want %q, have %q", tc.want, have)
+			}
+		})
+	}
+}
+
+func TestCompileExpressionErrors(t *testing.T) {
+	tests := map[string]string{
+		"%{unknown(tx.a)}":        "unknown macro function",
+		"%{lower(tx.a}":           "malformed call",
+		"%{lower(nothing.a)}":     "unknown variable",
+		"%{join(ARGS)}":           "missing separator",
+		"%{join(ARGS, |)}":        "must be quoted",
+		"%{join(ARGS, '|)}":       "unterminated literal",
+		"%{ARGS:/[/}":             "invalid key regex",
+		"%{ARGS:/abc}":            "unterminated key regex",
+		"%{&lower(tx.a)}":         "unknown variable",
+		"%{lower(tx.a) trailing}": "malformed variable",
+	}
+	for input, want := range tests {
+		t.Run(input, func(t *testing.T) {
+			_, err := macro.NewMacro(input)
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if !strings.Contains(err.Error(), want) {
+				t.Errorf("unexpected error, want it to contain %q, have %q", want, err.Error())
+			}
+		})
+	}
+}
@@ -38,6 +38,8 @@ type macroToken struct {
 	text     string
 	variable variables.RuleVariable
 	key      string
+	// expr is set for expressions richer than a variable key, see expression
+	expr expression
 }
 
 // macro is used to create tokenized strings that can be
@@ -48,6 +50,11 @@ type macroToken struct {
 // - String token: some string
 // - Variable token: Variable: TX, key: var
 // - String token: some string
+//
+// Besides variables, expansions support counts (%{&ARGS}), keys selected by regex
+// (%{ARGS:/^id_/}), whose values are joined with commas, and functions
+// (%{lower(REQUEST_HEADERS.host)}, %{join(ARGS_NAMES, '|')}), see exprParser.
+// Within functions, a variable without key selects all the values of the collection.
 type macro struct {
 	original string
 	tokens   []macroToken
@@ -66,6 +73,9 @@ func (m *macro) Expand(tx plugintypes.TransactionState) string {
 }
 
 func expandToken(tx plugintypes.TransactionState, token macroToken) string {
+	if token.expr != nil {
+		return strings.Join(token.expr.values(tx), valueSeparator)
+	}
 	if token.variable == variables.Unknown {
 		return token.text
 	}
@@ -101,7 +111,6 @@ func (m *macro) compile(input string) error {
 
 	m.original = input
 	var currentToken strings.Builder
-	isMacro := false
 
 	for i := 0; i < l; i++ {
 		c := input[i]
@@ -115,40 +124,14 @@ func (m *macro) compile(input string) error {
 				})
 				currentToken.Reset()
 			}
-			isMacro = true
-			i++ // Skip '{'
-			continue
-		}
-
-		if isMacro {
-			if c == '}' {
-				isMacro = false
-				if input[i-1] == '.' {
-					return fmt.Errorf("empty variable name")
-				}
-				varName, key, _ := strings.Cut(currentToken.String(), ".")
-				v, err := variables.Parse(varName)
-				if err != nil {
-					return fmt.Errorf("unknown variable %q", varName)
-				}
-				m.tokens = append(m.tokens, macroToken{
-					text:     currentToken.String(),
-					variable: v,
-					key:      strings.ToLower(key),
-				})
-				currentToken.Reset()
-				continue
-			}
-
-			if !isValidMacroChar(c) {
-				return fmt.Errorf("malformed variable starting with %q", "%{"+currentToken.String())
-			}
-
-			currentToken.WriteByte(c)
 
-			if i+1 == l {
-				return errors.New("malformed variable: no closing braces")
+			p := &exprParser{input: input, pos: i + 2}
+			token, err := p.parseMacro()
+			if err != nil {
+				return err
 			}
+			m.tokens = append(m.tokens, token)
+			i = p.pos - 1 // p.pos is right after the closing brace
 			continue
 		}
 
@@ -71,7 +71,7 @@ func TestCompile(t *testing.T) {
 	t.Run("malformed macros", func(t *testing.T) {
 		for _, test := range []string{
 			"%{tx.count", "%{{tx.count}", "%{{tx.{count}", "something %{tx.count",
-			"%{ARG_NAMES:/exec/", // Wildcard variable names are not supported
+			"%{ARGS_NAMES:/exec/", // Key regex without closing braces
 		} {
 			t.Run(test, func(t *testing.T) {
 				m := &macro{}
@@ -114,7 +114,7 @@ func TestCompile(t *testing.T) {
 			t.Fatalf("unexpected number of tokens: want %d, have %d", want, have)
 		}
 
-		expectedMacro := macroToken{"tx.missing_key", variables.TX, "missing_key"}
+		expectedMacro := macroToken{"tx.missing_key", variables.TX, "missing_key", nil}
 		if want, have := m.tokens[0], expectedMacro; want != have {
 			t.Errorf("unexpected token: wanted %v, got %v", want, have)
 		}
@@ -126,9 +126,9 @@ func TestCompile(t *testing.T) {
 			expectedMacro macroToken
 		}
 		for _, tc := range []testCase{
-			{"%{tx.count}", macroToken{"tx.count", variables.TX, "count"}},
-			{"%{ARGS.exec}", macroToken{"ARGS.exec", variables.Args, "exec"}},
-			{"%{ARGS_GET.db[]}", macroToken{"ARGS_GET.db[]", variables.ArgsGet, "db[]"}},
+			{"%{tx.count}", macroToken{"tx.count", variables.TX, "count", nil}},
+			{"%{ARGS.exec}", macroToken{"ARGS.exec", variables.Args, "exec", nil}},
+			{"%{ARGS_GET.db[]}", macroToken{"ARGS_GET.db[]", variables.ArgsGet, "db[]", nil}},
 		} {
 			m := &macro{}
 			err := m.compile(tc.input)
@@ -157,27 +157,27 @@ func TestCompile(t *testing.T) {
 			t.Fatalf("unexpected number of tokens: want %d, have %d", want, have)
 		}
 
-		expectedMacro0 := macroToken{"tx.id", variables.TX, "id"}
+		expectedMacro0 := macroToken{"tx.id", variables.TX, "id", nil}
 		if want, have := m.tokens[0], expectedMacro0; want != have {
 			t.Errorf("unexpected token: want %v, have %v", want, have)
 		}
 
-		expectedMacro1 := macroToken{" got ", variables.Unknown, ""}
+		expectedMacro1 := macroToken{" got ", variables.Unknown, "", nil}
 		if want, have := m.tokens[1], expectedMacro1; want != have {
 			t.Errorf("unexpected token: want %v, have %v", want, have)
 		}
 
-		expectedMacro2 := macroToken{"tx.count", variables.TX, "count"}
+		expectedMacro2 := macroToken{"tx.count", variables.TX, "count", nil}
 		if want, have := m.tokens[2], expectedMacro2; want != have {
 			t.Errorf("unexpected token: want %v, have %v", want, have)
 		}
 
-		expectedMacro3 := macroToken{" in this transaction and as zero ", variables.Unknown, ""}
+		expectedMacro3 := macroToken{" in this transaction and as zero ", variables.Unknown, "", nil}
 		if want, have := m.tokens[3], expectedMacro3; want != have {
 			t.Errorf("unexpected token: want %v, have %v", want, have)
 		}
 
-		expectedMacro4 := macroToken{"tx.0", variables.TX, "0"}
+		expectedMacro4 := macroToken{"tx.0", variables.TX, "0", nil}
 		if want, have := m.tokens[4], expectedMacro4; want != have {
 			t.Errorf("unexpected token: want %v, have %v", want, have)
 		}
@@ -188,7 +188,7 @@ func TestExpand(t *testing.T) {
 	t.Run("unknown variable", func(t *testing.T) {
 		m := &macro{
 			tokens: []macroToken{
-				{"text", variables.Unknown, ""},
+				{"text", variables.Unknown, "", nil},
 			},
 		}
 
@@ -13,3 +13,12 @@ import (
 func RegisterOperator(name string, op plugintypes.OperatorFactory) {
 	operators.Register(name, op)
 }
+
+// RegisterFileInspector registers a named in-process file inspector that
+// can be used by the @inspectFile operator with the go: prefix, for example
+// `@inspectFile go:clamav`. The inspector must return when its context is
+// cancelled, as the timeout of @inspectFile is not enforced otherwise.
+// If the inspector already exists it will be overwritten
+func RegisterFileInspector(name string, fn plugintypes.FileInspector) {
+	operators.RegisterFileInspector(name, fn)
+}
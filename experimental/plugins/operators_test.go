@@ -4,6 +4,7 @@
 package plugins_test
 
 import (
+	"context"
 	"testing"
 
 	"github.com/corazawaf/coraza/v3/experimental/plugins"
@@ -24,3 +25,17 @@ func TestGetOperator(t *testing.T) {
 		}
 	})
 }
+
+func TestRegisterFileInspector(t *testing.T) {
+	plugins.RegisterFileInspector("custom_inspector", func(context.Context, plugintypes.TransactionState, string) (bool, error) {
+		return true, nil
+	})
+
+	op, err := operators.Get("inspectFile", plugintypes.OperatorOptions{Arguments: "go:custom_inspector"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !op.Evaluate(nil, "/tmp/upload") {
+		t.Error("expected match from custom inspector")
+	}
+}
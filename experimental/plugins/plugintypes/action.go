@@ -3,6 +3,8 @@
 
 package plugintypes
 
+import "github.com/corazawaf/coraza/v3/types"
+
 // ActionType is used to define when an action is going
 // to be triggered
 type ActionType int
@@ -31,3 +33,25 @@ type Action interface {
 	// Type returns the type of action.
 	Type() ActionType
 }
+
+// ExecCallback is a function run synchronously by the exec action of the rules referring
+// to it by name. It can read and modify the transaction, e.g. setting TX variables.
+type ExecCallback func(tx TransactionState, rule RuleMetadata)
+
+// ExecEvent is a snapshot of the transaction taken when a rule runs an asynchronous exec
+// callback, which may run after the transaction is closed
+type ExecEvent struct {
+	// TransactionID is the ID of the transaction
+	TransactionID string
+	// ClientIP and URI are the address of the client and the URI of the request
+	ClientIP string
+	URI      string
+	// Rule is the metadata of the rule running the callback
+	Rule RuleMetadata
+	// MatchedVars are the variables matched by the rule, like MATCHED_VARS
+	MatchedVars []types.MatchData
+}
+
+// AsyncExecCallback is a function run in background by the exec action of the rules
+// referring to it by name, with a snapshot of the transaction.
+type AsyncExecCallback func(event ExecEvent)
@@ -21,6 +21,8 @@ type BodyProcessorOptions struct {
 	FileMode fs.FileMode
 	// DirMode is the mode of the directory that will be created
 	DirMode fs.FileMode
+	// ArgumentSeparator separates the arguments of urlencoded bodies, "&" if it's 0
+	ArgumentSeparator byte
 }
 
 // BodyProcessor interface is used to create
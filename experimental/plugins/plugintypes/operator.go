@@ -3,7 +3,11 @@
 
 package plugintypes
 
-import "io/fs"
+import (
+	"context"
+	"io/fs"
+	"time"
+)
 
 // OperatorOptions is used to store the options for a rule operator
 type OperatorOptions struct {
@@ -18,6 +22,18 @@ type OperatorOptions struct {
 
 	// Datasets contains input datasets or dictionaries
 	Datasets map[string][]string
+
+	// RBLTimeout bounds the time spent resolving a single @rbl lookup.
+	// A zero value means the operator default is used.
+	RBLTimeout time.Duration
+
+	// HTTPBLKey is the Project Honeypot http:BL access key used by @rbl
+	// when querying dnsbl.httpbl.org.
+	HTTPBLKey string
+
+	// InspectFileTimeout bounds the time spent by @inspectFile on a single file.
+	// A zero value means the operator default is used.
+	InspectFileTimeout time.Duration
 }
 
 // Operator interface is used to define rule @operators
@@ -29,3 +45,25 @@ type Operator interface {
 }
 
 type OperatorFactory func(options OperatorOptions) (Operator, error)
+
+// FileInspector is used by the @inspectFile operator to scan a file in-process
+// instead of executing an external program, e.g. @inspectFile go:name. It returns
+// true when the file is considered malicious. Errors are only used for logging
+// and are treated as no match. Inspectors must honor the cancellation of ctx, which
+// is how the timeout of @inspectFile is enforced: an inspector ignoring it blocks the
+// transaction until it returns.
+type FileInspector = func(ctx context.Context, tx TransactionState, path string) (bool, error)
+
+// DatasetOperator is implemented by operators built from a SecDataset, e.g.
+// @pmFromDataset, so that the dataset can be replaced at runtime.
+type DatasetOperator interface {
+	Operator
+
+	// Dataset returns the name of the dataset the operator is bound to.
+	Dataset() string
+
+	// PrepareDataset builds the matcher for the new dataset values without
+	// affecting the running operator. The returned commit function swaps it
+	// in and must be safe to call concurrently with Evaluate.
+	PrepareDataset(values []string) (commit func(), err error)
+}
@@ -0,0 +1,25 @@
+// Copyright 2024 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package experimental
+
+// TransactionWithModifiedResponseBody is an interface that exposes the response
+// body once modified by the WAF, e.g. when the hash engine signs its links or
+// when the append and prepend actions inject content. Connectors use it to send
+// the modified body with an adjusted Content-Length header.
+type TransactionWithModifiedResponseBody interface {
+	// ModifiedResponseBody returns the modified response body and whether the
+	// response body has been modified at all.
+	ModifiedResponseBody() ([]byte, bool)
+	// ResponseContentLength returns the length of the response body to be sent,
+	// modified or not.
+	ResponseContentLength() int64
+}
+
+// TransactionWithEnv is an interface that exposes the environment variables set
+// by the setenv action, so that connectors can use them, e.g. to set request
+// context values or upstream headers.
+type TransactionWithEnv interface {
+	// Env returns the environment variables set for the transaction.
+	Env() map[string]string
+}
@@ -15,3 +15,21 @@ type Options = corazawaf.Options
 type WAFWithOptions interface {
 	NewTransactionWithOptions(Options) types.Transaction
 }
+
+// WAFWithDatasets is an interface that allows to replace the values of a
+// SecDataset at runtime, for example from a threat intelligence feed.
+// Every operator bound to the dataset (e.g. @pmFromDataset and
+// @ipMatchFromDataset) atomically swaps to a matcher built from the new values.
+type WAFWithDatasets interface {
+	UpdateDataset(name string, values []string) error
+}
+
+// RulePerformance aggregates the evaluations of a rule slower than SecRulePerfTime
+type RulePerformance = corazawaf.RulePerformance
+
+// WAFWithRulePerformance is an interface that allows to retrieve the rules whose
+// evaluation took at least SecRulePerfTime, the slowest ones in total first. The
+// aggregation restarts from scratch after a reset.
+type WAFWithRulePerformance interface {
+	RulePerformance(reset bool) []RulePerformance
+}
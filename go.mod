@@ -29,6 +29,7 @@ require (
 	github.com/valllabh/ocsf-schema-golang v1.0.3
 	golang.org/x/net v0.39.0
 	golang.org/x/sync v0.13.0
+	golang.org/x/text v0.24.0
 	rsc.io/binaryregexp v0.2.0
 )
 
@@ -31,6 +31,10 @@ SecRule REQUEST_URI "@streq /admin" "id:101,phase:1,t:lowercase,log,deny"
 SecRule REQUEST_BODY "@rx maliciouspayload" "id:102,phase:2,t:lowercase,log,deny"
 SecRule RESPONSE_HEADERS:pass "@rx leak" "id:103,phase:3,t:lowercase,log,deny"
 SecRule RESPONSE_BODY "@contains responsebodycode" "id:104,phase:4,t:lowercase,log,deny"
+SecRule REQUEST_URI "@streq /drop" "id:105,phase:1,t:lowercase,log,drop"
+SecRule REQUEST_URI "@streq /redirect" "id:106,phase:1,t:lowercase,log,redirect:https://www.example.com/blocked"
+SecRule REQUEST_URI "@streq /redirect-see-other" "id:107,phase:1,t:lowercase,log,status:303,redirect:https://www.example.com/blocked"
+SecRule RESPONSE_HEADERS:pass "@rx drop" "id:108,phase:3,t:lowercase,log,drop"
 # Custom rules mimicking the following CRS rules: 941100, 942100, 913100
 SecRule ARGS_NAMES|ARGS "@detectXSS" "id:9411,phase:2,t:none,t:utf8toUnicode,t:urlDecodeUni,t:htmlEntityDecode,t:jsDecode,t:cssDecode,t:removeNulls,log,deny"
 SecRule ARGS_NAMES|ARGS "@detectSQLi" "id:9421,phase:2,t:none,t:utf8toUnicode,t:urlDecodeUni,t:removeNulls,multiMatch,log,deny"
@@ -128,6 +132,19 @@ func expectEmptyBody() bodyExpectation {
 	}
 }
 
+// headersExpectation checks the headers of a response
+type headersExpectation func(http.Header) error
+
+func expectHeader(name, value string) headersExpectation {
+	return func(h http.Header) error {
+		if have := h.Get(name); have != value {
+			return fmt.Errorf("expected header %s %q, got %q", name, value, have)
+		}
+
+		return nil
+	}
+}
+
 func Run(cfg Config) error {
 	healthURL := setHTTPSchemeIfMissing(cfg.HttpbinEntrypoint) + "/status/200"
 	baseProxyURL := setHTTPSchemeIfMissing(cfg.ProxiedEntrypoint)
@@ -162,7 +179,10 @@ func Run(cfg Config) error {
 		requestBody        string
 		requestMethod      string
 		expectedStatusCode statusCodeExpectation
+		expectedHeaders    headersExpectation
 		expectedBody       bodyExpectation
+		// expectedDrop is set when the connection is expected to be closed without response
+		expectedDrop bool
 	}{
 		{
 			name:               "Legit request",
@@ -202,6 +222,34 @@ func Run(cfg Config) error {
 			requestMethod:      "GET",
 			expectedStatusCode: expectStatusCode(403),
 		},
+		{
+			name:          "Dropped request by URL",
+			requestURL:    baseProxyURL + "/drop",
+			requestMethod: "GET",
+			expectedDrop:  true,
+		},
+		{
+			name:          "Dropped request with a malicious response header",
+			requestURL:    baseProxyURL + "/response-headers?pass=drop",
+			requestMethod: "GET",
+			expectedDrop:  true,
+		},
+		{
+			name:               "Redirected request by URL",
+			requestURL:         baseProxyURL + "/redirect",
+			requestMethod:      "GET",
+			expectedStatusCode: expectStatusCode(302),
+			expectedHeaders:    expectHeader("Location", "https://www.example.com/blocked"),
+		},
+		{
+			name:               "Redirected request by URL with custom status",
+			requestURL:         baseProxyURL + "/redirect-see-other",
+			requestMethod:      "POST",
+			requestHeaders:     map[string]string{"Content-Type": "application/x-www-form-urlencoded"},
+			requestBody:        "a=b",
+			expectedStatusCode: expectStatusCode(303),
+			expectedHeaders:    expectHeader("Location", "https://www.example.com/blocked"),
+		},
 		{
 			name:               "Denied request with a malicious response body",
 			requestURL:         echoProxiedURL,
@@ -282,6 +330,13 @@ func Run(cfg Config) error {
 		}
 	}
 
+	// Redirections are checked rather than followed
+	testClient := &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
 	// Iterate over tests
 	for currentTestIndex, test := range tests {
 		fmt.Printf("[%d/%d] Running test: %s\n", currentTestIndex+1, len(tests), test.name)
@@ -299,7 +354,16 @@ func Run(cfg Config) error {
 		}
 		req.Header.Add("coraza-e2e", "ok")
 
-		resp, err := http.DefaultClient.Do(req)
+		resp, err := testClient.Do(req)
+		if test.expectedDrop {
+			if err == nil {
+				resp.Body.Close()
+				return fmt.Errorf("expected dropped connection, got status code %d", resp.StatusCode)
+			}
+
+			fmt.Printf("[Ok] Got expected dropped connection: %v\n", err)
+			continue
+		}
 		if err != nil {
 			return fmt.Errorf("could not do http request: %v", err)
 		}
@@ -315,6 +379,14 @@ func Run(cfg Config) error {
 			fmt.Printf("[Ok] Got expected status code %d\n", resp.StatusCode)
 		}
 
+		if test.expectedHeaders != nil {
+			if err := test.expectedHeaders(resp.Header); err != nil {
+				return err
+			}
+
+			fmt.Print("[Ok] Got expected response headers\n")
+		}
+
 		if test.expectedBody != nil {
 			// Some servers might abort the request before sending the body (E.g. triggering a phase 3 rule with deny action)
 			// Therefore, we check if we properly read the body only if we expect a body to be received.
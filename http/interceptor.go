@@ -12,7 +12,9 @@ import (
 	"io"
 	"log"
 	"net/http"
+	"strconv"
 
+	"github.com/corazawaf/coraza/v3/experimental"
 	"github.com/corazawaf/coraza/v3/types"
 )
 
@@ -43,10 +45,7 @@ func (i *rwInterceptor) WriteHeader(statusCode int) {
 
 	i.statusCode = statusCode
 	if it := i.tx.ProcessResponseHeaders(statusCode, i.proto); it != nil {
-		i.cleanHeaders()
-		i.Header().Set("Content-Length", "0")
-		i.statusCode = obtainStatusCodeFromInterruptionOrDefault(it, i.statusCode)
-		i.flushWriteHeader()
+		i.interrupt(it)
 		return
 	}
 
@@ -66,6 +65,26 @@ func (i *rwInterceptor) flushWriteHeader() {
 	}
 }
 
+// interrupt replaces the response with the one of the interruption: an empty
+// body with the status code and the Location header of redirections, or no
+// response at all when dropping the connection.
+func (i *rwInterceptor) interrupt(it *types.Interruption) {
+	if it.Action == "drop" {
+		// nothing can be written to a dropped connection
+		i.isWriteHeaderFlush = true
+		dropConnection(i.w)
+		return
+	}
+
+	i.cleanHeaders()
+	i.Header().Set("Content-Length", "0")
+	if it.Action == "redirect" {
+		i.Header().Set("Location", it.Data)
+	}
+	i.overrideWriteHeader(obtainStatusCodeFromInterruptionOrDefault(it, i.statusCode))
+	i.flushWriteHeader()
+}
+
 // cleanHeaders removes all headers from the response
 func (i *rwInterceptor) cleanHeaders() {
 	for k := range i.w.Header() {
@@ -100,12 +119,9 @@ func (i *rwInterceptor) Write(b []byte) (int, error) {
 		// to it, otherwise we just send it to the response writer.
 		it, n, err := i.tx.WriteResponseBody(b)
 		if it != nil {
-			// if there is an interruption we must clean the headers and override the status code
-			i.cleanHeaders()
-			i.Header().Set("Content-Length", "0")
-			i.overrideWriteHeader(obtainStatusCodeFromInterruptionOrDefault(it, i.statusCode))
+			// if there is an interruption we must clean the headers and override the status code.
 			// We only flush the status code after an interruption.
-			i.flushWriteHeader()
+			i.interrupt(it)
 			// We return the number of bytes as according to the interface io.Writer
 			// if we don't return an error, the number of bytes written is len(p).
 			// See https://pkg.go.dev/io#Writer
@@ -172,10 +188,7 @@ func wrap(w http.ResponseWriter, r *http.Request, tx types.Transaction) (
 				return err
 			} else if it != nil {
 				// if there is an interruption we must clean the headers and override the status code
-				i.cleanHeaders()
-				i.Header().Set("Content-Length", "0")
-				i.overrideWriteHeader(obtainStatusCodeFromInterruptionOrDefault(it, i.statusCode))
-				i.flushWriteHeader()
+				i.interrupt(it)
 				return nil
 			}
 
@@ -187,6 +200,14 @@ func wrap(w http.ResponseWriter, r *http.Request, tx types.Transaction) (
 				return fmt.Errorf("failed to release the response body reader: %v", err)
 			}
 
+			// the hash engine or the append and prepend actions may have modified
+			// the body, so the declared length has to be updated.
+			if mtx, ok := tx.(experimental.TransactionWithModifiedResponseBody); ok && i.w.Header().Get("Content-Length") != "" {
+				if _, modified := mtx.ModifiedResponseBody(); modified {
+					i.w.Header().Set("Content-Length", strconv.FormatInt(mtx.ResponseContentLength(), 10))
+				}
+			}
+
 			// this is the last opportunity we have to report the resolved status code
 			// as next step is write into the response writer (triggering a 200 in the
 			// response status code.)
@@ -8,6 +8,7 @@
 package http
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"net/http"
@@ -96,6 +97,16 @@ func processRequest(tx types.Transaction, req *http.Request) (*types.Interruptio
 	return tx.ProcessRequestBody()
 }
 
+type envContextKey struct{}
+
+// EnvFromContext returns the environment variables set by the setenv action while
+// processing the request. WrapHandler adds them to the request context before
+// calling the wrapped handler.
+func EnvFromContext(ctx context.Context) map[string]string {
+	env, _ := ctx.Value(envContextKey{}).(map[string]string)
+	return env
+}
+
 func WrapHandler(waf coraza.WAF, h http.Handler) http.Handler {
 	if waf == nil {
 		return h
@@ -139,10 +150,17 @@ func WrapHandler(waf coraza.WAF, h http.Handler) http.Handler {
 			tx.DebugLogger().Error().Err(err).Msg("Failed to process request")
 			return
 		} else if it != nil {
-			w.WriteHeader(obtainStatusCodeFromInterruptionOrDefault(it, http.StatusOK))
+			writeInterruption(w, it)
 			return
 		}
 
+		// The variables set by setenv are made available to the next handlers
+		if etx, ok := tx.(experimental.TransactionWithEnv); ok {
+			if env := etx.Env(); len(env) > 0 {
+				r = r.WithContext(context.WithValue(r.Context(), envContextKey{}, env))
+			}
+		}
+
 		ww, processResponse := wrap(w, r, tx)
 
 		// We continue with the other middlewares by catching the response
@@ -160,13 +178,46 @@ func WrapHandler(waf coraza.WAF, h http.Handler) http.Handler {
 // obtainStatusCodeFromInterruptionOrDefault returns the desired status code derived from the interruption
 // on a "deny" action or a default value.
 func obtainStatusCodeFromInterruptionOrDefault(it *types.Interruption, defaultStatusCode int) int {
-	if it.Action == "deny" {
+	switch it.Action {
+	case "deny":
 		statusCode := it.Status
 		if statusCode == 0 {
 			statusCode = 403
 		}
 
+		return statusCode
+	case "redirect":
+		statusCode := it.Status
+		if statusCode == 0 {
+			statusCode = 302
+		}
+
 		return statusCode
 	}
 	return defaultStatusCode
 }
+
+// writeInterruption responds to a request interrupted before reaching the handler
+func writeInterruption(w http.ResponseWriter, it *types.Interruption) {
+	switch it.Action {
+	case "drop":
+		dropConnection(w)
+		return
+	case "redirect":
+		w.Header().Set("Location", it.Data)
+	}
+	w.WriteHeader(obtainStatusCodeFromInterruptionOrDefault(it, http.StatusOK))
+}
+
+// dropConnection closes the connection without sending any response. HTTP/1.x
+// connections are hijacked and closed while HTTP/2 streams, which can't be hijacked,
+// are reset by aborting the handler with http.ErrAbortHandler.
+func dropConnection(w http.ResponseWriter) {
+	if hj, ok := w.(http.Hijacker); ok {
+		if conn, _, err := hj.Hijack(); err == nil {
+			_ = conn.Close()
+			return
+		}
+	}
+	panic(http.ErrAbortHandler)
+}
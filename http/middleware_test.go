@@ -12,10 +12,12 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"log"
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"net/textproto"
+	"os"
 	"strconv"
 	"strings"
 	"testing"
@@ -533,6 +535,20 @@ func TestObtainStatusCodeFromInterruptionOrDefault(t *testing.T) {
 			interruptionCode:   202,
 			expectedCode:       202,
 		},
+		"action redirect with no code": {
+			interruptionAction: "redirect",
+			expectedCode:       302,
+		},
+		"action redirect with code": {
+			interruptionAction: "redirect",
+			interruptionCode:   303,
+			expectedCode:       303,
+		},
+		"action drop": {
+			interruptionAction: "drop",
+			defaultCode:        200,
+			expectedCode:       200,
+		},
 		"default code": {
 			defaultCode:  204,
 			expectedCode: 204,
@@ -643,3 +659,180 @@ func TestHandlerAPI(t *testing.T) {
 		})
 	}
 }
+
+func TestHandlerHashEngine(t *testing.T) {
+	waf, err := coraza.NewWAF(coraza.NewWAFConfig().
+		WithResponseBodyAccess().
+		WithDirectives(`
+SecResponseBodyMimeType text/html
+SecHashEngine On
+SecHashKey "this_is_my_key" KeyOnly
+SecHashMethodRx HashHref "product"
+SecRule REQUEST_URI "@validateHash product" "id:1,phase:1,deny,status:403"
+`))
+	if err != nil {
+		t.Fatalf("unexpected error while creating the WAF: %s", err.Error())
+	}
+
+	body := `<html><body><a href="/product?id=1">product</a></body></html>`
+	srv := httptest.NewServer(WrapHandler(waf, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		_, _ = w.Write([]byte(body))
+	})))
+	defer srv.Close()
+
+	res, err := http.Get(srv.URL + "/")
+	if err != nil {
+		t.Fatalf("unexpected error while performing the request: %s", err.Error())
+	}
+	signed, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		t.Fatalf("unexpected error while reading the body: %s", err.Error())
+	}
+	if want, have := strconv.Itoa(len(signed)), res.Header.Get("Content-Length"); want != have {
+		t.Fatalf("unexpected content length, want: %s, have: %s", want, have)
+	}
+
+	link := strings.TrimSuffix(strings.TrimPrefix(string(signed), `<html><body><a href="`), `">product</a></body></html>`)
+	link = strings.ReplaceAll(link, "&amp;", "&")
+	if !strings.Contains(link, "hmac=") {
+		t.Fatalf("expected a signed link, have: %s", signed)
+	}
+
+	for uri, status := range map[string]int{
+		link:                     http.StatusOK,
+		"/product?id=1":          http.StatusForbidden,
+		"/product?id=2&hmac=abc": http.StatusForbidden,
+	} {
+		res, err := http.Get(srv.URL + uri)
+		if err != nil {
+			t.Fatalf("unexpected error while performing the request: %s", err.Error())
+		}
+		res.Body.Close()
+		if want, have := status, res.StatusCode; want != have {
+			t.Errorf("unexpected status code for %s, want: %d, have: %d", uri, want, have)
+		}
+	}
+}
+
+func TestHandlerContentInjection(t *testing.T) {
+	waf, err := coraza.NewWAF(coraza.NewWAFConfig().
+		WithResponseBodyAccess().
+		WithDirectives(`
+SecResponseBodyMimeType text/html
+SecContentInjection On
+SecRule RESPONSE_CONTENT_TYPE "@beginsWith text/html" "id:1,phase:4,pass,nolog,prepend:'<!-- %{REQUEST_URI} -->',append:'<footer>%{REQUEST_METHOD}</footer>'"
+`))
+	if err != nil {
+		t.Fatalf("unexpected error while creating the WAF: %s", err.Error())
+	}
+
+	body := `<html><body>hello</body></html>`
+	srv := httptest.NewServer(WrapHandler(waf, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		_, _ = w.Write([]byte(body))
+	})))
+	defer srv.Close()
+
+	res, err := http.Get(srv.URL + "/index")
+	if err != nil {
+		t.Fatalf("unexpected error while performing the request: %s", err.Error())
+	}
+	injected, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		t.Fatalf("unexpected error while reading the body: %s", err.Error())
+	}
+
+	if want, have := `<!-- /index --><html><body>hello</body></html><footer>GET</footer>`, string(injected); want != have {
+		t.Errorf("unexpected body, want: %s, have: %s", want, have)
+	}
+	if want, have := strconv.Itoa(len(injected)), res.Header.Get("Content-Length"); want != have {
+		t.Errorf("unexpected content length, want: %s, have: %s", want, have)
+	}
+}
+
+func TestHandlerEnv(t *testing.T) {
+	waf, err := coraza.NewWAF(coraza.NewWAFConfig().
+		WithDirectives(`SecRule REQUEST_HEADERS:X-Tenant "@rx ^(\w+)$" "id:1,phase:1,pass,nolog,capture,setenv:tenant=%{tx.1}"`))
+	if err != nil {
+		t.Fatalf("unexpected error while creating the WAF: %s", err.Error())
+	}
+
+	var env map[string]string
+	srv := httptest.NewServer(WrapHandler(waf, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		env = EnvFromContext(r.Context())
+	})))
+	defer srv.Close()
+
+	req, _ := http.NewRequest("GET", srv.URL, nil)
+	req.Header.Set("X-Tenant", "acme")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error while performing the request: %s", err.Error())
+	}
+	res.Body.Close()
+
+	if want, have := "acme", env["tenant"]; want != have {
+		t.Errorf("unexpected env value, want: %q, have: %q", want, have)
+	}
+	if _, ok := os.LookupEnv("tenant"); ok {
+		t.Error("unexpected process env variable")
+	}
+}
+
+func TestHandlerDrop(t *testing.T) {
+	waf, err := coraza.NewWAF(coraza.NewWAFConfig().
+		WithDirectives(`
+SecRule REQUEST_URI "@streq /drop" "id:1,phase:1,drop"
+SecRule RESPONSE_HEADERS:X-Drop "@streq yes" "id:2,phase:3,drop"
+`))
+	if err != nil {
+		t.Fatalf("unexpected error while creating the WAF: %s", err.Error())
+	}
+	handler := WrapHandler(waf, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Drop", r.URL.Query().Get("drop"))
+		_, _ = w.Write([]byte("hello"))
+	}))
+
+	for name, start := range map[string]func(*httptest.Server){
+		"http1": (*httptest.Server).Start,
+		"http2": func(s *httptest.Server) {
+			s.EnableHTTP2 = true
+			s.StartTLS()
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			srv := httptest.NewUnstartedServer(handler)
+			srv.Config.ErrorLog = log.New(io.Discard, "", 0)
+			start(srv)
+			defer srv.Close()
+
+			for uri, dropped := range map[string]bool{
+				"/":          false,
+				"/drop":      true,
+				"/?drop=yes": true,
+				"/?drop=no":  false,
+			} {
+				res, err := srv.Client().Get(srv.URL + uri)
+				if dropped {
+					if err == nil {
+						res.Body.Close()
+						t.Errorf("expected dropped connection for %s, have status code %d", uri, res.StatusCode)
+					}
+					continue
+				}
+				if err != nil {
+					t.Fatalf("unexpected error while performing the request: %s", err.Error())
+				}
+				res.Body.Close()
+				if want, have := http.StatusOK, res.StatusCode; want != have {
+					t.Errorf("unexpected status code for %s, want: %d, have: %d", uri, want, have)
+				}
+			}
+		})
+	}
+}
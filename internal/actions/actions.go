@@ -34,6 +34,7 @@ func Register(name string, a func() plugintypes.Action) {
 
 func init() {
 	Register("allow", allow)
+	Register("append", appendContent)
 	Register("auditlog", auditlog)
 	Register("block", block)
 	Register("capture", capture)
@@ -54,8 +55,14 @@ func init() {
 	Register("nolog", nolog)
 	Register("pass", pass)
 	Register("phase", phase)
+	Register("prepend", prependContent)
 	Register("redirect", redirect)
 	Register("rev", rev)
+	Register("sanitiseArg", sanitiseArg)
+	Register("sanitiseMatched", sanitiseMatched)
+	Register("sanitiseMatchedBytes", sanitiseMatchedBytes)
+	Register("sanitiseRequestHeader", sanitiseRequestHeader)
+	Register("sanitiseResponseHeader", sanitiseResponseHeader)
 	Register("setenv", setenv)
 	Register("setvar", setvar)
 	Register("severity", severity)
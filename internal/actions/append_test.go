@@ -0,0 +1,58 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package actions
+
+import (
+	"testing"
+
+	"github.com/corazawaf/coraza/v3/experimental/plugins/plugintypes"
+	"github.com/corazawaf/coraza/v3/internal/corazawaf"
+)
+
+func TestAppendAndPrepend(t *testing.T) {
+	for name, a := range map[string]func() plugintypes.Action{"append": appendContent, "prepend": prependContent} {
+		t.Run(name, func(t *testing.T) {
+			if err := a().Init(nil, ""); err != ErrMissingArguments {
+				t.Errorf("expected error ErrMissingArguments, got %v", err)
+			}
+		})
+	}
+
+	waf := corazawaf.NewWAF()
+	waf.ResponseBodyAccess = true
+	waf.ResponseBodyMimeTypes = []string{"text/html"}
+	waf.ContentInjection = true
+	tx := waf.NewTransaction()
+	defer tx.Close()
+	tx.Variables().TX().Set("name", []string{"coraza"})
+
+	p := prependContent()
+	if err := p.Init(nil, "<h1>%{tx.name}</h1>"); err != nil {
+		t.Fatal(err)
+	}
+	ap := appendContent()
+	if err := ap.Init(nil, "<footer/>"); err != nil {
+		t.Fatal(err)
+	}
+
+	tx.ProcessRequestHeaders()
+	if _, err := tx.ProcessRequestBody(); err != nil {
+		t.Fatal(err)
+	}
+	tx.AddResponseHeader("Content-Type", "text/html")
+	tx.ProcessResponseHeaders(200, "HTTP/1.1")
+	if _, _, err := tx.WriteResponseBody([]byte("<p>body</p>")); err != nil {
+		t.Fatal(err)
+	}
+	p.Evaluate(nil, tx)
+	ap.Evaluate(nil, tx)
+	if _, err := tx.ProcessResponseBody(); err != nil {
+		t.Fatal(err)
+	}
+
+	body, _ := tx.ModifiedResponseBody()
+	if want, have := "<h1>coraza</h1><p>body</p><footer/>", string(body); want != have {
+		t.Errorf("unexpected body, want %q, have %q", want, have)
+	}
+}
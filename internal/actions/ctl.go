@@ -13,7 +13,6 @@ import (
 	"github.com/corazawaf/coraza/v3/experimental/plugins/plugintypes"
 	"github.com/corazawaf/coraza/v3/internal/collections"
 	"github.com/corazawaf/coraza/v3/internal/corazawaf"
-	utils "github.com/corazawaf/coraza/v3/internal/strings"
 	"github.com/corazawaf/coraza/v3/types"
 	"github.com/corazawaf/coraza/v3/types/variables"
 )
@@ -68,8 +67,8 @@ const (
 // - `ruleRemoveTargetById`
 // - `ruleRemoveTargetByMsg`
 // - `ruleRemoveTargetByTag`
-// - `hashEngine` (**Not Supported in Coraza (TBI)**)
-// - `hashEnforcement` (**Not supported in Coraza (TBI)**)
+// - `hashEngine`
+// - `hashEnforcement`
 //
 // Here are some notes about the options:
 //
@@ -89,6 +88,15 @@ const (
 //  4. Option `forceRequestBodyVariable“ allows you to configure the `REQUEST_BODY` variable to be set when there is no request body processor configured.
 //     This allows for inspection of request bodies of unknown types.
 //
+//  5. Options `ruleRemoveBy*` and `ruleRemoveTargetBy*` select the rules like `SecRuleRemoveById`: IDs and ranges,
+//     tags and messages matched exactly or by the regular expression enclosed in slashes, and combinations of them
+//     separated by `&`, e.g. `ctl:ruleRemoveByTag=/^attack-(sqli|xss)$/&id=942000-942999`. Messages without
+//     any `field=` or regex condition are matched exactly as a whole, `&` included. Invalid selectors are
+//     reported when the rule is loaded.
+//
+//  6. Option `hashEngine` enables or disables the signing of links and the `@validateHash` operator for the transaction,
+//     it requires a key configured with `SecHashKey`. Option `hashEnforcement` only toggles the `@validateHash` operator.
+//
 // Example:
 // ```
 // # Parse requests with Content-Type "text/xml" as XML
@@ -105,12 +113,28 @@ type ctlFn struct {
 	value      string
 	collection variables.RuleVariable
 	colKey     string
+	// selector selects the rules of the ruleRemove* options
+	selector *corazawaf.RuleSelector
 }
 
 func (a *ctlFn) Init(_ plugintypes.RuleMetadata, data string) error {
 	var err error
 	a.action, a.value, a.collection, a.colKey, err = parseCtl(data)
-	return err
+	if err != nil {
+		return err
+	}
+	switch a.action {
+	case ctlRuleRemoveByID, ctlRuleRemoveTargetByID:
+		a.selector, err = corazawaf.ParseRuleSelector(corazawaf.RuleSelectorID, a.value)
+	case ctlRuleRemoveByTag, ctlRuleRemoveTargetByTag:
+		a.selector, err = corazawaf.ParseRuleSelector(corazawaf.RuleSelectorTag, a.value)
+	case ctlRuleRemoveByMsg, ctlRuleRemoveTargetByMsg:
+		a.selector, err = corazawaf.ParseRuleSelector(corazawaf.RuleSelectorMsg, a.value)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid rule selector %q: %w", a.value, err)
+	}
+	return nil
 }
 
 // parseOnOff turns a string value into a boolean equivalent on/off into true/false
@@ -129,32 +153,10 @@ func parseOnOff(s string) (bool, bool) {
 func (a *ctlFn) Evaluate(_ plugintypes.RuleMetadata, txS plugintypes.TransactionState) {
 	tx := txS.(*corazawaf.Transaction)
 	switch a.action {
-	case ctlRuleRemoveTargetByID:
-		ran, err := rangeToInts(tx.WAF.Rules.GetRules(), a.value)
-		if err != nil {
-			tx.DebugLogger().Error().
-				Str("ctl", "RuleRemoveTargetByID").
-				Err(err).
-				Msg("Invalid range")
-			return
-		}
-		for _, id := range ran {
+	case ctlRuleRemoveTargetByID, ctlRuleRemoveTargetByTag, ctlRuleRemoveTargetByMsg:
+		for _, id := range ruleIDs(tx.Rules().GetRules(), a.selector) {
 			tx.RemoveRuleTargetByID(id, a.collection, a.colKey)
 		}
-	case ctlRuleRemoveTargetByTag:
-		rules := tx.WAF.Rules.GetRules()
-		for _, r := range rules {
-			if utils.InSlice(a.value, r.Tags_) {
-				tx.RemoveRuleTargetByID(r.ID(), a.collection, a.colKey)
-			}
-		}
-	case ctlRuleRemoveTargetByMsg:
-		rules := tx.WAF.Rules.GetRules()
-		for _, r := range rules {
-			if r.Msg != nil && r.Msg.String() == a.value {
-				tx.RemoveRuleTargetByID(r.ID(), a.collection, a.colKey)
-			}
-		}
 	case ctlAuditEngine:
 		ae, err := types.ParseAuditEngineStatus(a.value)
 		if err != nil {
@@ -247,44 +249,17 @@ func (a *ctlFn) Evaluate(_ plugintypes.RuleMetadata, txS plugintypes.Transaction
 		}
 		tx.RuleEngine = re
 	case ctlRuleRemoveByID:
-		if idx := strings.Index(a.value, "-"); idx == -1 {
-			id, err := strconv.Atoi(a.value)
-			if err != nil {
-				tx.DebugLogger().Error().
-					Str("ctl", "RuleRemoveByID").
-					Str("value", a.value).
-					Err(err).
-					Msg("Invalid rule ID")
-				return
-			}
-
+		if id, ok := a.selector.ID(); ok {
+			// rules are skipped by ID, there is no need to look for the rule
 			tx.RemoveRuleByID(id)
-		} else {
-			ran, err := rangeToInts(tx.WAF.Rules.GetRules(), a.value)
-			if err != nil {
-				tx.DebugLogger().Error().
-					Str("ctl", "RuleRemoveByID").
-					Err(err).
-					Msg("Invalid range")
-				return
-			}
-			for _, id := range ran {
-				tx.RemoveRuleByID(id)
-			}
+			return
 		}
-	case ctlRuleRemoveByMsg:
-		rules := tx.WAF.Rules.GetRules()
-		for _, r := range rules {
-			if r.Msg != nil && r.Msg.String() == a.value {
-				tx.RemoveRuleByID(r.ID_)
-			}
+		for _, id := range ruleIDs(tx.Rules().GetRules(), a.selector) {
+			tx.RemoveRuleByID(id)
 		}
-	case ctlRuleRemoveByTag:
-		rules := tx.WAF.Rules.GetRules()
-		for _, r := range rules {
-			if utils.InSlice(a.value, r.Tags_) {
-				tx.RemoveRuleByID(r.ID_)
-			}
+	case ctlRuleRemoveByMsg, ctlRuleRemoveByTag:
+		for _, id := range ruleIDs(tx.Rules().GetRules(), a.selector) {
+			tx.RemoveRuleByID(id)
 		}
 
 	case ctlResponseBodyAccess:
@@ -353,9 +328,31 @@ func (a *ctlFn) Evaluate(_ plugintypes.RuleMetadata, txS plugintypes.Transaction
 			return
 		}
 	case ctlHashEngine:
-		// Not supported yet
+		val, ok := parseOnOff(a.value)
+		if !ok {
+			tx.DebugLogger().Error().
+				Str("ctl", "HashEngine").
+				Str("value", a.value).
+				Msg("Unknown toggle")
+			return
+		}
+		if val && len(tx.WAF.HashKey) == 0 {
+			tx.DebugLogger().Error().
+				Str("ctl", "HashEngine").
+				Msg("Cannot enable the hash engine without a hash key")
+			return
+		}
+		tx.HashEngine = val
 	case ctlHashEnforcement:
-		// Not supported yet
+		val, ok := parseOnOff(a.value)
+		if !ok {
+			tx.DebugLogger().Error().
+				Str("ctl", "HashEnforcement").
+				Str("value", a.value).
+				Msg("Unknown toggle")
+			return
+		}
+		tx.HashEnforcement = val
 	case ctlDebugLogLevel:
 		lvl, err := strconv.ParseInt(a.value, 10, 8)
 		if err != nil {
@@ -435,44 +432,15 @@ func parseCtl(data string) (ctlFunctionType, string, variables.RuleVariable, str
 	return act, value, collection, strings.TrimSpace(colkey), nil
 }
 
-func rangeToInts(rules []corazawaf.Rule, input string) ([]int, error) {
-	if len(input) == 0 {
-		return nil, errors.New("empty input")
-	}
-
-	var (
-		ids        []int
-		start, end int
-		err        error
-	)
-
-	if in0, in1, ok := strings.Cut(input, "-"); ok {
-		start, err = strconv.Atoi(in0)
-		if err != nil {
-			return nil, err
-		}
-		end, err = strconv.Atoi(in1)
-		if err != nil {
-			return nil, err
-		}
-
-		if start > end {
-			return nil, errors.New("invalid range, start > end")
-		}
-	} else {
-		id, err := strconv.Atoi(input)
-		if err != nil {
-			return nil, err
-		}
-		start, end = id, id
-	}
-
-	for _, r := range rules {
-		if r.ID_ >= start && r.ID_ <= end {
-			ids = append(ids, r.ID_)
+// ruleIDs returns the IDs of the rules matched by the selector
+func ruleIDs(rules []corazawaf.Rule, selector *corazawaf.RuleSelector) []int {
+	var ids []int
+	for i := range rules {
+		if selector.Matches(&rules[i]) {
+			ids = append(ids, rules[i].ID_)
 		}
 	}
-	return ids, nil
+	return ids
 }
 
 func ctl() plugintypes.Action {
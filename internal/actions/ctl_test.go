@@ -18,6 +18,7 @@ import (
 func TestCtl(t *testing.T) {
 	tests := map[string]struct {
 		input     string
+		initErr   bool
 		prepareTX func(tx *corazawaf.Transaction)
 		checkTX   func(t *testing.T, tx *corazawaf.Transaction, logEntry string)
 	}{
@@ -175,20 +176,12 @@ func TestCtl(t *testing.T) {
 			input: "ruleRemoveById=1-3",
 		},
 		"ruleRemoveById incorrect": {
-			input: "ruleRemoveById=W",
-			checkTX: func(t *testing.T, tx *corazawaf.Transaction, logEntry string) {
-				if wantToContain, have := "[ERROR] Invalid rule ID", logEntry; !strings.Contains(have, wantToContain) {
-					t.Errorf("Failed to log entry, want to contain %q, have %q", wantToContain, have)
-				}
-			},
+			input:   "ruleRemoveById=W",
+			initErr: true,
 		},
 		"ruleRemoveById range incorrect": {
-			input: "ruleRemoveById=a-2",
-			checkTX: func(t *testing.T, tx *corazawaf.Transaction, logEntry string) {
-				if wantToContain, have := "[ERROR] Invalid range", logEntry; !strings.Contains(have, wantToContain) {
-					t.Errorf("Failed to log entry, want to contain %q, have %q", wantToContain, have)
-				}
-			},
+			input:   "ruleRemoveById=a-2",
+			initErr: true,
 		},
 		"ruleRemoveByMsg": {
 			input: "ruleRemoveByMsg=somethingWentWrong",
@@ -196,6 +189,17 @@ func TestCtl(t *testing.T) {
 		"ruleRemoveByTag": {
 			input: "ruleRemoveByTag=tag1",
 		},
+		"ruleRemoveByTag regex": {
+			input: "ruleRemoveByTag=/^tag[0-9]$/&id=1-100",
+		},
+		"ruleRemoveByTag incorrect": {
+			input:   "ruleRemoveByTag=/[a-/",
+			initErr: true,
+		},
+		"ruleRemoveTargetByMsg incorrect": {
+			input:   "ruleRemoveTargetByMsg=msg&id=x;ARGS:user",
+			initErr: true,
+		},
 		"requestBodyProcessor": {
 			input: "requestBodyProcessor=XML",
 			checkTX: func(t *testing.T, tx *corazawaf.Transaction, logEntry string) {
@@ -272,6 +276,36 @@ func TestCtl(t *testing.T) {
 				}
 			},
 		},
+		"hashEngine without key": {
+			input: "hashEngine=On",
+			checkTX: func(t *testing.T, tx *corazawaf.Transaction, logEntry string) {
+				if wantToContain, have := "[ERROR] Cannot enable the hash engine without a hash key", logEntry; !strings.Contains(have, wantToContain) {
+					t.Errorf("Failed to log entry, want to contain %q, have %q", wantToContain, have)
+				}
+				if tx.HashEngine {
+					t.Error("Unexpected hash engine enabled")
+				}
+			},
+		},
+		"hashEngine successfully": {
+			input: "hashEngine=On",
+			prepareTX: func(tx *corazawaf.Transaction) {
+				tx.WAF.HashKey = []byte("key")
+			},
+			checkTX: func(t *testing.T, tx *corazawaf.Transaction, logEntry string) {
+				if want, have := true, tx.HashEngine; want != have {
+					t.Errorf("Failed to set hashEngine, want %t, have %t", want, have)
+				}
+			},
+		},
+		"hashEnforcement successfully": {
+			input: "hashEnforcement=On",
+			checkTX: func(t *testing.T, tx *corazawaf.Transaction, logEntry string) {
+				if want, have := true, tx.HashEnforcement; want != have {
+					t.Errorf("Failed to set hashEnforcement, want %t, have %t", want, have)
+				}
+			},
+		},
 		"responseBodyProcessor successfully": {
 			input: "responseBodyProcessor=XML",
 			checkTX: func(t *testing.T, tx *corazawaf.Transaction, logEntry string) {
@@ -343,7 +377,14 @@ func TestCtl(t *testing.T) {
 			}
 
 			a := ctl()
-			if err := a.Init(r, test.input); err != nil {
+			err = a.Init(r, test.input)
+			if test.initErr {
+				if err == nil {
+					t.Fatal("expected error when initializing ctl")
+				}
+				return
+			}
+			if err != nil {
 				t.Fatalf("failed to init ctl: %s", err.Error())
 			}
 
@@ -469,7 +510,7 @@ func TestCtlParseRange(t *testing.T) {
 	}
 	for _, tCase := range tCases {
 		t.Run(tCase._range, func(t *testing.T) {
-			ints, err := rangeToInts(rules, tCase._range)
+			selector, err := corazawaf.ParseRuleSelector(corazawaf.RuleSelectorID, tCase._range)
 			if tCase.expectErr && err == nil {
 				t.Error("expected error for range")
 			}
@@ -478,7 +519,7 @@ func TestCtlParseRange(t *testing.T) {
 				t.Errorf("unexpected error for range: %s", err.Error())
 			}
 
-			if !tCase.expectErr && len(ints) != tCase.expectedNumberOfIds {
+			if !tCase.expectErr && len(ruleIDs(rules, selector)) != tCase.expectedNumberOfIds {
 				t.Error("unexpected number of ids")
 			}
 		})
@@ -12,6 +12,7 @@ import (
 //
 // Description:
 // > This action depends on each implementation, the server is instructed to drop the connection.
+// > The `net/http` middleware hijacks and closes HTTP/1.x connections and resets HTTP/2 streams.
 //
 // Initiates an immediate close of the TCP connection by sending a FIN packet.
 // This action is extremely useful when responding to both Brute Force and Denial of Service attacks,
@@ -4,41 +4,120 @@
 package actions
 
 import (
+	"fmt"
+	"strings"
+
 	"github.com/corazawaf/coraza/v3/experimental/plugins/plugintypes"
+	"github.com/corazawaf/coraza/v3/internal/corazawaf"
 )
 
+// execPoolSize bounds the number of asynchronous exec callbacks running at the
+// same time, the callbacks triggered while the pool is full are dropped.
+const execPoolSize = 16
+
+var execPool = make(chan struct{}, execPoolSize)
+
+type execCallback struct {
+	fn    plugintypes.ExecCallback
+	async plugintypes.AsyncExecCallback
+}
+
+var execCallbacks = map[string]execCallback{}
+
+// RegisterExecCallback registers a function run synchronously by the exec action.
+// If you register a callback with an existing name, it will be overwritten.
+func RegisterExecCallback(name string, fn plugintypes.ExecCallback) {
+	execCallbacks[strings.ToLower(name)] = execCallback{fn: fn}
+}
+
+// RegisterAsyncExecCallback registers a function run in background by the exec action,
+// with a snapshot of the transaction. The callbacks triggered while execPoolSize of them
+// are running are dropped and logged as errors by the WAF logger, as are their panics.
+// If you register a callback with an existing name, it will be overwritten.
+func RegisterAsyncExecCallback(name string, fn plugintypes.AsyncExecCallback) {
+	execCallbacks[strings.ToLower(name)] = execCallback{async: fn}
+}
+
 // Action Group: Non-disruptive
 //
 // Description:
-// Executes an external script/binary supplied as parameter.
+// Executes the Go function registered with the name supplied as parameter, see
+// `plugins.RegisterExecCallback`. The function receives the transaction and the
+// metadata of the rule, which allows triggering custom alerting or ticketing.
 // The `exec` action is executed independently from any disruptive actions specified.
-// External scripts will always be called with no parameters.
-// Some transaction information will be placed in environment variables.
-// All the usual CGI environment variables will be there.
-// You should be aware that forking a threaded process results in all threads being replicated in the new process.
-// Forking can therefore incur larger overhead in a multithreaded deployment.
+// Functions registered as asynchronous run in background with a snapshot of the
+// transaction and do not delay its processing. At most 16 of them run at the same time,
+// the following ones are dropped, and logged as errors, until one returns. Their panics
+// are recovered and logged as errors.
 //
-// > The script you execute must write something (anything) to stdout,
-// > if it doesn’t, Coraza will assume that the script failed, and will record the failure.
+// > Unlike ModSecurity, external scripts and binaries are not supported. Using a name
+// > that has not been registered is an error when loading the rules.
 //
 // Example:
 // ```
-// # Run external program on rule match
-// SecRule REQUEST_URI "^/cgi-bin/script\.pl" "phase:2,id:112,t:none,t:lowercase,t:normalizePath,block,\ exec:/usr/local/apache/bin/test.sh"
-//
-// # Run Lua script on rule match
-// SecRule ARGS:p attack "phase:2,id:113,block,exec:/usr/local/apache/conf/exec.lua"
+// # Open a ticket on rule match
+// SecRule REQUEST_URI "^/admin" "phase:1,id:112,t:none,t:lowercase,block,exec:openTicket"
 // ```
-type execFn struct{}
+type execFn struct {
+	name     string
+	callback execCallback
+}
 
 func (a *execFn) Init(_ plugintypes.RuleMetadata, data string) error {
-	if len(data) > 0 {
-		return ErrUnexpectedArguments
+	if len(data) == 0 {
+		return ErrMissingArguments
 	}
+
+	cb, ok := execCallbacks[strings.ToLower(data)]
+	if !ok {
+		return fmt.Errorf("exec callback %q is not registered", data)
+	}
+	a.name = data
+	a.callback = cb
 	return nil
 }
 
-func (a *execFn) Evaluate(_ plugintypes.RuleMetadata, _ plugintypes.TransactionState) {}
+func (a *execFn) Evaluate(r plugintypes.RuleMetadata, tx plugintypes.TransactionState) {
+	if a.callback.async == nil {
+		a.callback.fn(tx, r)
+		return
+	}
+
+	logger := tx.(*corazawaf.Transaction).WAF.Logger
+	select {
+	case execPool <- struct{}{}:
+	default:
+		logger.Error().
+			Str("tx_id", tx.ID()).
+			Str("callback", a.name).
+			Int("rule_id", r.ID()).
+			Msg("Dropping the exec callback, too many callbacks are running")
+		return
+	}
+	// the callback runs concurrently with the transaction, it only gets copies of its values
+	event := plugintypes.ExecEvent{
+		TransactionID: tx.ID(),
+		ClientIP:      tx.Variables().RemoteAddr().Get(),
+		URI:           tx.Variables().RequestURI().Get(),
+		Rule:          r,
+		MatchedVars:   tx.Variables().MatchedVars().FindAll(),
+	}
+	go func() {
+		defer func() { <-execPool }()
+		// a panicking callback must not bring the whole process down
+		defer func() {
+			if v := recover(); v != nil {
+				logger.Error().
+					Str("tx_id", event.TransactionID).
+					Str("callback", a.name).
+					Int("rule_id", r.ID()).
+					Err(fmt.Errorf("%v", v)).
+					Msg("Exec callback panicked")
+			}
+		}()
+		a.callback.async(event)
+	}()
+}
 
 func (a *execFn) Type() plugintypes.ActionType {
 	return plugintypes.ActionTypeNondisruptive
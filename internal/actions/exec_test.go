@@ -3,20 +3,146 @@
 
 package actions
 
-import "testing"
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/corazawaf/coraza/v3/debuglog"
+	"github.com/corazawaf/coraza/v3/experimental/plugins/plugintypes"
+	"github.com/corazawaf/coraza/v3/internal/corazawaf"
+)
+
+// chanWriter sends every log entry to a channel, as they are written by the callbacks
+type chanWriter chan string
+
+func (w chanWriter) Write(p []byte) (int, error) {
+	w <- string(p)
+	return len(p), nil
+}
 
 func TestExecInit(t *testing.T) {
+	RegisterExecCallback("noop", func(plugintypes.TransactionState, plugintypes.RuleMetadata) {})
+
 	t.Run("no arguments", func(t *testing.T) {
 		a := exec()
-		if err := a.Init(nil, ""); err != nil {
+		if err := a.Init(nil, ""); err != ErrMissingArguments {
+			t.Error("expected error ErrMissingArguments")
+		}
+	})
+
+	t.Run("unregistered callback", func(t *testing.T) {
+		a := exec()
+		if err := a.Init(nil, "/usr/local/apache/bin/test.sh"); err == nil {
+			t.Error("expected error for unregistered callback")
+		}
+	})
+
+	t.Run("registered callback", func(t *testing.T) {
+		a := exec()
+		if err := a.Init(nil, "NoOp"); err != nil {
 			t.Error(err)
 		}
 	})
+}
+
+func TestExecEvaluate(t *testing.T) {
+	t.Run("sync", func(t *testing.T) {
+		RegisterExecCallback("settx", func(tx plugintypes.TransactionState, r plugintypes.RuleMetadata) {
+			tx.Variables().TX().Set("ticket", []string{"rule-" + strconv.Itoa(r.ID())})
+		})
+
+		a := exec()
+		if err := a.Init(nil, "settx"); err != nil {
+			t.Fatal(err)
+		}
+		tx := corazawaf.NewWAF().NewTransaction()
+		defer tx.Close()
+		r := corazawaf.NewRule()
+		r.ID_ = 1
+		a.Evaluate(r, tx)
+
+		if want, have := "rule-1", tx.Variables().TX().Get("ticket"); len(have) != 1 || want != have[0] {
+			t.Errorf("unexpected TX variable, want %q, have %v", want, have)
+		}
+	})
+
+	t.Run("async", func(t *testing.T) {
+		release := make(chan struct{})
+		events := make(chan plugintypes.ExecEvent, 2*execPoolSize)
+		RegisterAsyncExecCallback("block", func(e plugintypes.ExecEvent) {
+			<-release
+			events <- e
+		})
+
+		a := exec()
+		if err := a.Init(nil, "block"); err != nil {
+			t.Fatal(err)
+		}
+		logs := &bytes.Buffer{}
+		waf := corazawaf.NewWAF()
+		waf.Logger = debuglog.Default().WithLevel(debuglog.LevelError).WithOutput(logs)
+		tx := waf.NewTransaction()
+		tx.Variables().MatchedVars().Set("ARGS:id", []string{"1"})
+		r := corazawaf.NewRule()
+		r.ID_ = 1
+		// the callbacks exceeding the pool are dropped instead of blocking the transaction
+		for i := 0; i < 2*execPoolSize; i++ {
+			a.Evaluate(r, tx)
+		}
+		if want, have := "[ERROR] Dropping the exec callback", logs.String(); !strings.Contains(have, want) {
+			t.Errorf("expected the dropped callbacks to be logged, want %q, have %q", want, have)
+		}
+		// the transaction doesn't wait for the callbacks
+		if err := tx.Close(); err != nil {
+			t.Fatal(err)
+		}
+		close(release)
+
+		for i := 0; i < execPoolSize; i++ {
+			e := <-events
+			if e.Rule.ID() != 1 || e.TransactionID == "" || len(e.MatchedVars) != 1 || e.MatchedVars[0].Value() != "1" {
+				t.Errorf("unexpected event %+v", e)
+			}
+		}
+		select {
+		case e := <-events:
+			t.Errorf("unexpected event exceeding the pool %+v", e)
+		case <-time.After(10 * time.Millisecond):
+		}
+	})
+
+	t.Run("async panic", func(t *testing.T) {
+		RegisterAsyncExecCallback("panic", func(plugintypes.ExecEvent) {
+			panic("boom")
+		})
 
-	t.Run("unexpected arguments", func(t *testing.T) {
 		a := exec()
-		if err := a.Init(nil, "abc"); err == nil || err != ErrUnexpectedArguments {
-			t.Error("expected error ErrUnexpectedArguments")
+		if err := a.Init(nil, "panic"); err != nil {
+			t.Fatal(err)
+		}
+		logs := make(chanWriter, 1)
+		waf := corazawaf.NewWAF()
+		waf.Logger = debuglog.Default().WithLevel(debuglog.LevelError).WithOutput(logs)
+		tx := waf.NewTransaction()
+		defer tx.Close()
+		r := corazawaf.NewRule()
+		r.ID_ = 1
+		// the callbacks of the previous tests may still be releasing their slot
+		for deadline := time.Now().Add(time.Second); len(execPool) > 0 && time.Now().Before(deadline); {
+			time.Sleep(time.Millisecond)
+		}
+		a.Evaluate(r, tx)
+
+		select {
+		case have := <-logs:
+			if want := "Exec callback panicked"; !strings.Contains(have, want) || !strings.Contains(have, "boom") {
+				t.Errorf("unexpected log entry, want to contain %q, have %q", want, have)
+			}
+		case <-time.After(time.Second):
+			t.Error("expected the panic to be logged")
 		}
 	})
 }
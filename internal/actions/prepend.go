@@ -0,0 +1,58 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package actions
+
+import (
+	"github.com/corazawaf/coraza/v3/experimental/plugins/macro"
+	"github.com/corazawaf/coraza/v3/experimental/plugins/plugintypes"
+	"github.com/corazawaf/coraza/v3/internal/corazawaf"
+)
+
+// Action Group: Non-disruptive
+//
+// Description:
+// Injects the text given as parameter at the beginning of the response body.
+// Content injection must be enabled using the `SecContentInjection` directive and the
+// response body must be accessible. The parameter supports macro expansion.
+// No content type checks are made, which means that before using any of the content
+// injection actions, you must check whether the content type of the response is adequate
+// for injection.
+//
+// Example:
+// ```
+// SecRule RESPONSE_CONTENT_TYPE "^text/html" "nolog,id:99,phase:3,pass,prepend:'Header<br>'"
+// ```
+type prependFn struct {
+	data macro.Macro
+}
+
+func (a *prependFn) Init(_ plugintypes.RuleMetadata, data string) error {
+	if len(data) == 0 {
+		return ErrMissingArguments
+	}
+
+	m, err := macro.NewMacro(data)
+	if err != nil {
+		return err
+	}
+	a.data = m
+	return nil
+}
+
+func (a *prependFn) Evaluate(_ plugintypes.RuleMetadata, tx plugintypes.TransactionState) {
+	tx.(*corazawaf.Transaction).PrependResponseBody(a.data.Expand(tx))
+}
+
+func (a *prependFn) Type() plugintypes.ActionType {
+	return plugintypes.ActionTypeNondisruptive
+}
+
+func prependContent() plugintypes.Action {
+	return &prependFn{}
+}
+
+var (
+	_ plugintypes.Action = &prependFn{}
+	_ ruleActionWrapper  = prependContent
+)
@@ -0,0 +1,59 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package actions
+
+import (
+	"github.com/corazawaf/coraza/v3/experimental/plugins/macro"
+	"github.com/corazawaf/coraza/v3/experimental/plugins/plugintypes"
+	"github.com/corazawaf/coraza/v3/internal/corazawaf"
+)
+
+// Action Group: Non-disruptive
+//
+// Description:
+// Prevents sensitive request parameter data from being logged to the audit log.
+// Each byte of the named parameter(s) is replaced with an asterisk, in the request line,
+// the request body, the arguments and the rules matched data of every audit log format.
+// Values shorter than 4 bytes are only masked in the request line, urlencoded request
+// bodies and the arguments, as they cannot be told apart from the rest of the log.
+// The argument name is case insensitive and supports macro expansion.
+//
+// Example:
+// ```
+// # Never log passwords
+// SecAction "nolog,phase:2,id:155,sanitiseArg:password,sanitiseArg:newPassword,sanitiseArg:oldPassword"
+// ```
+type sanitiseArgFn struct {
+	name macro.Macro
+}
+
+func (a *sanitiseArgFn) Init(_ plugintypes.RuleMetadata, data string) error {
+	if len(data) == 0 {
+		return ErrMissingArguments
+	}
+
+	m, err := macro.NewMacro(data)
+	if err != nil {
+		return err
+	}
+	a.name = m
+	return nil
+}
+
+func (a *sanitiseArgFn) Evaluate(_ plugintypes.RuleMetadata, tx plugintypes.TransactionState) {
+	tx.(*corazawaf.Transaction).SanitiseArg(a.name.Expand(tx))
+}
+
+func (a *sanitiseArgFn) Type() plugintypes.ActionType {
+	return plugintypes.ActionTypeNondisruptive
+}
+
+func sanitiseArg() plugintypes.Action {
+	return &sanitiseArgFn{}
+}
+
+var (
+	_ plugintypes.Action = &sanitiseArgFn{}
+	_ ruleActionWrapper  = sanitiseArg
+)
@@ -0,0 +1,38 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package actions
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/corazawaf/coraza/v3/internal/corazawaf"
+	"github.com/corazawaf/coraza/v3/types"
+)
+
+func TestSanitiseArg(t *testing.T) {
+	t.Run("missing arguments", func(t *testing.T) {
+		if err := sanitiseArg().Init(nil, ""); err != ErrMissingArguments {
+			t.Errorf("expected error ErrMissingArguments, got %v", err)
+		}
+	})
+
+	t.Run("masks the argument", func(t *testing.T) {
+		a := sanitiseArg()
+		if err := a.Init(nil, "%{tx.arg}"); err != nil {
+			t.Fatal(err)
+		}
+
+		tx := corazawaf.NewWAF().NewTransaction()
+		defer tx.Close()
+		tx.AuditLogParts = types.AuditLogParts("B")
+		tx.Variables().TX().Set("arg", []string{"password"})
+		tx.ProcessURI("/?password=s3cret", "GET", "HTTP/1.1")
+		a.Evaluate(nil, tx)
+
+		if uri := tx.AuditLog().Transaction().Request().URI(); strings.Contains(uri, "s3cret") {
+			t.Errorf("unexpected argument value in %q", uri)
+		}
+	})
+}
@@ -0,0 +1,49 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package actions
+
+import (
+	"github.com/corazawaf/coraza/v3/experimental/plugins/plugintypes"
+	"github.com/corazawaf/coraza/v3/internal/corazawaf"
+)
+
+// Action Group: Non-disruptive
+//
+// Description:
+// Prevents the variable that caused a rule match from being logged to the audit log.
+// Matched arguments, request headers and response headers are masked by name as done by
+// `sanitiseArg`, `sanitiseRequestHeader` and `sanitiseResponseHeader`. The matched value
+// is also masked wherever it is found in the audit log, which covers the other variables,
+// unless it is shorter than 4 bytes.
+//
+// Example:
+// ```
+// # Do not log the arguments looking like card numbers
+// SecRule ARGS "@rx ^\d{13,16}$" "phase:2,id:159,log,pass,sanitiseMatched"
+// ```
+type sanitiseMatchedFn struct{}
+
+func (a *sanitiseMatchedFn) Init(_ plugintypes.RuleMetadata, data string) error {
+	if len(data) > 0 {
+		return ErrUnexpectedArguments
+	}
+	return nil
+}
+
+func (a *sanitiseMatchedFn) Evaluate(_ plugintypes.RuleMetadata, tx plugintypes.TransactionState) {
+	tx.(*corazawaf.Transaction).SanitiseMatched()
+}
+
+func (a *sanitiseMatchedFn) Type() plugintypes.ActionType {
+	return plugintypes.ActionTypeNondisruptive
+}
+
+func sanitiseMatched() plugintypes.Action {
+	return &sanitiseMatchedFn{}
+}
+
+var (
+	_ plugintypes.Action = &sanitiseMatchedFn{}
+	_ ruleActionWrapper  = sanitiseMatched
+)
@@ -0,0 +1,68 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package actions
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/corazawaf/coraza/v3/experimental/plugins/plugintypes"
+	"github.com/corazawaf/coraza/v3/internal/corazawaf"
+)
+
+// Action Group: Non-disruptive
+//
+// Description:
+// Prevents the matched value from being logged to the audit log, wherever it is found.
+// Unlike `sanitiseMatched`, only the matched value is masked and not the whole variable.
+// The optional `n/m` argument keeps the `n` first and the `m` last bytes of the value
+// unmasked, values too short to keep them are fully masked. Values shorter than 4 bytes
+// are not masked, as they cannot be told apart from the rest of the log.
+//
+// Example:
+// ```
+// # Keep the last 4 digits of the card numbers
+// SecRule ARGS "@verifyCC \d{13,16}" "phase:2,id:160,log,pass,sanitiseMatchedBytes:0/4"
+// ```
+type sanitiseMatchedBytesFn struct {
+	keepStart int
+	keepEnd   int
+}
+
+func (a *sanitiseMatchedBytesFn) Init(_ plugintypes.RuleMetadata, data string) error {
+	if len(data) == 0 {
+		return nil
+	}
+
+	start, end, ok := strings.Cut(data, "/")
+	if !ok {
+		return fmt.Errorf("invalid argument %q, expected n/m", data)
+	}
+	var err error
+	if a.keepStart, err = strconv.Atoi(start); err != nil || a.keepStart < 0 {
+		return fmt.Errorf("invalid number of bytes to keep %q", start)
+	}
+	if a.keepEnd, err = strconv.Atoi(end); err != nil || a.keepEnd < 0 {
+		return fmt.Errorf("invalid number of bytes to keep %q", end)
+	}
+	return nil
+}
+
+func (a *sanitiseMatchedBytesFn) Evaluate(_ plugintypes.RuleMetadata, tx plugintypes.TransactionState) {
+	tx.(*corazawaf.Transaction).SanitiseMatchedBytes(a.keepStart, a.keepEnd)
+}
+
+func (a *sanitiseMatchedBytesFn) Type() plugintypes.ActionType {
+	return plugintypes.ActionTypeNondisruptive
+}
+
+func sanitiseMatchedBytes() plugintypes.Action {
+	return &sanitiseMatchedBytesFn{}
+}
+
+var (
+	_ plugintypes.Action = &sanitiseMatchedBytesFn{}
+	_ ruleActionWrapper  = sanitiseMatchedBytes
+)
@@ -0,0 +1,41 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package actions
+
+import (
+	"testing"
+)
+
+func TestSanitiseMatchedBytesInit(t *testing.T) {
+	tests := []struct {
+		data      string
+		keepStart int
+		keepEnd   int
+		wantErr   bool
+	}{
+		{"", 0, 0, false},
+		{"1/4", 1, 4, false},
+		{"0/4", 0, 4, false},
+		{"4", 0, 0, true},
+		{"a/4", 0, 0, true},
+		{"1/-4", 0, 0, true},
+	}
+
+	for _, tc := range tests {
+		a := sanitiseMatchedBytes().(*sanitiseMatchedBytesFn)
+		err := a.Init(nil, tc.data)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("expected error for %q", tc.data)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("unexpected error for %q: %v", tc.data, err)
+		}
+		if a.keepStart != tc.keepStart || a.keepEnd != tc.keepEnd {
+			t.Errorf("unexpected bytes to keep for %q: %d/%d", tc.data, a.keepStart, a.keepEnd)
+		}
+	}
+}
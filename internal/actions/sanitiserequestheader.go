@@ -0,0 +1,56 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package actions
+
+import (
+	"github.com/corazawaf/coraza/v3/experimental/plugins/macro"
+	"github.com/corazawaf/coraza/v3/experimental/plugins/plugintypes"
+	"github.com/corazawaf/coraza/v3/internal/corazawaf"
+)
+
+// Action Group: Non-disruptive
+//
+// Description:
+// Prevents a named request header from being logged to the audit log.
+// Each byte of the named request header is replaced with an asterisk, its value is also
+// masked in the rules matched data unless it is shorter than 4 bytes. The header name is case insensitive and supports
+// macro expansion.
+//
+// Example:
+// ```
+// SecAction "phase:1,nolog,pass,id:157,sanitiseRequestHeader:Authorization"
+// ```
+type sanitiseRequestHeaderFn struct {
+	name macro.Macro
+}
+
+func (a *sanitiseRequestHeaderFn) Init(_ plugintypes.RuleMetadata, data string) error {
+	if len(data) == 0 {
+		return ErrMissingArguments
+	}
+
+	m, err := macro.NewMacro(data)
+	if err != nil {
+		return err
+	}
+	a.name = m
+	return nil
+}
+
+func (a *sanitiseRequestHeaderFn) Evaluate(_ plugintypes.RuleMetadata, tx plugintypes.TransactionState) {
+	tx.(*corazawaf.Transaction).SanitiseRequestHeader(a.name.Expand(tx))
+}
+
+func (a *sanitiseRequestHeaderFn) Type() plugintypes.ActionType {
+	return plugintypes.ActionTypeNondisruptive
+}
+
+func sanitiseRequestHeader() plugintypes.Action {
+	return &sanitiseRequestHeaderFn{}
+}
+
+var (
+	_ plugintypes.Action = &sanitiseRequestHeaderFn{}
+	_ ruleActionWrapper  = sanitiseRequestHeader
+)
@@ -0,0 +1,56 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package actions
+
+import (
+	"github.com/corazawaf/coraza/v3/experimental/plugins/macro"
+	"github.com/corazawaf/coraza/v3/experimental/plugins/plugintypes"
+	"github.com/corazawaf/coraza/v3/internal/corazawaf"
+)
+
+// Action Group: Non-disruptive
+//
+// Description:
+// Prevents a named response header from being logged to the audit log.
+// Each byte of the named response header is replaced with an asterisk, its value is also
+// masked in the rules matched data unless it is shorter than 4 bytes. The header name is case insensitive and supports
+// macro expansion.
+//
+// Example:
+// ```
+// SecAction "phase:3,nolog,pass,id:158,sanitiseResponseHeader:Set-Cookie"
+// ```
+type sanitiseResponseHeaderFn struct {
+	name macro.Macro
+}
+
+func (a *sanitiseResponseHeaderFn) Init(_ plugintypes.RuleMetadata, data string) error {
+	if len(data) == 0 {
+		return ErrMissingArguments
+	}
+
+	m, err := macro.NewMacro(data)
+	if err != nil {
+		return err
+	}
+	a.name = m
+	return nil
+}
+
+func (a *sanitiseResponseHeaderFn) Evaluate(_ plugintypes.RuleMetadata, tx plugintypes.TransactionState) {
+	tx.(*corazawaf.Transaction).SanitiseResponseHeader(a.name.Expand(tx))
+}
+
+func (a *sanitiseResponseHeaderFn) Type() plugintypes.ActionType {
+	return plugintypes.ActionTypeNondisruptive
+}
+
+func sanitiseResponseHeader() plugintypes.Action {
+	return &sanitiseResponseHeaderFn{}
+}
+
+var (
+	_ plugintypes.Action = &sanitiseResponseHeaderFn{}
+	_ ruleActionWrapper  = sanitiseResponseHeader
+)
@@ -10,12 +10,17 @@ import (
 
 	"github.com/corazawaf/coraza/v3/experimental/plugins/macro"
 	"github.com/corazawaf/coraza/v3/experimental/plugins/plugintypes"
+	"github.com/corazawaf/coraza/v3/internal/corazawaf"
 )
 
 // Action Group: Non-disruptive
 //
 // Description:
 // Creates, removes, and updates environment variables that can be accessed by the implementation.
+// Variables are set in the ENV collection of the transaction, connectors can read them
+// through `experimental.TransactionWithEnv`. Unlike ModSecurity, the process environment
+// is left untouched unless enabled with `WAFConfig.WithProcessEnv`, as it is shared by
+// concurrent transactions.
 // > In a trained rule, the action will be executed when an individual rule matches (not the entire chain).
 //
 // Example:
@@ -60,7 +65,11 @@ func (a *setenvFn) Init(_ plugintypes.RuleMetadata, data string) error {
 
 func (a *setenvFn) Evaluate(r plugintypes.RuleMetadata, tx plugintypes.TransactionState) {
 	v := a.value.Expand(tx)
-	// set env variable
+	tx.Variables().Env().Set(a.key, []string{v})
+
+	if !tx.(*corazawaf.Transaction).WAF.ProcessEnv {
+		return
+	}
 	if err := os.Setenv(a.key, v); err != nil {
 		tx.DebugLogger().
 			Error().
@@ -68,9 +77,6 @@ func (a *setenvFn) Evaluate(r plugintypes.RuleMetadata, tx plugintypes.Transacti
 			Err(err).
 			Msg("Failed to set the env variable for rule")
 	}
-	// TODO is this ok?
-	tx.Variables().Env().Set(a.key, []string{v})
-
 }
 
 func (a *setenvFn) Type() plugintypes.ActionType {
@@ -0,0 +1,48 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package actions
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/corazawaf/coraza/v3/internal/corazawaf"
+)
+
+func TestSetenv(t *testing.T) {
+	t.Run("invalid arguments", func(t *testing.T) {
+		for _, data := range []string{"", "key", "=value", "key="} {
+			if err := setenv().Init(nil, data); err == nil {
+				t.Errorf("expected error for %q", data)
+			}
+		}
+	})
+
+	for _, processEnv := range []bool{false, true} {
+		t.Run(fmt.Sprintf("process env %t", processEnv), func(t *testing.T) {
+			const key = "CORAZA_SETENV_TEST"
+			defer os.Unsetenv(key)
+
+			a := setenv()
+			if err := a.Init(nil, key+"=%{tx.value}"); err != nil {
+				t.Fatal(err)
+			}
+
+			waf := corazawaf.NewWAF()
+			waf.ProcessEnv = processEnv
+			tx := waf.NewTransaction()
+			defer tx.Close()
+			tx.Variables().TX().Set("value", []string{"abc"})
+			a.Evaluate(corazawaf.NewRule(), tx)
+
+			if want, have := "abc", tx.Env()[key]; want != have {
+				t.Errorf("unexpected transaction env, want %q, have %q", want, have)
+			}
+			if _, have := os.LookupEnv(key); processEnv != have {
+				t.Errorf("unexpected process env, want %t, have %t", processEnv, have)
+			}
+		})
+	}
+}
@@ -203,6 +203,8 @@ type TransactionProducer struct {
 	RuleEngine_ string   `json:"rule_engine"`
 	Stopwatch_  string   `json:"stopwatch"`
 	Rulesets_   []string `json:"rulesets"`
+	// RulesPerformanceInfo_ lists the rules slower than SecRulePerfTime, e.g. "942100=1520"
+	RulesPerformanceInfo_ string `json:"rules_performance_info,omitempty"`
 }
 
 var _ plugintypes.AuditLogTransactionProducer = (*TransactionProducer)(nil)
@@ -255,6 +257,16 @@ func (tp *TransactionProducer) Rulesets() []string {
 	return tp.Rulesets_
 }
 
+// RulesPerformanceInfo returns the rules slower than SecRulePerfTime with their
+// evaluation time in microseconds
+func (tp *TransactionProducer) RulesPerformanceInfo() string {
+	if tp == nil {
+		return ""
+	}
+
+	return tp.RulesPerformanceInfo_
+}
+
 // TransactionRequest contains request specific
 // information
 type TransactionRequest struct {
@@ -32,6 +32,8 @@ type nativeFormatter struct{}
 
 type auditLogWithErrMesg interface{ ErrorMessage() string }
 
+type producerWithRulesPerformance interface{ RulesPerformanceInfo() string }
+
 func (nativeFormatter) Format(al plugintypes.AuditLog) ([]byte, error) {
 	if len(al.Parts()) == 0 {
 		return nil, nil
@@ -113,6 +115,10 @@ func (nativeFormatter) Format(al plugintypes.AuditLog) ([]byte, error) {
 			}
 
 			_, _ = fmt.Fprintf(&res, "\nStopwatch: %s\nResponse-Body-Transformed: %s\nProducer: %s\nServer: %s", "", "", "", "")
+			if p, ok := al.Transaction().Producer().(producerWithRulesPerformance); ok && p.RulesPerformanceInfo() != "" {
+				res.WriteString("\nRules-Performance-Info: ")
+				res.WriteString(p.RulesPerformanceInfo())
+			}
 		case types.AuditLogPartRulesMatched:
 			for _, alEntry := range al.Messages() {
 				res.WriteByte('\n')
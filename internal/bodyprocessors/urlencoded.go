@@ -23,7 +23,11 @@ func (*urlencodedBodyProcessor) ProcessRequest(reader io.Reader, v plugintypes.T
 	}
 
 	b := buf.String()
-	values := urlutil.ParseQuery(b, '&')
+	separator := options.ArgumentSeparator
+	if separator == 0 {
+		separator = '&'
+	}
+	values := urlutil.ParseQuery(b, separator)
 	argsCol := v.ArgsPost()
 	for k, vs := range values {
 		argsCol.Set(k, vs)
@@ -39,6 +39,11 @@ func (c *Persistent) Init(key string) {
 	c.collectionKey = key
 }
 
+// Key returns the key the collection was initialized with
+func (c *Persistent) Key() string {
+	return c.collectionKey
+}
+
 func (c *Persistent) Get(key string) []string {
 	res, _ := c.engine.Get(c.variable.Name(), c.collectionKey, key)
 	return []string{res}
@@ -37,3 +37,83 @@ func ParseCookies(rawCookies string) map[string][]string {
 	}
 	return cookies
 }
+
+// Format is the syntax of the Cookie header, set by SecCookieFormat
+type Format int
+
+const (
+	// FormatNetscape is the syntax of the version 0 cookies, name=value pairs separated by ";"
+	FormatNetscape Format = iota
+	// FormatRFC2965 is the syntax of the version 1 cookies of RFC 2965, see ParseCookiesRFC2965
+	FormatRFC2965
+)
+
+// Parse parses the cookies with the given format
+func Parse(rawCookies string, format Format) map[string][]string {
+	if format == FormatRFC2965 {
+		return ParseCookiesRFC2965(rawCookies)
+	}
+	return ParseCookies(rawCookies)
+}
+
+// ParseCookiesRFC2965 parses version 1 cookies, as defined by RFC 2965. The pairs are separated
+// by ";" or "," and the values may be quoted strings, which are unquoted. The text following
+// the closing quote, e.g. b in `id="a"b`, is kept in the value. The attributes, e.g.
+// $Version and $Path in `$Version="1"; id="a;b"; $Path="/"`, are returned as cookies, like
+// ModSecurity does, so that rules can inspect them.
+func ParseCookiesRFC2965(rawCookies string) map[string][]string {
+	cookies := make(map[string][]string)
+
+	rawCookies = textproto.TrimString(rawCookies)
+	for len(rawCookies) > 0 {
+		var name, val string
+		i := strings.IndexAny(rawCookies, "=;,")
+		switch {
+		case i == -1:
+			name, rawCookies = rawCookies, ""
+		case rawCookies[i] == '=':
+			name = rawCookies[:i]
+			val, rawCookies = readRFC2965Value(rawCookies[i+1:])
+		default:
+			name, rawCookies = rawCookies[:i], rawCookies[i+1:]
+		}
+		name = textproto.TrimString(name)
+		if name == "" {
+			continue
+		}
+		cookies[name] = append(cookies[name], val)
+	}
+	return cookies
+}
+
+// readRFC2965Value reads the value at the start of s, it returns the value and what follows
+// its separator
+func readRFC2965Value(s string) (string, string) {
+	s = textproto.TrimString(s)
+	if len(s) > 0 && s[0] == '"' {
+		var sb strings.Builder
+		for i := 1; i < len(s); i++ {
+			switch c := s[i]; {
+			case c == '\\' && i+1 < len(s):
+				i++
+				sb.WriteByte(s[i])
+			case c == '"':
+				// the text between the closing quote and the separator is kept in the
+				// value, as the backends may keep it too
+				rest, next := s[i+1:], ""
+				if j := strings.IndexAny(rest, ";,"); j != -1 {
+					rest, next = rest[:j], rest[j+1:]
+				}
+				sb.WriteString(strings.TrimRight(rest, " \t"))
+				return sb.String(), next
+			default:
+				sb.WriteByte(c)
+			}
+		}
+		// a quoted string not terminated is read as a token, quote included
+	}
+	if i := strings.IndexAny(s, ";,"); i != -1 {
+		return textproto.TrimString(s[:i]), s[i+1:]
+	}
+	return s, ""
+}
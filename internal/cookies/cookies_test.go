@@ -98,3 +98,65 @@ func TestParseCookies(t *testing.T) {
 		})
 	}
 }
+
+func TestParseCookiesRFC2965(t *testing.T) {
+	tests := []struct {
+		name       string
+		rawCookies string
+		want       map[string][]string
+	}{
+		{
+			name:       "EmptyString",
+			rawCookies: "  ",
+			want:       map[string][]string{},
+		},
+		{
+			name:       "SimpleCookie",
+			rawCookies: "test=test_value",
+			want:       map[string][]string{"test": {"test_value"}},
+		},
+		{
+			name:       "CommaSeparator",
+			rawCookies: "test1=value1, test2=value2;test3=value3",
+			want:       map[string][]string{"test1": {"value1"}, "test2": {"value2"}, "test3": {"value3"}},
+		},
+		{
+			name:       "Attributes",
+			rawCookies: `$Version="1"; Customer="WILE_E_COYOTE"; $Path="/acme"`,
+			want:       map[string][]string{"$Version": {"1"}, "Customer": {"WILE_E_COYOTE"}, "$Path": {"/acme"}},
+		},
+		{
+			name:       "QuotedSeparators",
+			rawCookies: `id="a;b,c" ; lang = en`,
+			want:       map[string][]string{"id": {"a;b,c"}, "lang": {"en"}},
+		},
+		{
+			name:       "EscapedQuote",
+			rawCookies: `id="a\"b\\"`,
+			want:       map[string][]string{"id": {`a"b\`}},
+		},
+		{
+			name:       "TextAfterQuotedValue",
+			rawCookies: `id="a"b ; lang="en" ,x="y"z`,
+			want:       map[string][]string{"id": {"ab"}, "lang": {"en"}, "x": {"yz"}},
+		},
+		{
+			name:       "UnterminatedQuote",
+			rawCookies: `id="a; lang=en`,
+			want:       map[string][]string{"id": {`"a`}, "lang": {"en"}},
+		},
+		{
+			name:       "NoValue",
+			rawCookies: "flag; =bar, test=",
+			want:       map[string][]string{"flag": {""}, "test": {""}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Parse(tt.rawCookies, FormatRFC2965)
+			if !equalMaps(got, tt.want) {
+				t.Errorf("ParseCookiesRFC2965() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package corazawaf
+
+import (
+	"io"
+)
+
+// PrependResponseBody injects the content before the response body. Content
+// prepended by several actions is injected in the order of execution.
+// It requires SecContentInjection and the response body to be buffered.
+func (tx *Transaction) PrependResponseBody(content string) {
+	if !tx.WAF.ContentInjection {
+		tx.debugLogger.Debug().Msg("Skipping prepend, content injection is disabled")
+		return
+	}
+	tx.responseBodyPrepend = append(tx.responseBodyPrepend, content...)
+}
+
+// AppendResponseBody injects the content after the response body. Content
+// appended by several actions is injected in the order of execution.
+// It requires SecContentInjection and the response body to be buffered.
+func (tx *Transaction) AppendResponseBody(content string) {
+	if !tx.WAF.ContentInjection {
+		tx.debugLogger.Debug().Msg("Skipping append, content injection is disabled")
+		return
+	}
+	tx.responseBodyAppend = append(tx.responseBodyAppend, content...)
+}
+
+// ModifiedResponseBody returns the response body to be sent to the client and
+// whether it differs from the one written to the transaction, either because
+// its links have been signed or because content has been injected.
+func (tx *Transaction) ModifiedResponseBody() ([]byte, bool) {
+	return tx.modifiedResponseBody, tx.modifiedResponseBody != nil
+}
+
+// ResponseContentLength returns the length of the response body to be sent to
+// the client, connectors use it to adjust the Content-Length header.
+func (tx *Transaction) ResponseContentLength() int64 {
+	if tx.modifiedResponseBody != nil {
+		return int64(len(tx.modifiedResponseBody))
+	}
+	return tx.responseBodyBuffer.Size()
+}
+
+// injectResponseBody wraps the response body with the prepended and appended content
+func (tx *Transaction) injectResponseBody() {
+	if len(tx.responseBodyPrepend) == 0 && len(tx.responseBodyAppend) == 0 {
+		return
+	}
+
+	body := tx.modifiedResponseBody
+	if body == nil {
+		reader, err := tx.responseBodyBuffer.Reader()
+		if err != nil {
+			tx.debugLogger.Error().Err(err).Msg("Failed to read the response body for content injection")
+			return
+		}
+		if body, err = io.ReadAll(reader); err != nil {
+			tx.debugLogger.Error().Err(err).Msg("Failed to read the response body for content injection")
+			return
+		}
+	}
+
+	modified := make([]byte, 0, len(tx.responseBodyPrepend)+len(body)+len(tx.responseBodyAppend))
+	modified = append(modified, tx.responseBodyPrepend...)
+	modified = append(modified, body...)
+	modified = append(modified, tx.responseBodyAppend...)
+	tx.modifiedResponseBody = modified
+	tx.debugLogger.Debug().
+		Int("content_length", len(modified)).
+		Msg("Injected content in the response body")
+}
@@ -0,0 +1,63 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package corazawaf
+
+import (
+	"testing"
+)
+
+func TestContentInjection(t *testing.T) {
+	tests := []struct {
+		name             string
+		contentInjection bool
+		want             string
+		modified         bool
+	}{
+		{"enabled", true, "<p>1</p><p>2</p>body<p>3</p><p>4</p>", true},
+		{"disabled", false, "body", false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			waf := NewWAF()
+			waf.ResponseBodyAccess = true
+			waf.ResponseBodyMimeTypes = []string{"text/html"}
+			waf.ContentInjection = tc.contentInjection
+			tx := waf.NewTransaction()
+			defer tx.Close()
+
+			tx.ProcessRequestHeaders()
+			if _, err := tx.ProcessRequestBody(); err != nil {
+				t.Fatal(err)
+			}
+			tx.AddResponseHeader("Content-Type", "text/html")
+			tx.ProcessResponseHeaders(200, "HTTP/1.1")
+			if _, _, err := tx.WriteResponseBody([]byte("body")); err != nil {
+				t.Fatal(err)
+			}
+			tx.PrependResponseBody("<p>1</p>")
+			tx.PrependResponseBody("<p>2</p>")
+			tx.AppendResponseBody("<p>3</p>")
+			tx.AppendResponseBody("<p>4</p>")
+			if _, err := tx.ProcessResponseBody(); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, modified := tx.ModifiedResponseBody(); tc.modified != modified {
+				t.Errorf("unexpected modified flag, want %t, have %t", tc.modified, modified)
+			}
+			reader, err := tx.ResponseBodyReader()
+			if err != nil {
+				t.Fatal(err)
+			}
+			body := make([]byte, 64)
+			n, _ := reader.Read(body)
+			if want, have := tc.want, string(body[:n]); want != have {
+				t.Errorf("unexpected body, want %q, have %q", want, have)
+			}
+			if want, have := int64(len(tc.want)), tx.ResponseContentLength(); want != have {
+				t.Errorf("unexpected content length, want %d, have %d", want, have)
+			}
+		})
+	}
+}
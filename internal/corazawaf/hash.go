@@ -0,0 +1,287 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package corazawaf
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// DefaultHashParam is the query parameter carrying the signature of a link
+// when SecHashParam is not set
+const DefaultHashParam = "hmac"
+
+// HashKeyMode selects the data bound to the signature besides the link
+type HashKeyMode int
+
+const (
+	// HashKeyOnly signs the link with the key alone
+	HashKeyOnly HashKeyMode = iota
+	// HashKeySessionID binds the signature to the key of the SESSION collection
+	HashKeySessionID
+	// HashKeyRemoteIP binds the signature to the client address
+	HashKeyRemoteIP
+)
+
+// HashTarget selects the HTML elements whose links are signed
+type HashTarget int
+
+const (
+	// HashHref signs the href attribute of a, area and link elements
+	HashHref HashTarget = iota
+	// HashFormAction signs the action attribute of form elements
+	HashFormAction
+	// HashIframeSrc signs the src attribute of iframe elements
+	HashIframeSrc
+	// HashFrameSrc signs the src attribute of frame elements
+	HashFrameSrc
+	// HashScriptSrc signs the src attribute of script elements
+	HashScriptSrc
+	// HashURL signs every link of the above targets
+	HashURL
+)
+
+// ParseHashTarget parses the target name used by SecHashMethodRx and SecHashMethodPm
+func ParseHashTarget(s string) (HashTarget, bool) {
+	switch strings.ToLower(s) {
+	case "hashhref":
+		return HashHref, true
+	case "hashformaction":
+		return HashFormAction, true
+	case "hashiframesrc":
+		return HashIframeSrc, true
+	case "hashframesrc":
+		return HashFrameSrc, true
+	case "hashscriptsrc":
+		return HashScriptSrc, true
+	case "hashurl":
+		return HashURL, true
+	}
+	return 0, false
+}
+
+// HashMethod selects the links of a target that are signed
+type HashMethod struct {
+	Target HashTarget
+	Match  func(link string) bool
+}
+
+// hashTargetOf returns the target of a tag attribute, if any
+func hashTargetOf(tag, attr string) (HashTarget, bool) {
+	switch {
+	case attr == "href" && (tag == "a" || tag == "area" || tag == "link"):
+		return HashHref, true
+	case attr == "action" && tag == "form":
+		return HashFormAction, true
+	case attr == "src" && tag == "iframe":
+		return HashIframeSrc, true
+	case attr == "src" && tag == "frame":
+		return HashFrameSrc, true
+	case attr == "src" && tag == "script":
+		return HashScriptSrc, true
+	}
+	return 0, false
+}
+
+// isHashableContentType reports whether the response content type is HTML
+func isHashableContentType(ct string) bool {
+	ct = strings.ToLower(strings.TrimSpace(ct))
+	return ct == "text/html" || ct == "application/xhtml+xml"
+}
+
+func (tx *Transaction) hashParam() string {
+	if tx.WAF.HashParam == "" {
+		return DefaultHashParam
+	}
+	return tx.WAF.HashParam
+}
+
+// computeHash returns the hex encoded HMAC-SHA256 of the path and the query,
+// which must not contain the hash parameter.
+func (tx *Transaction) computeHash(path, query string) string {
+	mac := hmac.New(sha256.New, tx.WAF.HashKey)
+	_, _ = io.WriteString(mac, path)
+	if query != "" {
+		_, _ = io.WriteString(mac, "?")
+		_, _ = io.WriteString(mac, query)
+	}
+	switch tx.WAF.HashKeyMode {
+	case HashKeySessionID:
+		_, _ = io.WriteString(mac, "\x00")
+		_, _ = io.WriteString(mac, tx.variables.session.Key())
+	case HashKeyRemoteIP:
+		_, _ = io.WriteString(mac, "\x00")
+		_, _ = io.WriteString(mac, tx.variables.remoteAddr.Get())
+	}
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// splitHashParam removes the hash parameter from a raw query and returns
+// the remaining query and the first value of the parameter.
+func splitHashParam(rawQuery, param string) (string, string) {
+	if rawQuery == "" {
+		return "", ""
+	}
+	var (
+		kept  []string
+		value string
+		found bool
+	)
+	for _, kv := range strings.Split(rawQuery, "&") {
+		k, v, _ := strings.Cut(kv, "=")
+		if k == param {
+			if !found {
+				value, found = v, true
+			}
+			continue
+		}
+		kept = append(kept, kv)
+	}
+	return strings.Join(kept, "&"), value
+}
+
+// signLink appends the hash parameter to a link. Only links pointing to the same
+// site are signed, relative links are resolved against the request URI.
+func (tx *Transaction) signLink(link string) (string, bool) {
+	if link == "" || link[0] == '#' {
+		return "", false
+	}
+	u, err := url.Parse(link)
+	if err != nil || u.Scheme != "" || u.Host != "" || u.Opaque != "" {
+		return "", false
+	}
+
+	base := &url.URL{Path: "/"}
+	if r, err := url.ParseRequestURI(tx.variables.requestURI.Get()); err == nil {
+		base = &url.URL{Path: r.Path, RawPath: r.RawPath}
+	}
+	resolved := base.ResolveReference(u)
+
+	param := tx.hashParam()
+	query, _ := splitHashParam(resolved.RawQuery, param)
+	mac := tx.computeHash(resolved.EscapedPath(), query)
+
+	prefix, fragment, hasFragment := strings.Cut(link, "#")
+	sep := "&"
+	switch {
+	case !strings.Contains(prefix, "?"):
+		sep = "?"
+	case strings.HasSuffix(prefix, "?"), strings.HasSuffix(prefix, "&"):
+		sep = ""
+	}
+	signed := prefix + sep + param + "=" + mac
+	if hasFragment {
+		signed += "#" + fragment
+	}
+	return signed, true
+}
+
+// shouldSignLink reports whether a link of the given target is selected by
+// any of the SecHashMethodRx and SecHashMethodPm directives
+func (tx *Transaction) shouldSignLink(target HashTarget, link string) bool {
+	for _, m := range tx.WAF.HashMethods {
+		if (m.Target == target || m.Target == HashURL) && m.Match(link) {
+			return true
+		}
+	}
+	return false
+}
+
+// signHTML rewrites the links of an HTML document adding their signature.
+// Only the tags holding a signed link are re-encoded, everything else is
+// copied verbatim.
+func (tx *Transaction) signHTML(r io.Reader) ([]byte, bool, error) {
+	var (
+		out      bytes.Buffer
+		modified bool
+	)
+	z := html.NewTokenizer(r)
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			if err := z.Err(); err != io.EOF {
+				return nil, false, err
+			}
+			return out.Bytes(), modified, nil
+		}
+
+		if tt != html.StartTagToken && tt != html.SelfClosingTagToken {
+			out.Write(z.Raw())
+			continue
+		}
+
+		raw := append([]byte(nil), z.Raw()...)
+		token := z.Token()
+		signed := false
+		for i, attr := range token.Attr {
+			if attr.Namespace != "" {
+				continue
+			}
+			target, ok := hashTargetOf(token.Data, attr.Key)
+			if !ok || !tx.shouldSignLink(target, attr.Val) {
+				continue
+			}
+			if link, ok := tx.signLink(attr.Val); ok {
+				token.Attr[i].Val = link
+				signed = true
+			}
+		}
+
+		if !signed {
+			out.Write(raw)
+			continue
+		}
+		out.WriteString(token.String())
+		modified = true
+	}
+}
+
+// signResponseBody signs the links of the buffered HTML response body
+func (tx *Transaction) signResponseBody() {
+	if !tx.HashEngine || len(tx.WAF.HashMethods) == 0 || !isHashableContentType(tx.variables.responseContentType.Get()) {
+		return
+	}
+
+	reader, err := tx.responseBodyBuffer.Reader()
+	if err != nil {
+		tx.debugLogger.Error().Err(err).Msg("Failed to read the response body for signing")
+		return
+	}
+
+	body, modified, err := tx.signHTML(reader)
+	if err != nil {
+		tx.debugLogger.Error().Err(err).Msg("Failed to sign the response body")
+		return
+	}
+	if modified {
+		tx.modifiedResponseBody = body
+	}
+}
+
+// ValidateHash reports whether the request URI carries a valid signature. It
+// always returns true when the hash enforcement is disabled for the transaction.
+func (tx *Transaction) ValidateHash(uri string) bool {
+	if !tx.HashEngine || !tx.HashEnforcement {
+		return true
+	}
+
+	u, err := url.ParseRequestURI(uri)
+	if err != nil {
+		return false
+	}
+	query, got := splitHashParam(u.RawQuery, tx.hashParam())
+	if got == "" {
+		return false
+	}
+
+	want := tx.computeHash(u.EscapedPath(), query)
+	return hmac.Equal([]byte(got), []byte(want))
+}
@@ -0,0 +1,197 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package corazawaf
+
+import (
+	"io"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func newHashWAF(t *testing.T) *WAF {
+	t.Helper()
+	waf := NewWAF()
+	waf.HashEngine = true
+	waf.HashKey = []byte("this_is_my_key")
+	waf.HashMethods = []HashMethod{
+		{Target: HashHref, Match: regexp.MustCompile("product").MatchString},
+		{Target: HashFormAction, Match: regexp.MustCompile(`\.php`).MatchString},
+	}
+	waf.ResponseBodyAccess = true
+	waf.ResponseBodyMimeTypes = []string{"text/html"}
+	return waf
+}
+
+func signBody(t *testing.T, tx *Transaction, body string) string {
+	t.Helper()
+	tx.ProcessURI("/shop/index.html?page=1", "GET", "HTTP/1.1")
+	tx.ProcessRequestHeaders()
+	if _, err := tx.ProcessRequestBody(); err != nil {
+		t.Fatal(err)
+	}
+	tx.AddResponseHeader("Content-Type", "text/html; charset=utf-8")
+	tx.ProcessResponseHeaders(200, "HTTP/1.1")
+	if _, _, err := tx.WriteResponseBody([]byte(body)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.ProcessResponseBody(); err != nil {
+		t.Fatal(err)
+	}
+	r, err := tx.ResponseBodyReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+var signedLinkRx = regexp.MustCompile(`(?:href|action)="([^"]+)"`)
+
+func TestHashSignResponseBody(t *testing.T) {
+	waf := newHashWAF(t)
+	tx := waf.NewTransaction()
+	defer tx.Close()
+
+	body := `<HTML><body><A HREF="product?id=1">p</A>` +
+		`<a href="/about">about</a>` +
+		`<a href="https://example.com/product">external</a>` +
+		`<form action="/buy.php" method="post"><input name="q"/></form>` +
+		`<!-- <a href="product"> --></body></HTML>`
+	signed := signBody(t, tx, body)
+
+	if !strings.Contains(signed, `<a href="/about">about</a>`) ||
+		!strings.Contains(signed, `<a href="https://example.com/product">external</a>`) ||
+		!strings.Contains(signed, `<!-- <a href="product"> -->`) {
+		t.Fatalf("unexpected modification of unselected links: %s", signed)
+	}
+
+	links := signedLinkRx.FindAllStringSubmatch(signed, -1)
+	var got []string
+	for _, l := range links {
+		if strings.Contains(l[1], "hmac=") {
+			got = append(got, strings.ReplaceAll(l[1], "&amp;", "&"))
+		}
+	}
+	if len(got) != 2 {
+		t.Fatalf("unexpected signed links %q in %s", got, signed)
+	}
+
+	// Links are validated against the resolved request URI
+	for uri, link := range map[string]string{"/shop/" + got[0]: got[0], got[1]: got[1]} {
+		vtx := waf.NewTransaction()
+		if !vtx.ValidateHash(uri) {
+			t.Errorf("expected valid signature for %q", link)
+		}
+		if vtx.ValidateHash(strings.Replace(uri, "hmac=", "hmac=0", 1)) {
+			t.Errorf("expected invalid signature for tampered %q", link)
+		}
+		vtx.Close()
+	}
+}
+
+func TestHashSignResponseBodyNotHTML(t *testing.T) {
+	waf := newHashWAF(t)
+	waf.ResponseBodyMimeTypes = []string{"text/plain"}
+	tx := waf.NewTransaction()
+	defer tx.Close()
+
+	tx.AddResponseHeader("Content-Type", "text/plain")
+	tx.ProcessResponseHeaders(200, "HTTP/1.1")
+	body := `<a href="product">p</a>`
+	if _, _, err := tx.WriteResponseBody([]byte(body)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.ProcessResponseBody(); err != nil {
+		t.Fatal(err)
+	}
+	if tx.modifiedResponseBody != nil {
+		t.Errorf("unexpected signed body for plain text response")
+	}
+}
+
+func TestSignLink(t *testing.T) {
+	waf := newHashWAF(t)
+	tx := waf.NewTransaction()
+	defer tx.Close()
+	tx.ProcessURI("/a/b.html", "GET", "HTTP/1.1")
+
+	tests := map[string]string{
+		"c.html":         "c.html?hmac=",
+		"/c.html?x=1":    "/c.html?x=1&hmac=",
+		"/c.html?":       "/c.html?hmac=",
+		"/c.html?x=1#id": "/c.html?x=1&hmac=",
+	}
+	for link, prefix := range tests {
+		signed, ok := tx.signLink(link)
+		if !ok {
+			t.Errorf("expected %q to be signed", link)
+			continue
+		}
+		if !strings.HasPrefix(signed, prefix) {
+			t.Errorf("unexpected signed link for %q: %q", link, signed)
+		}
+	}
+	if signed, _ := tx.signLink("/c.html?x=1#id"); !strings.HasSuffix(signed, "#id") {
+		t.Errorf("expected the fragment to be kept: %q", signed)
+	}
+
+	for _, link := range []string{"", "#top", "mailto:a@b.c", "javascript:void(0)", "//example.com/x"} {
+		if _, ok := tx.signLink(link); ok {
+			t.Errorf("unexpected signature for %q", link)
+		}
+	}
+}
+
+func TestValidateHashKeyModes(t *testing.T) {
+	waf := newHashWAF(t)
+	waf.HashKeyMode = HashKeyRemoteIP
+
+	sign := func(addr string) string {
+		tx := waf.NewTransaction()
+		defer tx.Close()
+		tx.ProcessConnection(addr, 1234, "127.0.0.1", 80)
+		tx.ProcessURI("/", "GET", "HTTP/1.1")
+		signed, _ := tx.signLink("/product")
+		return signed
+	}
+	validate := func(addr, uri string) bool {
+		tx := waf.NewTransaction()
+		defer tx.Close()
+		tx.ProcessConnection(addr, 1234, "127.0.0.1", 80)
+		return tx.ValidateHash(uri)
+	}
+
+	link := sign("10.0.0.1")
+	if !validate("10.0.0.1", link) {
+		t.Error("expected valid signature for the same client")
+	}
+	if validate("10.0.0.2", link) {
+		t.Error("expected invalid signature for another client")
+	}
+}
+
+func TestValidateHashEnforcement(t *testing.T) {
+	waf := newHashWAF(t)
+	tx := waf.NewTransaction()
+	defer tx.Close()
+
+	if tx.ValidateHash("/product") {
+		t.Error("expected missing signature to be invalid")
+	}
+	tx.HashEnforcement = false
+	if !tx.ValidateHash("/product") {
+		t.Error("expected no enforcement")
+	}
+
+	waf.HashEngine = false
+	tx2 := waf.NewTransaction()
+	defer tx2.Close()
+	if !tx2.ValidateHash("/product") {
+		t.Error("expected no enforcement with the hash engine disabled")
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"regexp"
 	"strings"
 	"sync"
+	"time"
 	"unsafe"
 
 	"github.com/corazawaf/coraza/v3/debuglog"
@@ -181,6 +182,10 @@ func (r *Rule) Evaluate(phase types.RulePhase, tx plugintypes.TransactionState,
 const noID = 0
 
 func (r *Rule) doEvaluate(logger debuglog.Logger, phase types.RulePhase, tx *Transaction, collectiveMatchedValues *[]types.MatchData, chainLevel int, cache map[transformationKey]*transformationValue) []types.MatchData {
+	if tx.WAF.RulePerfTime > 0 && chainLevel == chainLevelZero {
+		// the time of the chained rules is accounted to the parent rule
+		defer tx.startRulePerf(r)()
+	}
 	tx.Capture = r.Capture
 
 	if multiphaseEvaluation {
@@ -202,8 +207,9 @@ func (r *Rule) doEvaluate(logger debuglog.Logger, phase types.RulePhase, tx *Tra
 		ruleCol.SetIndex("logdata", 0, r.LogData.String())
 	}
 	ruleCol.SetIndex("severity", 0, r.Severity_.String())
-	// SecMark and SecAction uses nil operator
-	if r.operator == nil {
+	// SecMark and SecAction uses nil operator, SecRuleScript has no variables and
+	// evaluates its operator once
+	if r.operator == nil || (len(r.variables) == 0 && r.executeOperator("", tx)) {
 		logger.Debug().Msg("Forcing rule to match")
 		md := &corazarules.MatchData{}
 		if r.ParentID_ != noID || r.MultiMatch {
@@ -635,6 +641,12 @@ func (r *Rule) SetOperator(operator plugintypes.Operator, functionName string, p
 }
 
 func (r *Rule) executeOperator(data string, tx *Transaction) (result bool) {
+	if tx.WAF.RulePerfTime > 0 {
+		start := time.Now()
+		defer func() {
+			tx.operatorTime += time.Since(start)
+		}()
+	}
 	result = r.operator.Operator.Evaluate(tx, data)
 	if r.operator.Negation {
 		result = !result
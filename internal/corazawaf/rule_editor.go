@@ -0,0 +1,122 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package corazawaf
+
+// RuleEditor edits a copy of the rules of a RuleGroup, see RuleGroup.Edit.
+// The rules it returns are copies of the rules being evaluated, they can be
+// modified, e.g. with AddVariableNegation, AddAction or SetOperator, without
+// changing the rules of the transactions in progress.
+type RuleEditor struct {
+	rules []Rule
+	// copied tells the rules already copied on write by the editor
+	copied []bool
+}
+
+// Edit applies fn to a copy of the rules and replaces the rules of the group with
+// the copy once fn succeeds, if it fails the rules are left untouched. Only the
+// rules returned by the editor are copied, the others are shared with the current
+// rules.
+//
+// Edits are serialized and are concurrent safe, the transactions evaluate the rules
+// loaded at the start of each phase.
+func (rg *RuleGroup) Edit(fn func(e *RuleEditor) error) error {
+	rg.mu.Lock()
+	defer rg.mu.Unlock()
+
+	rules := rg.load()
+	e := &RuleEditor{
+		rules:  append([]Rule(nil), rules...),
+		copied: make([]bool, len(rules)),
+	}
+	if err := fn(e); err != nil {
+		return err
+	}
+	rg.store(e.rules)
+	return nil
+}
+
+// rule returns the rule at i, copying it the first time it's edited
+func (e *RuleEditor) rule(i int) *Rule {
+	if !e.copied[i] {
+		e.rules[i] = e.rules[i].copyOnWrite()
+		e.copied[i] = true
+	}
+	return &e.rules[i]
+}
+
+// FindByID returns the rule with the ID, nil if there is none
+func (e *RuleEditor) FindByID(id int) *Rule {
+	for i := range e.rules {
+		if e.rules[i].ID_ == id {
+			return e.rule(i)
+		}
+	}
+	return nil
+}
+
+// Find returns the rules matched by the selector, in the order of the configuration
+func (e *RuleEditor) Find(s *RuleSelector) []*Rule {
+	var rules []*Rule
+	for i := range e.rules {
+		if s.Matches(&e.rules[i]) {
+			rules = append(rules, e.rule(i))
+		}
+	}
+	return rules
+}
+
+// Delete removes the rules matched by the selector
+func (e *RuleEditor) Delete(s *RuleSelector) {
+	var (
+		rules  []Rule
+		copied []bool
+	)
+	for i := range e.rules {
+		if !s.Matches(&e.rules[i]) {
+			rules = append(rules, e.rules[i])
+			copied = append(copied, e.copied[i])
+		}
+	}
+	e.rules, e.copied = rules, copied
+}
+
+// Set adds the rule, replacing the rule with the same ID if any
+func (e *RuleEditor) Set(rule Rule) {
+	if rule.ID_ != 0 {
+		for i := range e.rules {
+			if e.rules[i].ID_ == rule.ID_ {
+				// the rule is owned by the caller, it's copied if edited afterwards
+				e.rules[i], e.copied[i] = rule, false
+				return
+			}
+		}
+	}
+	e.rules = append(e.rules, rule)
+	e.copied = append(e.copied, false)
+}
+
+// Count returns the count of rules
+func (e *RuleEditor) Count() int {
+	return len(e.rules)
+}
+
+// copyOnWrite returns a copy of the rule sharing its compiled operator, actions and
+// transformations, appending to the copy doesn't modify the original rule. Chained
+// rules are copied as well.
+func (r *Rule) copyOnWrite() Rule {
+	c := *r
+	c.variables = make([]ruleVariableParams, len(r.variables))
+	for i, v := range r.variables {
+		v.Exceptions = v.Exceptions[:len(v.Exceptions):len(v.Exceptions)]
+		c.variables[i] = v
+	}
+	c.transformations = r.transformations[:len(r.transformations):len(r.transformations)]
+	c.actions = r.actions[:len(r.actions):len(r.actions)]
+	c.Tags_ = r.Tags_[:len(r.Tags_):len(r.Tags_)]
+	if r.Chain != nil {
+		chain := r.Chain.copyOnWrite()
+		c.Chain = &chain
+	}
+	return c
+}
@@ -0,0 +1,157 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package corazawaf
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/corazawaf/coraza/v3/types"
+	"github.com/corazawaf/coraza/v3/types/variables"
+)
+
+func TestRuleGroupEdit(t *testing.T) {
+	rg := NewRuleGroup()
+	for i := 1; i <= 3; i++ {
+		r := newTestRule(i)
+		if err := r.AddVariable(variables.Args, "", false); err != nil {
+			t.Fatal(err)
+		}
+		if err := rg.Add(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	before := rg.GetRules()
+
+	err := rg.Edit(func(e *RuleEditor) error {
+		r := e.FindByID(2)
+		if r == nil {
+			t.Fatal("expected rule 2")
+		}
+		if err := r.AddVariableNegation(variables.Args, "password"); err != nil {
+			return err
+		}
+		r.Tags_ = append(r.Tags_, "edited")
+		e.Delete(mustParseRuleSelector(t, RuleSelectorID, "3"))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rg.Count() != 2 {
+		t.Errorf("expected 2 rules, got %d", rg.Count())
+	}
+	if want, have := 1, len(rg.FindByID(2).variables[0].Exceptions); want != have {
+		t.Errorf("expected %d exceptions, got %d", want, have)
+	}
+	// the rules obtained before the edit are unchanged
+	if len(before) != 3 {
+		t.Errorf("expected the previous rules to be kept, got %d rules", len(before))
+	}
+	if len(before[1].variables[0].Exceptions) != 0 || len(before[1].Tags_) != 1 {
+		t.Error("unexpected change of the previous rules")
+	}
+	// rules not edited are shared
+	if &rg.GetRules()[0].variables[0] != &before[0].variables[0] {
+		t.Error("expected the rules not edited to be shared")
+	}
+}
+
+func TestRuleGroupEditError(t *testing.T) {
+	rg := NewRuleGroup()
+	if err := rg.Add(newTestRule(1)); err != nil {
+		t.Fatal(err)
+	}
+
+	err := rg.Edit(func(e *RuleEditor) error {
+		e.Delete(mustParseRuleSelector(t, RuleSelectorID, "1"))
+		e.Set(*newTestRule(2))
+		return errors.New("failed")
+	})
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if rg.Count() != 1 || rg.FindByID(1) == nil {
+		t.Error("expected the rules to be left untouched")
+	}
+}
+
+func TestRuleEditorSet(t *testing.T) {
+	rg := NewRuleGroup()
+	for i := 1; i <= 2; i++ {
+		if err := rg.Add(newTestRule(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	replacement := newTestRule(1)
+	replacement.Phase_ = types.PhaseResponseHeaders
+	err := rg.Edit(func(e *RuleEditor) error {
+		e.Set(*replacement)
+		e.Set(*newTestRule(3))
+		// the replacement is copied when edited
+		e.FindByID(1).Tags_ = append(e.FindByID(1).Tags_, "edited")
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rules := rg.GetRules()
+	if len(rules) != 3 || rules[0].ID_ != 1 || rules[2].ID_ != 3 {
+		t.Fatalf("unexpected rules %v", rules)
+	}
+	if rules[0].Phase_ != types.PhaseResponseHeaders {
+		t.Error("expected rule 1 to be replaced")
+	}
+	if len(replacement.Tags_) != 1 {
+		t.Error("unexpected change of the replacement")
+	}
+}
+
+func TestRuleGroupEditWhileEvaluating(t *testing.T) {
+	waf := NewWAF()
+	for i := 1; i <= 10; i++ {
+		r := newTestRule(i)
+		r.Phase_ = types.PhaseRequestHeaders
+		if err := r.AddVariable(variables.Args, "", false); err != nil {
+			t.Fatal(err)
+		}
+		r.SetOperator(&dummyEqOperator{}, "@eq", "0")
+		if err := waf.Rules.Add(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			_ = waf.Rules.Edit(func(e *RuleEditor) error {
+				for _, r := range e.Find(mustParseRuleSelector(t, RuleSelectorTag, "test")) {
+					if err := r.AddVariableNegation(variables.Args, "password"); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		tx := waf.NewTransaction()
+		tx.AddGetRequestArgument("password", "secret")
+		tx.ProcessRequestHeaders()
+		if err := tx.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wg.Wait()
+
+	if want, have := 100, len(waf.Rules.FindByID(1).variables[0].Exceptions); want != have {
+		t.Errorf("expected %d exceptions, got %d", want, have)
+	}
+}
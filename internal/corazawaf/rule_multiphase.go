@@ -4,6 +4,7 @@
 package corazawaf
 
 import (
+	"slices"
 	"strings"
 
 	"github.com/corazawaf/coraza/v3/types"
@@ -233,6 +234,35 @@ func minPhase(v variables.RuleVariable) types.RulePhase {
 	return types.PhaseUnknown
 }
 
+// MultiphaseEvaluation returns whether the rules are evaluated in the phases of their
+// variables, i.e. whether Coraza is built with the coraza.rule.multiphase_evaluation tag
+func MultiphaseEvaluation() bool {
+	return multiphaseEvaluation
+}
+
+// LateVariables returns the variables of the rule, and of its chained rules, which are
+// populated after the phase of the rule. They are always empty when the rule is evaluated,
+// unless multiphase evaluation is enabled, which evaluates them in their own phase.
+func (r *Rule) LateVariables() []variables.RuleVariable {
+	if multiphaseEvaluation {
+		return nil
+	}
+	var res []variables.RuleVariable
+	for c := r; c != nil; c = c.Chain {
+		for _, v := range c.variables {
+			min := minPhase(v.Variable)
+			if v.Variable == variables.Args || v.Variable == variables.ArgsNames {
+				// the arguments of the query string are available along with the headers
+				min = types.PhaseRequestHeaders
+			}
+			if min > r.Phase_ && !slices.Contains(res, v.Variable) {
+				res = append(res, v.Variable)
+			}
+		}
+	}
+	return res
+}
+
 // TODO(anuraaga): This is effectively lazily computing the min phase of a rule with chain the first
 // time we evaluate the rule. Instead, we should do this at parse time, but this will require a
 // large-ish refactoring of the parser, which adds parent rules to a rule group before preparing
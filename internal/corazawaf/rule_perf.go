@@ -0,0 +1,115 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package corazawaf
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RulePerformance aggregates the evaluations of a rule that took at least the
+// RulePerfTime of the WAF
+type RulePerformance struct {
+	// ID is the ID of the rule
+	ID int
+	// Operator is the operator of the rule, e.g. @rx
+	Operator string
+	// Count is the number of slow evaluations
+	Count int
+	// Total and Max are the total and the maximum time of the slow evaluations,
+	// including the chained rules
+	Total time.Duration
+	Max   time.Duration
+	// OperatorTotal is the part of Total spent in the operators of the rule and
+	// of its chained rules
+	OperatorTotal time.Duration
+}
+
+// rulePerfStats aggregates the slow evaluations of the rules of a WAF
+type rulePerfStats struct {
+	mu    sync.Mutex
+	rules map[int]*RulePerformance
+}
+
+func (s *rulePerfStats) record(r *Rule, d, operator time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.rules == nil {
+		s.rules = map[int]*RulePerformance{}
+	}
+	p, ok := s.rules[r.ID_]
+	if !ok {
+		p = &RulePerformance{ID: r.ID_}
+		if r.operator != nil {
+			p.Operator = r.operator.Function
+		}
+		s.rules[r.ID_] = p
+	}
+	p.Count++
+	p.Total += d
+	p.OperatorTotal += operator
+	if d > p.Max {
+		p.Max = d
+	}
+}
+
+// RulePerformance returns the aggregated slow evaluations of the rules since the WAF
+// was created or the last reset, the slowest rules in total first. Slow evaluations
+// are the ones taking at least RulePerfTime, nothing is collected if it's 0.
+func (w *WAF) RulePerformance(reset bool) []RulePerformance {
+	s := &w.rulePerf
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	res := make([]RulePerformance, 0, len(s.rules))
+	for _, p := range s.rules {
+		res = append(res, *p)
+	}
+	if reset {
+		s.rules = nil
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Total != res[j].Total {
+			return res[i].Total > res[j].Total
+		}
+		return res[i].ID < res[j].ID
+	})
+	return res
+}
+
+// slowRule is a rule evaluation of the transaction above RulePerfTime
+type slowRule struct {
+	id int
+	d  time.Duration
+}
+
+// startRulePerf starts timing the evaluation of a rule, it returns the function
+// recording it once it's done
+func (tx *Transaction) startRulePerf(r *Rule) func() {
+	start := time.Now()
+	tx.operatorTime = 0
+	return func() {
+		d := time.Since(start)
+		if d < tx.WAF.RulePerfTime || r.ID_ == noID {
+			return
+		}
+		tx.slowRules = append(tx.slowRules, slowRule{id: r.ID_, d: d})
+		tx.WAF.rulePerf.record(r, d, tx.operatorTime)
+	}
+}
+
+// rulesPerformanceInfo formats the slow rules of the transaction like ModSecurity
+// does in the H part of the audit log, e.g. "942100=1520", in microseconds
+func (tx *Transaction) rulesPerformanceInfo() string {
+	if len(tx.slowRules) == 0 {
+		return ""
+	}
+	info := make([]string, 0, len(tx.slowRules))
+	for _, s := range tx.slowRules {
+		info = append(info, fmt.Sprintf("%q", fmt.Sprintf("%d=%d", s.id, s.d.Microseconds())))
+	}
+	return strings.Join(info, ", ")
+}
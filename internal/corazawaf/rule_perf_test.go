@@ -0,0 +1,93 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package corazawaf
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/corazawaf/coraza/v3/experimental/plugins/plugintypes"
+	"github.com/corazawaf/coraza/v3/types"
+	"github.com/corazawaf/coraza/v3/types/variables"
+)
+
+type sleepOperator struct {
+	d time.Duration
+}
+
+func (o *sleepOperator) Evaluate(_ plugintypes.TransactionState, _ string) bool {
+	time.Sleep(o.d)
+	return false
+}
+
+func newPerfTestRule(t *testing.T, id int, d time.Duration) *Rule {
+	t.Helper()
+	r := newTestRule(id)
+	r.Phase_ = types.PhaseRequestHeaders
+	if err := r.AddVariable(variables.RequestURI, "", false); err != nil {
+		t.Fatal(err)
+	}
+	r.SetOperator(&sleepOperator{d: d}, "@sleep", "")
+	return r
+}
+
+func TestRulePerformance(t *testing.T) {
+	waf := NewWAF()
+	waf.RulePerfTime = 5 * time.Millisecond
+	waf.AuditLogParts = types.AuditLogParts{types.AuditLogPartAuditLogTrailer}
+	for _, r := range []*Rule{
+		newPerfTestRule(t, 1, 0),
+		newPerfTestRule(t, 2, 10*time.Millisecond),
+	} {
+		if err := waf.Rules.Add(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i := 0; i < 2; i++ {
+		tx := waf.NewTransaction()
+		tx.ProcessURI("/", "GET", "HTTP/1.1")
+		tx.ProcessRequestHeaders()
+		if len(tx.slowRules) != 1 || tx.slowRules[0].id != 2 {
+			t.Fatalf("unexpected slow rules %v", tx.slowRules)
+		}
+		info := tx.AuditLog().Transaction().Producer().(interface{ RulesPerformanceInfo() string }).RulesPerformanceInfo()
+		if !strings.HasPrefix(info, `"2=`) {
+			t.Errorf("unexpected rules performance info %q", info)
+		}
+		if err := tx.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	perf := waf.RulePerformance(true)
+	if len(perf) != 1 {
+		t.Fatalf("unexpected rule performance %v", perf)
+	}
+	p := perf[0]
+	if p.ID != 2 || p.Operator != "@sleep" || p.Count != 2 {
+		t.Errorf("unexpected rule performance %+v", p)
+	}
+	if p.Max < 10*time.Millisecond || p.Total < 20*time.Millisecond || p.OperatorTotal > p.Total || p.OperatorTotal < 20*time.Millisecond {
+		t.Errorf("unexpected timing %+v", p)
+	}
+	if perf := waf.RulePerformance(false); len(perf) != 0 {
+		t.Errorf("expected the rule performance to be reset, got %v", perf)
+	}
+}
+
+func TestRulePerformanceDisabled(t *testing.T) {
+	waf := NewWAF()
+	if err := waf.Rules.Add(newPerfTestRule(t, 1, time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+	tx := waf.NewTransaction()
+	defer tx.Close()
+	tx.ProcessURI("/", "GET", "HTTP/1.1")
+	tx.ProcessRequestHeaders()
+	if len(tx.slowRules) != 0 || tx.operatorTime != 0 || len(waf.RulePerformance(false)) != 0 {
+		t.Error("unexpected profiling of the rules")
+	}
+}
@@ -0,0 +1,258 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package corazawaf
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/corazawaf/coraza/v3/internal/memoize"
+)
+
+// RuleSelectorField is the rule field a selector condition applies to
+type RuleSelectorField int
+
+const (
+	RuleSelectorID RuleSelectorField = iota
+	RuleSelectorTag
+	RuleSelectorMsg
+)
+
+var ruleSelectorFields = map[string]RuleSelectorField{
+	"id":  RuleSelectorID,
+	"tag": RuleSelectorTag,
+	"msg": RuleSelectorMsg,
+}
+
+// RuleSelector selects rules by their ID, tags or message. It is shared by the
+// directives removing or updating rules and by the ctl action.
+//
+// A selector is made of conditions separated by "&", all of them must match:
+//
+//	942100                                   the rule ID
+//	942100-942999                            a range of rule IDs, inclusive
+//	attack-sqli                              a tag or a message, matched exactly
+//	/^attack-(sqli|xss)$/                    a tag or a message regex
+//	id=942000-942999&tag=/paranoia-level\/3/ conditions on several fields
+//
+// Conditions without a field apply to the default field of the selector, e.g. the
+// tag for SecRuleRemoveByTag. "&" is escaped as "\&" outside of regexes. Message
+// selectors without any field or regex condition are matched exactly as a whole, so
+// that messages containing "&" keep working.
+type RuleSelector struct {
+	conditions []ruleCondition
+}
+
+type ruleCondition struct {
+	field RuleSelectorField
+	// start and end are the range of IDs matched by ID conditions
+	start, end int
+	text       string
+	rx         *regexp.Regexp
+}
+
+// ParseRuleSelector parses a selector whose conditions apply to field by default
+func ParseRuleSelector(field RuleSelectorField, selector string) (*RuleSelector, error) {
+	selector = strings.TrimSpace(selector)
+	if selector == "" {
+		return nil, errors.New("empty rule selector")
+	}
+
+	conds := splitRuleConditions(selector)
+	if field == RuleSelectorMsg && len(conds) > 1 && !hasConditionSyntax(conds) {
+		// Messages may contain "&", e.g. "SQL & XSS", they are only split into
+		// conditions when one of them has a field or a regex
+		return &RuleSelector{conditions: []ruleCondition{{field: field, text: selector}}}, nil
+	}
+
+	s := &RuleSelector{}
+	for _, c := range conds {
+		cond, err := parseRuleCondition(field, c)
+		if err != nil {
+			return nil, err
+		}
+		s.conditions = append(s.conditions, cond)
+	}
+	return s, nil
+}
+
+// splitRuleConditions splits the selector at the "&" not escaped and outside of regexes
+func splitRuleConditions(selector string) []string {
+	var (
+		conds   []string
+		cond    strings.Builder
+		inRegex bool
+	)
+	for i := 0; i < len(selector); i++ {
+		c := selector[i]
+		switch {
+		case c == '\\' && i+1 < len(selector):
+			i++
+			if selector[i] != '&' || inRegex {
+				cond.WriteByte(c)
+			}
+			cond.WriteByte(selector[i])
+			continue
+		case c == '/' && inRegex:
+			inRegex = false
+		case c == '/' && isConditionValueStart(cond.String()):
+			inRegex = true
+		case c == '&' && !inRegex:
+			conds = append(conds, cond.String())
+			cond.Reset()
+			continue
+		}
+		cond.WriteByte(c)
+	}
+	return append(conds, cond.String())
+}
+
+// hasConditionSyntax reports whether one of the conditions has a field or is a regex
+func hasConditionSyntax(conds []string) bool {
+	for _, c := range conds {
+		if name, _, ok := strings.Cut(c, "="); ok {
+			if _, ok := ruleSelectorFields[strings.ToLower(name)]; ok {
+				return true
+			}
+		}
+		if c = strings.TrimSpace(c); len(c) > 2 && c[0] == '/' && c[len(c)-1] == '/' {
+			return true
+		}
+	}
+	return false
+}
+
+// isConditionValueStart reports whether the value of a condition starts after prefix
+func isConditionValueStart(prefix string) bool {
+	if prefix == "" {
+		return true
+	}
+	name, ok := strings.CutSuffix(prefix, "=")
+	if !ok {
+		return false
+	}
+	_, ok = ruleSelectorFields[strings.ToLower(name)]
+	return ok
+}
+
+func parseRuleCondition(field RuleSelectorField, cond string) (ruleCondition, error) {
+	if name, value, ok := strings.Cut(cond, "="); ok {
+		if f, ok := ruleSelectorFields[strings.ToLower(name)]; ok {
+			field, cond = f, value
+		}
+	}
+	if cond == "" {
+		return ruleCondition{}, errors.New("empty rule selector condition")
+	}
+
+	c := ruleCondition{field: field}
+	if field == RuleSelectorID {
+		var err error
+		c.start, c.end, err = parseIDRange(cond)
+		return c, err
+	}
+
+	if len(cond) > 2 && cond[0] == '/' && cond[len(cond)-1] == '/' {
+		pattern := cond[1 : len(cond)-1]
+		re, err := memoize.Do("ruleSelector:rx:"+pattern, func() (interface{}, error) { return regexp.Compile(pattern) })
+		if err != nil {
+			return ruleCondition{}, fmt.Errorf("invalid rule selector regex %q: %v", pattern, err)
+		}
+		c.rx = re.(*regexp.Regexp)
+		return c, nil
+	}
+	c.text = cond
+	return c, nil
+}
+
+// parseIDRange parses an ID or a range of IDs like 1000-1999
+func parseIDRange(idOrRange string) (int, int, error) {
+	idx := strings.Index(idOrRange, "-")
+	if idx == -1 {
+		id, err := strconv.Atoi(idOrRange)
+		if err != nil {
+			return 0, 0, err
+		}
+		return id, id, nil
+	}
+	if idx == 0 {
+		return 0, 0, fmt.Errorf("invalid negative id: %s", idOrRange)
+	}
+	start, err := strconv.Atoi(idOrRange[:idx])
+	if err != nil {
+		return 0, 0, err
+	}
+	end, err := strconv.Atoi(idOrRange[idx+1:])
+	if err != nil {
+		return 0, 0, err
+	}
+	if start > end {
+		return 0, 0, fmt.Errorf("invalid range: %s", idOrRange)
+	}
+	return start, end, nil
+}
+
+// ID returns the rule ID selected by the selector, if it selects nothing but an ID
+func (s *RuleSelector) ID() (int, bool) {
+	if len(s.conditions) != 1 {
+		return 0, false
+	}
+	c := s.conditions[0]
+	return c.start, c.field == RuleSelectorID && c.start == c.end
+}
+
+// Matches returns whether the rule matches all the conditions of the selector
+func (s *RuleSelector) Matches(r *Rule) bool {
+	for _, c := range s.conditions {
+		if !c.matches(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *ruleCondition) matches(r *Rule) bool {
+	switch c.field {
+	case RuleSelectorID:
+		return r.ID_ >= c.start && r.ID_ <= c.end
+	case RuleSelectorTag:
+		for _, tag := range r.Tags_ {
+			if c.matchesText(tag) {
+				return true
+			}
+		}
+		return false
+	case RuleSelectorMsg:
+		return r.Msg != nil && c.matchesText(r.Msg.String())
+	}
+	return false
+}
+
+func (c *ruleCondition) matchesText(s string) bool {
+	if c.rx != nil {
+		return c.rx.MatchString(s)
+	}
+	return c.text == s
+}
+
+// FindBySelector returns the rules matched by the selector
+// The rules must not be modified once the WAF is in use, see Edit
+func (rg *RuleGroup) FindBySelector(s *RuleSelector) []*Rule {
+	var found []*Rule
+	rules := rg.load()
+	for i := range rules {
+		if s.Matches(&rules[i]) {
+			found = append(found, &rules[i])
+		}
+	}
+	return found
+}
+
+// DeleteBySelector removes the rules matched by the selector
+func (rg *RuleGroup) DeleteBySelector(s *RuleSelector) {
+	rg.deleteFunc(s.Matches)
+}
@@ -0,0 +1,137 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package corazawaf
+
+import (
+	"testing"
+
+	"github.com/corazawaf/coraza/v3/experimental/plugins/macro"
+	"github.com/corazawaf/coraza/v3/internal/memoize"
+)
+
+func TestRuleSelector(t *testing.T) {
+	newRule := func(id int, msg string, tags ...string) *Rule {
+		r := NewRule()
+		r.ID_ = id
+		if msg != "" {
+			r.Msg, _ = macro.NewMacro(msg)
+		}
+		r.Tags_ = tags
+		return r
+	}
+	rg := NewRuleGroup()
+	for _, r := range []*Rule{
+		newRule(942100, "SQL Injection Attack Detected via libinjection", "attack-sqli", "paranoia-level/1"),
+		newRule(942200, "Detects MySQL comment-/space-obfuscated injections", "attack-sqli", "paranoia-level/2"),
+		newRule(941100, "XSS Attack Detected via libinjection", "attack-xss", "paranoia-level/1"),
+		newRule(932100, "Remote Command Execution: Unix Command Injection & more", "attack-rce"),
+		newRule(1, ""),
+	} {
+		if err := rg.Add(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		field    RuleSelectorField
+		selector string
+		want     []int
+	}{
+		{RuleSelectorID, "942100", []int{942100}},
+		{RuleSelectorID, "942000-942999", []int{942100, 942200}},
+		{RuleSelectorID, "900000-999999&tag=paranoia-level/1", []int{942100, 941100}},
+		{RuleSelectorID, "1-999999&TAG=/^attack-(sqli|xss)$/&msg=/libinjection/", []int{942100, 941100}},
+		{RuleSelectorTag, "attack-sqli", []int{942100, 942200}},
+		{RuleSelectorTag, "attack", nil},
+		{RuleSelectorTag, "/^paranoia-level\\/[12]$/", []int{942100, 942200, 941100}},
+		{RuleSelectorTag, "/attack-/&id=941000-941999", []int{941100}},
+		{RuleSelectorTag, "/a&b|rce/", []int{932100}},
+		{RuleSelectorMsg, "XSS Attack Detected via libinjection", []int{941100}},
+		{RuleSelectorMsg, "/^Detects MySQL comment-/", []int{942200}},
+		{RuleSelectorMsg, "Remote Command Execution: Unix Command Injection \\& more", []int{932100}},
+		{RuleSelectorMsg, "Remote Command Execution: Unix Command Injection & more", []int{932100}},
+		{RuleSelectorMsg, "/libinjection$/&tag=attack-sqli", []int{942100}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.selector, func(t *testing.T) {
+			s, err := ParseRuleSelector(tc.field, tc.selector)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var have []int
+			for _, r := range rg.FindBySelector(s) {
+				have = append(have, r.ID_)
+			}
+			if len(have) != len(tc.want) {
+				t.Fatalf("unexpected rules, want %v, have %v", tc.want, have)
+			}
+			for i := range have {
+				if have[i] != tc.want[i] {
+					t.Fatalf("unexpected rules, want %v, have %v", tc.want, have)
+				}
+			}
+		})
+	}
+
+	s, err := ParseRuleSelector(RuleSelectorTag, "attack-sqli")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rg.DeleteBySelector(s)
+	if want, have := 3, rg.Count(); want != have {
+		t.Errorf("unexpected number of rules, want %d, have %d", want, have)
+	}
+}
+
+func TestRuleSelectorRegexCache(t *testing.T) {
+	// the regexes are not shared with the other users of memoize, which may cache other
+	// types under the same string, e.g. @pm
+	_, _ = memoize.Do("^attack-", func() (interface{}, error) { return struct{}{}, nil })
+	if _, err := ParseRuleSelector(RuleSelectorTag, "/^attack-/"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRuleSelectorErrors(t *testing.T) {
+	tests := []struct {
+		field    RuleSelectorField
+		selector string
+	}{
+		{RuleSelectorID, ""},
+		{RuleSelectorID, "a"},
+		{RuleSelectorID, "-1"},
+		{RuleSelectorID, "2-1"},
+		{RuleSelectorID, "1-a"},
+		{RuleSelectorID, "/1/"},
+		{RuleSelectorID, "1&"},
+		{RuleSelectorID, "1&tag="},
+		{RuleSelectorTag, "/[a-/"},
+		{RuleSelectorTag, "a&id=x"},
+	}
+	for _, tc := range tests {
+		if _, err := ParseRuleSelector(tc.field, tc.selector); err == nil {
+			t.Errorf("expected error for %q", tc.selector)
+		}
+	}
+}
+
+func TestRuleSelectorID(t *testing.T) {
+	if id, ok := mustParseRuleSelector(t, RuleSelectorID, "5").ID(); !ok || id != 5 {
+		t.Errorf("unexpected ID, want 5, have %d", id)
+	}
+	for _, selector := range []string{"5-6", "5&tag=a"} {
+		if _, ok := mustParseRuleSelector(t, RuleSelectorID, selector).ID(); ok {
+			t.Errorf("unexpected ID for %q", selector)
+		}
+	}
+}
+
+func mustParseRuleSelector(t *testing.T, field RuleSelectorField, selector string) *RuleSelector {
+	t.Helper()
+	s, err := ParseRuleSelector(field, selector)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
@@ -5,6 +5,8 @@ package corazawaf
 
 import (
 	"fmt"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/corazawaf/coraza/v3/internal/corazatypes"
@@ -15,10 +17,26 @@ import (
 
 // RuleGroup is a collection of rules
 // It contains all helpers required to manage the rules
-// It is not concurrent safe, so it's not recommended to use it
-// after compilation
+// Rules are added and deleted while the WAF is configured, once transactions
+// may be evaluating them they must only be changed with Edit, which is
+// concurrent safe.
 type RuleGroup struct {
-	rules []Rule
+	// rules is replaced, never modified, once published so that the rules
+	// being evaluated don't change under the feet of the transactions
+	rules atomic.Pointer[[]Rule]
+	// mu serializes the changes of the rules
+	mu sync.Mutex
+}
+
+func (rg *RuleGroup) load() []Rule {
+	if rules := rg.rules.Load(); rules != nil {
+		return *rules
+	}
+	return nil
+}
+
+func (rg *RuleGroup) store(rules []Rule) {
+	rg.rules.Store(&rules)
 }
 
 // Add a rule to the collection
@@ -29,6 +47,9 @@ func (rg *RuleGroup) Add(rule *Rule) error {
 		return nil
 	}
 
+	rg.mu.Lock()
+	defer rg.mu.Unlock()
+
 	if rule.ID_ != 0 && rg.FindByID(rule.ID_) != nil {
 		return fmt.Errorf("there is a another rule with id %d", rule.ID_)
 	}
@@ -47,20 +68,24 @@ func (rg *RuleGroup) Add(rule *Rule) error {
 		}
 	}
 
-	rg.rules = append(rg.rules, *rule)
+	// appending doesn't modify the published rules, only the ones past their length
+	rg.store(append(rg.load(), *rule))
 	return nil
 }
 
 // GetRules returns the slice of rules,
+// it must not be modified, see Edit
 func (rg *RuleGroup) GetRules() []Rule {
-	return rg.rules
+	return rg.load()
 }
 
 // FindByID return a Rule with the requested Id
+// The rule must not be modified once the WAF is in use, see Edit
 func (rg *RuleGroup) FindByID(id int) *Rule {
-	for i, r := range rg.rules {
+	rules := rg.load()
+	for i, r := range rules {
 		if r.ID_ == id {
-			return &rg.rules[i]
+			return &rules[i]
 		}
 	}
 	return nil
@@ -68,50 +93,49 @@ func (rg *RuleGroup) FindByID(id int) *Rule {
 
 // DeleteByID removes a rule by its ID
 func (rg *RuleGroup) DeleteByID(id int) {
-	for i, r := range rg.rules {
-		if r.ID_ == id {
-			rg.rules = append(rg.rules[:i], rg.rules[i+1:]...)
-			return
-		}
-	}
+	rg.deleteFunc(func(r *Rule) bool {
+		return r.ID_ == id
+	})
 }
 
 // DeleteByRange removes rules by their ID in a range
 func (rg *RuleGroup) DeleteByRange(start, end int) {
-	var kept []Rule
-	for _, r := range rg.rules {
-		if r.ID_ < start || r.ID_ > end {
-			kept = append(kept, r)
-		}
-	}
-	rg.rules = kept
+	rg.deleteFunc(func(r *Rule) bool {
+		return r.ID_ >= start && r.ID_ <= end
+	})
 }
 
 // DeleteByMsg deletes rules with the given message.
 func (rg *RuleGroup) DeleteByMsg(msg string) {
-	var kept []Rule
-	for _, r := range rg.rules {
-		if r.Msg.String() != msg {
-			kept = append(kept, r)
-		}
-	}
-	rg.rules = kept
+	rg.deleteFunc(func(r *Rule) bool {
+		return r.Msg.String() == msg
+	})
 }
 
 // DeleteByTag deletes rules with the given tag.
 func (rg *RuleGroup) DeleteByTag(tag string) {
+	rg.deleteFunc(func(r *Rule) bool {
+		return utils.InSlice(tag, r.Tags_)
+	})
+}
+
+// deleteFunc publishes the rules without the ones matched by del
+func (rg *RuleGroup) deleteFunc(del func(r *Rule) bool) {
+	rg.mu.Lock()
+	defer rg.mu.Unlock()
 	var kept []Rule
-	for _, r := range rg.rules {
-		if !utils.InSlice(tag, r.Tags_) {
-			kept = append(kept, r)
+	rules := rg.load()
+	for i := range rules {
+		if !del(&rules[i]) {
+			kept = append(kept, rules[i])
 		}
 	}
-	rg.rules = kept
+	rg.store(kept)
 }
 
 // Count returns the count of rules
 func (rg *RuleGroup) Count() int {
-	return len(rg.rules)
+	return len(rg.load())
 }
 
 // Eval rules for the specified phase, between 1 and 5
@@ -130,9 +154,11 @@ func (rg *RuleGroup) Eval(phase types.RulePhase, tx *Transaction) bool {
 	for k := range transformationCache {
 		delete(transformationCache, k)
 	}
+	// the rules are loaded once, edits apply from the next phase on
+	rules := rg.load()
 RulesLoop:
-	for i := range rg.rules {
-		r := &rg.rules[i]
+	for i := range rules {
+		r := &rules[i]
 		// Check if a specific rule filter is applied to this transaction
 		// and if the current rule should be ignored according to the filter.
 		if tx.ruleFilter != nil {
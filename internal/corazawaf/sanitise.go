@@ -0,0 +1,287 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package corazawaf
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/corazawaf/coraza/v3/collection"
+	"github.com/corazawaf/coraza/v3/internal/collections"
+	"github.com/corazawaf/coraza/v3/types/variables"
+)
+
+// sanitisation holds the values to be masked in the audit log of a transaction,
+// as requested by the sanitise* actions.
+type sanitisation struct {
+	// args, requestHeaders and responseHeaders hold lowercase names
+	args            []string
+	requestHeaders  []string
+	responseHeaders []string
+	values          []sanitisedValue
+}
+
+// minSanitisedValueLen is the length under which a sanitised value is not masked
+// wherever it is found in the audit log, as masking every occurrence of a short value
+// like "1" would garble the whole log. Such values are only masked in their own field.
+const minSanitisedValueLen = 4
+
+// sanitisedValue is a value masked wherever it is found in the audit log, except for
+// its keepStart first and keepEnd last bytes.
+type sanitisedValue struct {
+	value     string
+	keepStart int
+	keepEnd   int
+}
+
+func (s *sanitisation) empty() bool {
+	return len(s.args) == 0 && len(s.requestHeaders) == 0 && len(s.responseHeaders) == 0 && len(s.values) == 0
+}
+
+func (s *sanitisation) reset() {
+	s.args = s.args[:0]
+	s.requestHeaders = s.requestHeaders[:0]
+	s.responseHeaders = s.responseHeaders[:0]
+	s.values = s.values[:0]
+}
+
+// SanitiseArg marks the argument for masking in the audit log, the argument is
+// masked in the request line, the request body and the matched data.
+func (tx *Transaction) SanitiseArg(name string) {
+	tx.sanitisation.args = appendLowerUnique(tx.sanitisation.args, name)
+}
+
+// SanitiseRequestHeader marks the request header for masking in the audit log
+func (tx *Transaction) SanitiseRequestHeader(name string) {
+	tx.sanitisation.requestHeaders = appendLowerUnique(tx.sanitisation.requestHeaders, name)
+}
+
+// SanitiseResponseHeader marks the response header for masking in the audit log
+func (tx *Transaction) SanitiseResponseHeader(name string) {
+	tx.sanitisation.responseHeaders = appendLowerUnique(tx.sanitisation.responseHeaders, name)
+}
+
+// SanitiseMatched marks the variable of the current match for masking in the audit log.
+// Arguments and headers are masked by name, other variables have their matched value
+// masked wherever it is found.
+func (tx *Transaction) SanitiseMatched() {
+	name, key, _ := strings.Cut(tx.variables.matchedVarName.Get(), ":")
+	switch name {
+	case variables.Args.Name(), variables.ArgsGet.Name(), variables.ArgsPost.Name(), variables.ArgsPath.Name():
+		tx.SanitiseArg(key)
+	case variables.RequestHeaders.Name():
+		tx.SanitiseRequestHeader(key)
+	case variables.ResponseHeaders.Name():
+		tx.SanitiseResponseHeader(key)
+	}
+	tx.sanitiseValue(tx.variables.matchedVar.Get(), 0, 0)
+}
+
+// SanitiseMatchedBytes masks the value of the current match wherever it is found in the
+// audit log, except for its keepStart first and keepEnd last bytes.
+func (tx *Transaction) SanitiseMatchedBytes(keepStart, keepEnd int) {
+	tx.sanitiseValue(tx.variables.matchedVar.Get(), keepStart, keepEnd)
+}
+
+func (tx *Transaction) sanitiseValue(value string, keepStart, keepEnd int) {
+	if value == "" {
+		return
+	}
+	tx.sanitisation.values = append(tx.sanitisation.values, sanitisedValue{
+		value:     value,
+		keepStart: keepStart,
+		keepEnd:   keepEnd,
+	})
+}
+
+func appendLowerUnique(list []string, name string) []string {
+	name = strings.ToLower(name)
+	for _, n := range list {
+		if n == name {
+			return list
+		}
+	}
+	return append(list, name)
+}
+
+// auditSanitiser masks the data of the audit log, it is shared by every part so that
+// all the formatters get the same masked data.
+type auditSanitiser struct {
+	argNames            map[string]struct{}
+	requestHeaderNames  map[string]struct{}
+	responseHeaderNames map[string]struct{}
+	replacer            *strings.Replacer
+}
+
+// auditSanitiser returns nil if nothing has to be masked
+func (tx *Transaction) auditSanitiser() *auditSanitiser {
+	s := &tx.sanitisation
+	if s.empty() {
+		return nil
+	}
+
+	as := &auditSanitiser{
+		argNames:            toSet(s.args),
+		requestHeaderNames:  toSet(s.requestHeaders),
+		responseHeaderNames: toSet(s.responseHeaders),
+	}
+
+	// Values of the sanitised arguments and headers are also masked everywhere, e.g. in
+	// JSON bodies or in the logdata of the matched rules, as long as they are not too
+	// short to be told apart from the rest of the log
+	values := append([]sanitisedValue{}, s.values...)
+	for _, md := range tx.variables.args.FindAll() {
+		if _, ok := as.argNames[strings.ToLower(md.Key())]; ok {
+			values = append(values, sanitisedValue{value: md.Value()})
+		}
+	}
+	for _, name := range s.requestHeaders {
+		for _, v := range tx.variables.requestHeaders.Get(name) {
+			values = append(values, sanitisedValue{value: v})
+		}
+	}
+	for _, name := range s.responseHeaders {
+		for _, v := range tx.variables.responseHeaders.Get(name) {
+			values = append(values, sanitisedValue{value: v})
+		}
+	}
+
+	// Longest values first, so that a value containing another one gets fully masked
+	sort.SliceStable(values, func(i, j int) bool { return len(values[i].value) > len(values[j].value) })
+	var oldnew []string
+	for _, v := range values {
+		if len(v.value) < minSanitisedValueLen {
+			continue
+		}
+		oldnew = append(oldnew, v.value, mask(v.value, v.keepStart, v.keepEnd))
+	}
+	if len(oldnew) > 0 {
+		as.replacer = strings.NewReplacer(oldnew...)
+	}
+	return as
+}
+
+// str masks the sanitised values found in s
+func (as *auditSanitiser) str(s string) string {
+	if as == nil || as.replacer == nil {
+		return s
+	}
+	return as.replacer.Replace(s)
+}
+
+// uri masks the sanitised arguments of the query string
+func (as *auditSanitiser) uri(uri string) string {
+	if as == nil {
+		return uri
+	}
+	if path, query, ok := strings.Cut(uri, "?"); ok {
+		return as.str(path) + "?" + as.query(query)
+	}
+	return as.str(uri)
+}
+
+// query masks the sanitised arguments of a query string or urlencoded body
+func (as *auditSanitiser) query(query string) string {
+	if as == nil {
+		return query
+	}
+	if len(as.argNames) > 0 {
+		pairs := strings.Split(query, "&")
+		for i, pair := range pairs {
+			key, value, ok := strings.Cut(pair, "=")
+			if !ok {
+				continue
+			}
+			if k, err := url.QueryUnescape(key); err == nil {
+				key = k
+			}
+			if _, ok := as.argNames[strings.ToLower(key)]; ok {
+				pairs[i] = pair[:len(pair)-len(value)] + mask(value, 0, 0)
+			}
+		}
+		query = strings.Join(pairs, "&")
+	}
+	return as.str(query)
+}
+
+// requestHeaders returns a copy of the request headers with the sanitised ones masked
+func (as *auditSanitiser) requestHeaders(headers map[string][]string) map[string][]string {
+	if as == nil {
+		return headers
+	}
+	return as.headers(headers, as.requestHeaderNames)
+}
+
+// responseHeaders returns a copy of the response headers with the sanitised ones masked
+func (as *auditSanitiser) responseHeaders(headers map[string][]string) map[string][]string {
+	if as == nil {
+		return headers
+	}
+	return as.headers(headers, as.responseHeaderNames)
+}
+
+func (as *auditSanitiser) headers(headers map[string][]string, names map[string]struct{}) map[string][]string {
+	res := make(map[string][]string, len(headers))
+	for k, vv := range headers {
+		_, sanitised := names[strings.ToLower(k)]
+		masked := make([]string, len(vv))
+		for i, v := range vv {
+			if sanitised {
+				masked[i] = mask(v, 0, 0)
+			} else {
+				masked[i] = as.str(v)
+			}
+		}
+		res[k] = masked
+	}
+	return res
+}
+
+// argsCollection returns a copy of the arguments with the sanitised ones masked
+func (as *auditSanitiser) argsCollection(tx *Transaction) *collections.ConcatKeyed {
+	if as == nil {
+		return tx.variables.args
+	}
+	cols := []struct {
+		variable variables.RuleVariable
+		col      *collections.NamedCollection
+	}{
+		{variables.ArgsGet, tx.variables.argsGet},
+		{variables.ArgsPost, tx.variables.argsPost},
+		{variables.ArgsPath, tx.variables.argsPath},
+	}
+	masked := make([]collection.Keyed, 0, len(cols))
+	for _, col := range cols {
+		c := collections.NewCaseSensitiveNamedCollection(col.variable)
+		for _, md := range col.col.FindAll() {
+			value := md.Value()
+			if _, ok := as.argNames[strings.ToLower(md.Key())]; ok {
+				value = mask(value, 0, 0)
+			} else {
+				value = as.str(value)
+			}
+			c.Add(md.Key(), value)
+		}
+		masked = append(masked, c)
+	}
+	return collections.NewConcatKeyed(variables.Args, masked...)
+}
+
+func toSet(list []string) map[string]struct{} {
+	set := make(map[string]struct{}, len(list))
+	for _, v := range list {
+		set[v] = struct{}{}
+	}
+	return set
+}
+
+// mask replaces the characters of the value with asterisks, except for its keepStart
+// first and keepEnd last bytes. Values too short to keep them are fully masked.
+func mask(value string, keepStart, keepEnd int) string {
+	if keepStart < 0 || keepEnd < 0 || keepStart+keepEnd >= len(value) {
+		keepStart, keepEnd = 0, 0
+	}
+	return value[:keepStart] + strings.Repeat("*", len(value)-keepStart-keepEnd) + value[len(value)-keepEnd:]
+}
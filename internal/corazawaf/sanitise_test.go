@@ -0,0 +1,129 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package corazawaf
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/corazawaf/coraza/v3/internal/auditlog"
+	"github.com/corazawaf/coraza/v3/internal/corazarules"
+	"github.com/corazawaf/coraza/v3/types"
+	"github.com/corazawaf/coraza/v3/types/variables"
+)
+
+func TestSanitiseAuditLog(t *testing.T) {
+	waf := NewWAF()
+	waf.RequestBodyAccess = true
+	tx := waf.NewTransaction()
+	defer tx.Close()
+
+	tx.AuditLogParts = types.AuditLogParts("ABCFHK")
+	tx.ProcessURI("/login?user=bob&Password=s3cret", "POST", "HTTP/1.1")
+	tx.AddRequestHeader("Authorization", "Bearer xyz0123")
+	tx.AddRequestHeader("Content-Type", "application/x-www-form-urlencoded")
+	tx.ProcessRequestHeaders()
+	if _, _, err := tx.WriteRequestBody([]byte("password=s3cret&card=4111111111111111")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.ProcessRequestBody(); err != nil {
+		t.Fatal(err)
+	}
+	tx.AddResponseHeader("Set-Cookie", "session=4b5c6d7e")
+	tx.ProcessResponseHeaders(200, "HTTP/1.1")
+
+	tx.SanitiseArg("password")
+	tx.SanitiseRequestHeader("authorization")
+	tx.matchVariable(&corazarules.MatchData{Variable_: variables.ResponseHeaders, Key_: "set-cookie", Value_: "session=4b5c6d7e"})
+	tx.SanitiseMatched()
+	tx.matchVariable(&corazarules.MatchData{Variable_: variables.ArgsPost, Key_: "card", Value_: "4111111111111111"})
+	tx.SanitiseMatchedBytes(0, 4)
+
+	r := NewRule()
+	r.ID_ = 1
+	r.Log = true
+	tx.MatchRule(r, []types.MatchData{&corazarules.MatchData{
+		Message_: "Card 4111111111111111",
+		Data_:    "password s3cret, Bearer xyz0123",
+	}})
+
+	for _, name := range []string{"json", "jsonlegacy", "native", "ocsf"} {
+		f, err := auditlog.GetFormatter(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := f.Format(tx.AuditLog())
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, secret := range []string{"s3cret", "xyz0123", "4b5c6d7e", "4111111111111111"} {
+			if strings.Contains(string(out), secret) {
+				t.Errorf("unexpected %q in %s audit log: %s", secret, name, out)
+			}
+		}
+		if !strings.Contains(string(out), "************1111") {
+			t.Errorf("expected partially masked card number in %s audit log: %s", name, out)
+		}
+	}
+
+	// The transaction data is left untouched
+	if want, have := "s3cret", tx.variables.argsGet.Get("password")[0]; want != have {
+		t.Errorf("unexpected argument value, want %q, have %q", want, have)
+	}
+}
+
+func TestSanitiseQuery(t *testing.T) {
+	tx := NewWAF().NewTransaction()
+	defer tx.Close()
+	tx.SanitiseArg("pass word")
+
+	as := tx.auditSanitiser()
+	if want, have := "/a?pass%20word=****&b=1&c", as.uri("/a?pass%20word=1234&b=1&c"); want != have {
+		t.Errorf("unexpected uri, want %q, have %q", want, have)
+	}
+}
+
+func TestSanitiseShortValue(t *testing.T) {
+	tx := NewWAF().NewTransaction()
+	defer tx.Close()
+	tx.ProcessURI("/v1?a=1&b=1", "GET", "HTTP/1.1")
+	tx.SanitiseArg("a")
+	tx.matchVariable(&corazarules.MatchData{Variable_: variables.RequestURI, Value_: "1"})
+	tx.SanitiseMatchedBytes(0, 0)
+
+	as := tx.auditSanitiser()
+	if want, have := "/v1?a=*&b=1", as.uri("/v1?a=1&b=1"); want != have {
+		t.Errorf("unexpected uri, want %q, have %q", want, have)
+	}
+	if want, have := "Rule 1001 matched 1 time", as.str("Rule 1001 matched 1 time"); want != have {
+		t.Errorf("unexpected message, want %q, have %q", want, have)
+	}
+	args := as.argsCollection(tx)
+	if want, have := "*", args.Get("a")[0]; want != have {
+		t.Errorf("unexpected argument a, want %q, have %q", want, have)
+	}
+	if want, have := "1", args.Get("b")[0]; want != have {
+		t.Errorf("unexpected argument b, want %q, have %q", want, have)
+	}
+}
+
+func TestMask(t *testing.T) {
+	tests := []struct {
+		value     string
+		keepStart int
+		keepEnd   int
+		want      string
+	}{
+		{"secret", 0, 0, "******"},
+		{"4111111111111111", 0, 4, "************1111"},
+		{"4111111111111111", 4, 4, "4111********1111"},
+		{"abc", 2, 2, "***"},
+		{"", 0, 0, ""},
+	}
+	for _, tc := range tests {
+		if have := mask(tc.value, tc.keepStart, tc.keepEnd); tc.want != have {
+			t.Errorf("unexpected mask for %q, want %q, have %q", tc.value, tc.want, have)
+		}
+	}
+}
@@ -0,0 +1,307 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package corazawaf
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/corazawaf/coraza/v3/types"
+)
+
+// Scope is a configuration context, like a virtual host or a location, overriding
+// the configuration of the WAF for the transactions it matches. The rules of a scope
+// are the rules it inherits, from the WAF or from its parent scope, plus its own
+// rules and exclusions. Inherited rules are not compiled again, they are shared
+// with the WAF and copied on write.
+type Scope struct {
+	// Hosts are the lowercase server names matched by the scope, a leading "*."
+	// matches any subdomain. The scope matches any host if empty.
+	Hosts []string
+	// PathPrefix is the prefix of the request path matched by the scope
+	PathPrefix string
+
+	// Overrides of the WAF settings, nil if the scope inherits them
+	RuleEngine         *types.RuleEngineStatus
+	RequestBodyAccess  *bool
+	RequestBodyLimit   *int64
+	ResponseBodyAccess *bool
+	ResponseBodyLimit  *int64
+
+	parent *Scope
+	// rules are the rules defined in the scope, chained rules are attached to them
+	rules RuleGroup
+	// edits are the rules added to and the exclusions applied to the inherited rules,
+	// in the order of the configuration
+	edits []func(e *RuleEditor) error
+
+	mu     sync.Mutex
+	merged atomic.Pointer[scopeRules]
+}
+
+// scopeRules are the rules of a scope merged with the inherited rules they derive from
+type scopeRules struct {
+	inherited *[]Rule
+	rules     RuleGroup
+}
+
+// NewScope returns a scope matching the hosts and the path prefix. Scopes created
+// with a parent, e.g. a location within a virtual host, inherit its configuration.
+func NewScope(parent *Scope, hosts []string, pathPrefix string) *Scope {
+	s := &Scope{
+		PathPrefix: pathPrefix,
+		parent:     parent,
+	}
+	for _, h := range hosts {
+		// ports are ignored, e.g. <VirtualHost *:443>
+		if host, _, err := net.SplitHostPort(h); err == nil {
+			h = host
+		}
+		s.Hosts = append(s.Hosts, strings.ToLower(h))
+	}
+	if parent != nil && len(s.Hosts) == 0 {
+		s.Hosts = parent.Hosts
+	}
+	return s
+}
+
+// Parent returns the scope the scope inherits from, nil if it inherits from the WAF
+func (s *Scope) Parent() *Scope {
+	return s.parent
+}
+
+// AddRule adds a rule to the scope, a rule with the ID of an inherited rule replaces it.
+// Will return an error if the ID is already used in the scope.
+func (s *Scope) AddRule(rule *Rule) error {
+	if rule == nil {
+		// chained rules are attached to their parent
+		return nil
+	}
+	if err := s.rules.Add(rule); err != nil {
+		return err
+	}
+	i := s.rules.Count() - 1
+	s.edits = append(s.edits, func(e *RuleEditor) error {
+		e.Set(s.rules.GetRules()[i])
+		return nil
+	})
+	return nil
+}
+
+// Rules returns the rules defined in the scope, excluding the inherited ones
+func (s *Scope) Rules() *RuleGroup {
+	return &s.rules
+}
+
+// EditRules registers an edit of the rules of the scope, like the removal of rules or the
+// update of their targets. Edits are applied once the inherited rules are known.
+func (s *Scope) EditRules(edit func(e *RuleEditor) error) {
+	s.edits = append(s.edits, edit)
+}
+
+// matches returns whether the scope matches the request and its specificity, scopes
+// with hosts are more specific than scopes without, then longer prefixes win.
+func (s *Scope) matches(host, path string) (bool, int) {
+	specificity := len(s.PathPrefix)
+	if len(s.Hosts) > 0 {
+		if !s.matchesHost(host) {
+			return false, 0
+		}
+		// paths can't be longer than this
+		specificity += 1 << 30
+	}
+	if !strings.HasPrefix(path, s.PathPrefix) {
+		return false, 0
+	}
+	return true, specificity
+}
+
+func (s *Scope) matchesHost(host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(host)
+	for _, h := range s.Hosts {
+		if h == "*" || h == host {
+			return true
+		}
+		if suffix, ok := strings.CutPrefix(h, "*"); ok && strings.HasPrefix(suffix, ".") && strings.HasSuffix(host, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Apply merges the rules of the scope with the inherited ones and returns the errors of
+// its edits, e.g. the update of a rule not found. The parser applies a scope when its block
+// is closed, the rules are merged again on use only if the inherited rules change.
+func (s *Scope) Apply(w *WAF) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, err := s.merge(w)
+	s.merged.Store(m)
+	return err
+}
+
+// ruleGroup returns the rules evaluated for the transactions matching the scope, they
+// are merged again if the inherited rules were edited since the scope was applied.
+func (s *Scope) ruleGroup(w *WAF) *RuleGroup {
+	inherited := &w.Rules
+	if s.parent != nil {
+		inherited = s.parent.ruleGroup(w)
+	}
+	base := inherited.rules.Load()
+	if m := s.merged.Load(); m != nil && m.inherited == base {
+		return &m.rules
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if m := s.merged.Load(); m != nil && m.inherited == base {
+		return &m.rules
+	}
+	m, err := s.merge(w)
+	if err != nil {
+		w.Logger.Error().
+			Str("path_prefix", s.PathPrefix).
+			Err(err).
+			Msg("Failed to apply the rules of the scope")
+	}
+	s.merged.Store(m)
+	return &m.rules
+}
+
+// merge applies the edits of the scope to the inherited rules, the edits failing are
+// skipped. It must be called with the lock held.
+func (s *Scope) merge(w *WAF) (*scopeRules, error) {
+	inherited := &w.Rules
+	if s.parent != nil {
+		inherited = s.parent.ruleGroup(w)
+	}
+	base := inherited.rules.Load()
+	m := &scopeRules{inherited: base}
+	if base != nil {
+		// rules are shared with the inherited ones until edited
+		m.rules.store(*base)
+	}
+	var errs []error
+	_ = m.rules.Edit(func(e *RuleEditor) error {
+		for _, edit := range s.edits {
+			if err := edit(e); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		return nil
+	})
+	return m, errors.Join(errs...)
+}
+
+// ruleEngine, requestBodyAccess and the following methods resolve the settings of the
+// scope, falling back to the ones of the parent scope and finally of the WAF.
+func (s *Scope) ruleEngine(w *WAF) types.RuleEngineStatus {
+	for ; s != nil; s = s.parent {
+		if s.RuleEngine != nil {
+			return *s.RuleEngine
+		}
+	}
+	return w.RuleEngine
+}
+
+func (s *Scope) requestBodyAccess(w *WAF) bool {
+	for ; s != nil; s = s.parent {
+		if s.RequestBodyAccess != nil {
+			return *s.RequestBodyAccess
+		}
+	}
+	return w.RequestBodyAccess
+}
+
+func (s *Scope) requestBodyLimit(w *WAF) int64 {
+	for ; s != nil; s = s.parent {
+		if s.RequestBodyLimit != nil {
+			return *s.RequestBodyLimit
+		}
+	}
+	return w.RequestBodyLimit
+}
+
+func (s *Scope) responseBodyAccess(w *WAF) bool {
+	for ; s != nil; s = s.parent {
+		if s.ResponseBodyAccess != nil {
+			return *s.ResponseBodyAccess
+		}
+	}
+	return w.ResponseBodyAccess
+}
+
+func (s *Scope) responseBodyLimit(w *WAF) int64 {
+	for ; s != nil; s = s.parent {
+		if s.ResponseBodyLimit != nil {
+			return *s.ResponseBodyLimit
+		}
+	}
+	return w.ResponseBodyLimit
+}
+
+// selectScope picks the most specific scope matching the server name and the path of
+// the request, and applies its settings. It is called as soon as either is known.
+func (tx *Transaction) selectScope() {
+	if len(tx.WAF.Scopes) == 0 || tx.lastPhase >= types.PhaseRequestHeaders {
+		return
+	}
+	var (
+		scope       *Scope
+		specificity = -1
+	)
+	host := tx.variables.serverName.Get()
+	path := tx.variables.requestFilename.Get()
+	for _, s := range tx.WAF.Scopes {
+		if ok, sp := s.matches(host, path); ok && sp > specificity {
+			scope, specificity = s, sp
+		}
+	}
+	if scope != tx.scope {
+		tx.setScope(scope)
+	}
+}
+
+// setScope applies the settings of the scope to the transaction, the ones of the WAF
+// if scope is nil.
+func (tx *Transaction) setScope(scope *Scope) {
+	w := tx.WAF
+	tx.scope = scope
+	tx.RuleEngine = scope.ruleEngine(w)
+	tx.RequestBodyAccess = scope.requestBodyAccess(w)
+	tx.RequestBodyLimit = scope.requestBodyLimit(w)
+	tx.ResponseBodyAccess = scope.responseBodyAccess(w)
+	tx.ResponseBodyLimit = scope.responseBodyLimit(w)
+
+	// if no requestBodyInMemoryLimit has been set we default to the requestBodyLimit
+	requestBodyInMemoryLimit := tx.RequestBodyLimit
+	if w.requestBodyInMemoryLimit != nil && *w.requestBodyInMemoryLimit < requestBodyInMemoryLimit {
+		requestBodyInMemoryLimit = *w.requestBodyInMemoryLimit
+	}
+	tx.requestBodyBuffer.options.MemoryLimit = requestBodyInMemoryLimit
+	tx.requestBodyBuffer.options.Limit = tx.RequestBodyLimit
+	tx.responseBodyBuffer.options.MemoryLimit = tx.ResponseBodyLimit
+	tx.responseBodyBuffer.options.Limit = tx.ResponseBodyLimit
+
+	if scope != nil {
+		tx.debugLogger.Debug().
+			Str("path_prefix", scope.PathPrefix).
+			Str("hosts", strings.Join(scope.Hosts, " ")).
+			Msg("Selected configuration scope")
+	}
+}
+
+// Rules returns the rules evaluated for the transaction, the ones of its scope if any
+func (tx *Transaction) Rules() *RuleGroup {
+	if tx.scope != nil {
+		return tx.scope.ruleGroup(tx.WAF)
+	}
+	return &tx.WAF.Rules
+}
@@ -0,0 +1,112 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package corazawaf
+
+import (
+	"testing"
+
+	"github.com/corazawaf/coraza/v3/types"
+)
+
+func TestScopeMatches(t *testing.T) {
+	vhost := NewScope(nil, []string{"Example.com:8080", "*.example.org"}, "")
+	location := NewScope(vhost, nil, "/admin")
+	tests := []struct {
+		scope       *Scope
+		host        string
+		path        string
+		matches     bool
+		specificity int
+	}{
+		{vhost, "example.com", "/", true, 1 << 30},
+		{vhost, "EXAMPLE.COM:80", "/", true, 1 << 30},
+		{vhost, "www.example.org", "/", true, 1 << 30},
+		{vhost, "example.org", "/", false, 0},
+		{location, "example.com", "/admin/users", true, 1<<30 + 6},
+		{location, "example.com", "/", false, 0},
+		{NewScope(nil, nil, "/admin"), "", "/admin", true, 6},
+	}
+	for _, tc := range tests {
+		matches, specificity := tc.scope.matches(tc.host, tc.path)
+		if matches != tc.matches || specificity != tc.specificity {
+			t.Errorf("unexpected match of %q%s, want %t (%d), have %t (%d)",
+				tc.host, tc.path, tc.matches, tc.specificity, matches, specificity)
+		}
+	}
+}
+
+func TestScopeSettings(t *testing.T) {
+	waf := NewWAF()
+	waf.RuleEngine = types.RuleEngineOn
+	waf.RequestBodyAccess = true
+	waf.RequestBodyLimit = 5
+
+	limit := int64(20)
+	engine := types.RuleEngineDetectionOnly
+	upload := NewScope(nil, nil, "/upload")
+	upload.RequestBodyLimit = &limit
+	upload.RuleEngine = &engine
+	waf.Scopes = append(waf.Scopes, upload)
+
+	tx := waf.NewTransaction()
+	tx.ProcessURI("/upload/file", "POST", "HTTP/1.1")
+	if want, have := types.RuleEngineDetectionOnly, tx.RuleEngine; want != have {
+		t.Errorf("unexpected rule engine, want %s, have %s", want, have)
+	}
+	tx.ProcessRequestHeaders()
+	// The limit of the scope is bigger than the one of the WAF
+	it, _, err := tx.WriteRequestBody([]byte("0123456789"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if it != nil {
+		t.Errorf("unexpected interruption with status %d", it.Status)
+	}
+	if err := tx.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The settings of the WAF are restored for the next transactions
+	tx = waf.NewTransaction()
+	defer tx.Close()
+	tx.ProcessURI("/", "POST", "HTTP/1.1")
+	if want, have := types.RuleEngineOn, tx.RuleEngine; want != have {
+		t.Errorf("unexpected rule engine, want %s, have %s", want, have)
+	}
+	if want, have := int64(5), tx.requestBodyBuffer.options.Limit; want != have {
+		t.Errorf("unexpected request body limit, want %d, have %d", want, have)
+	}
+}
+
+func TestScopeRulesAfterEdit(t *testing.T) {
+	waf := NewWAF()
+	for i := 1; i <= 2; i++ {
+		if err := waf.Rules.Add(newTestRule(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	scope := NewScope(nil, nil, "/admin")
+	scope.EditRules(func(e *RuleEditor) error {
+		e.Delete(mustParseRuleSelector(t, RuleSelectorID, "1"))
+		return nil
+	})
+	if want, have := 1, scope.ruleGroup(waf).Count(); want != have {
+		t.Fatalf("unexpected rules, want %d, have %d", want, have)
+	}
+
+	// the scope merges the rules of the WAF again once they are edited
+	if err := waf.Rules.Edit(func(e *RuleEditor) error {
+		e.Set(*newTestRule(3))
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	rules := scope.ruleGroup(waf)
+	if want, have := 2, rules.Count(); want != have {
+		t.Fatalf("unexpected rules, want %d, have %d", want, have)
+	}
+	if rules.FindByID(1) != nil || rules.FindByID(3) == nil {
+		t.Error("unexpected rules of the scope")
+	}
+}
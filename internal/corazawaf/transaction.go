@@ -5,6 +5,7 @@ package corazawaf
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
@@ -90,6 +91,18 @@ type Transaction struct {
 	// Handles response body buffers
 	responseBodyBuffer *BodyBuffer
 
+	// modifiedResponseBody holds the response body once its links have been
+	// signed by the hash engine or content has been injected by prepend/append
+	modifiedResponseBody []byte
+
+	// responseBodyPrepend and responseBodyAppend hold the content injected
+	// in the response body by the prepend and append actions
+	responseBodyPrepend []byte
+	responseBodyAppend  []byte
+
+	// sanitisation holds what the sanitise actions mark for masking in the audit log
+	sanitisation sanitisation
+
 	// Rules with this id are going to be skipped while processing a phase
 	ruleRemoveByID []int
 
@@ -110,6 +123,12 @@ type Transaction struct {
 	// Contains duration in useconds per phase
 	stopWatches map[types.RulePhase]int64
 
+	// slowRules are the rule evaluations above the RulePerfTime of the WAF
+	slowRules []slowRule
+	// operatorTime is the time spent in the operators of the rule being evaluated,
+	// only measured if RulePerfTime is set
+	operatorTime time.Duration
+
 	// Contains a WAF instance for the current transaction
 	WAF *WAF
 
@@ -129,6 +148,9 @@ type Transaction struct {
 	// ruleFilter allows applying custom rule filtering logic per transaction.
 	// If set, it's used during rule evaluation to determine if a rule should be skipped.
 	ruleFilter rftypes.RuleFilter
+
+	// scope is the configuration scope matching the transaction, if any
+	scope *Scope
 }
 
 func (tx *Transaction) SetScriptFilename(value string) {
@@ -347,7 +369,19 @@ func (tx *Transaction) SetDebugLogLevel(lvl debuglog.Level) {
 	tx.debugLogger = tx.debugLogger.WithLevel(lvl)
 }
 
+// Env returns the environment variables set for the transaction by the setenv action
+func (tx *Transaction) Env() map[string]string {
+	env := map[string]string{}
+	for _, md := range tx.variables.env.FindAll() {
+		env[md.Key()] = md.Value()
+	}
+	return env
+}
+
 func (tx *Transaction) ResponseBodyReader() (io.Reader, error) {
+	if tx.modifiedResponseBody != nil {
+		return bytes.NewReader(tx.modifiedResponseBody), nil
+	}
 	return tx.responseBodyBuffer.Reader()
 }
 
@@ -390,7 +424,7 @@ func (tx *Transaction) AddRequestHeader(key string, value string) {
 		//   cookie-string = cookie-pair *( ";" SP cookie-pair )
 		//
 		// There is no URL Decode performed no the cookies
-		values := cookies.ParseCookies(value)
+		values := cookies.Parse(value, tx.WAF.CookieFormat)
 		for k, vr := range values {
 			for _, v := range vr {
 				tx.variables.requestCookies.Add(k, v)
@@ -721,7 +755,7 @@ func (tx *Transaction) ProcessConnection(client string, cPort int, server string
 
 // ExtractGetArguments transforms an url encoded string to a map and creates ARGS_GET
 func (tx *Transaction) ExtractGetArguments(uri string) {
-	data := urlutil.ParseQuery(uri, '&')
+	data := urlutil.ParseQuery(uri, tx.WAF.ArgumentSeparator)
 	for k, vs := range data {
 		for _, v := range vs {
 			tx.AddGetRequestArgument(k, v)
@@ -826,6 +860,7 @@ func (tx *Transaction) ProcessURI(uri string, method string, httpVersion string)
 	tx.variables.requestFilename.Set(path)
 
 	tx.variables.queryString.Set(query)
+	tx.selectScope()
 }
 
 // SetServerName allows to set server name details.
@@ -837,6 +872,7 @@ func (tx *Transaction) SetServerName(serverName string) {
 		tx.debugLogger.Warn().Msg("SetServerName has been called after ProcessRequestHeaders")
 	}
 	tx.variables.serverName.Set(serverName)
+	tx.selectScope()
 }
 
 // ProcessRequestHeaders Performs the analysis on the request readers.
@@ -861,7 +897,7 @@ func (tx *Transaction) ProcessRequestHeaders() *types.Interruption {
 		return tx.interruption
 	}
 
-	tx.WAF.Rules.Eval(types.PhaseRequestHeaders, tx)
+	tx.Rules().Eval(types.PhaseRequestHeaders, tx)
 	return tx.interruption
 }
 
@@ -1047,7 +1083,7 @@ func (tx *Transaction) ProcessRequestBody() (*types.Interruption, error) {
 
 	// we won't process empty request bodies or disabled RequestBodyAccess
 	if !tx.RequestBodyAccess || tx.requestBodyBuffer.length == 0 {
-		tx.WAF.Rules.Eval(types.PhaseRequestBody, tx)
+		tx.Rules().Eval(types.PhaseRequestBody, tx)
 		return tx.interruption, nil
 	}
 	mime := ""
@@ -1074,13 +1110,13 @@ func (tx *Transaction) ProcessRequestBody() (*types.Interruption, error) {
 	rbp = strings.ToLower(rbp)
 	if rbp == "" {
 		// so there is no bodyprocessor, we don't want to generate an error
-		tx.WAF.Rules.Eval(types.PhaseRequestBody, tx)
+		tx.Rules().Eval(types.PhaseRequestBody, tx)
 		return tx.interruption, nil
 	}
 	bodyprocessor, err := bodyprocessors.GetBodyProcessor(rbp)
 	if err != nil {
 		tx.generateRequestBodyError(errors.New("invalid body processor"))
-		tx.WAF.Rules.Eval(types.PhaseRequestBody, tx)
+		tx.Rules().Eval(types.PhaseRequestBody, tx)
 		return tx.interruption, nil
 	}
 
@@ -1089,16 +1125,17 @@ func (tx *Transaction) ProcessRequestBody() (*types.Interruption, error) {
 		Msg("Attempting to process request body")
 
 	if err := bodyprocessor.ProcessRequest(reader, tx.Variables(), plugintypes.BodyProcessorOptions{
-		Mime:        mime,
-		StoragePath: tx.WAF.UploadDir,
+		Mime:              mime,
+		StoragePath:       tx.WAF.UploadDir,
+		ArgumentSeparator: tx.WAF.ArgumentSeparator,
 	}); err != nil {
 		tx.debugLogger.Error().Err(err).Msg("Failed to process request body")
 		tx.generateRequestBodyError(err)
-		tx.WAF.Rules.Eval(types.PhaseRequestBody, tx)
+		tx.Rules().Eval(types.PhaseRequestBody, tx)
 		return tx.interruption, nil
 	}
 
-	tx.WAF.Rules.Eval(types.PhaseRequestBody, tx)
+	tx.Rules().Eval(types.PhaseRequestBody, tx)
 	return tx.interruption, nil
 }
 
@@ -1128,7 +1165,7 @@ func (tx *Transaction) ProcessResponseHeaders(code int, proto string) *types.Int
 	tx.variables.responseStatus.Set(c)
 	tx.variables.responseProtocol.Set(proto)
 
-	tx.WAF.Rules.Eval(types.PhaseResponseHeaders, tx)
+	tx.Rules().Eval(types.PhaseResponseHeaders, tx)
 	return tx.interruption
 }
 
@@ -1302,7 +1339,7 @@ func (tx *Transaction) ProcessResponseBody() (*types.Interruption, error) {
 		tx.debugLogger.Debug().
 			Bool("response_body_access", tx.ResponseBodyAccess).
 			Msg("Skipping response body processing")
-		tx.WAF.Rules.Eval(types.PhaseResponseBody, tx)
+		tx.Rules().Eval(types.PhaseResponseBody, tx)
 		return tx.interruption, nil
 	}
 
@@ -1315,7 +1352,7 @@ func (tx *Transaction) ProcessResponseBody() (*types.Interruption, error) {
 		b, err := bodyprocessors.GetBodyProcessor(bp)
 		if err != nil {
 			tx.generateResponseBodyError(errors.New("invalid body processor"))
-			tx.WAF.Rules.Eval(types.PhaseResponseBody, tx)
+			tx.Rules().Eval(types.PhaseResponseBody, tx)
 			return tx.interruption, err
 		}
 
@@ -1334,7 +1371,11 @@ func (tx *Transaction) ProcessResponseBody() (*types.Interruption, error) {
 		tx.variables.responseContentLength.Set(strconv.FormatInt(length, 10))
 		tx.variables.responseBody.Set(buf.String())
 	}
-	tx.WAF.Rules.Eval(types.PhaseResponseBody, tx)
+	tx.Rules().Eval(types.PhaseResponseBody, tx)
+	if tx.interruption == nil {
+		tx.signResponseBody()
+		tx.injectResponseBody()
+	}
 	return tx.interruption, nil
 }
 
@@ -1346,7 +1387,7 @@ func (tx *Transaction) ProcessLogging() {
 	// This avoids trying to rely on variables not set by previous rules that
 	// have not been executed
 	if tx.RuleEngine != types.RuleEngineOff {
-		tx.WAF.Rules.Eval(types.PhaseLogging, tx)
+		tx.Rules().Eval(types.PhaseLogging, tx)
 	}
 
 	if tx.AuditEngine == types.AuditEngineOff {
@@ -1426,6 +1467,8 @@ func (tx *Transaction) LastPhase() types.RulePhase {
 func (tx *Transaction) AuditLog() *auditlog.Log {
 	al := &auditlog.Log{}
 	al.Parts_ = tx.AuditLogParts
+	// sanitiser is nil if no value was marked for masking
+	sanitiser := tx.auditSanitiser()
 
 	clientPort, _ := strconv.Atoi(tx.variables.remotePort.Get())
 	hostPort, _ := strconv.Atoi(tx.variables.serverPort.Get())
@@ -1454,9 +1497,9 @@ func (tx *Transaction) AuditLog() *auditlog.Log {
 		ServerID_:      tx.variables.serverName.Get(), // TODO check
 		Request_: &auditlog.TransactionRequest{
 			Method_:   tx.variables.requestMethod.Get(),
-			URI_:      tx.variables.requestURI.Get(),
+			URI_:      sanitiser.uri(tx.variables.requestURI.Get()),
 			Protocol_: tx.variables.requestProtocol.Get(),
-			Args_:     tx.variables.args,
+			Args_:     sanitiser.argsCollection(tx),
 			Length_:   int32(requestLength),
 		},
 		IsInterrupted_: tx.IsInterrupted(),
@@ -1466,13 +1509,17 @@ func (tx *Transaction) AuditLog() *auditlog.Log {
 	for _, part := range tx.AuditLogParts {
 		switch part {
 		case types.AuditLogPartRequestHeaders:
-			al.Transaction_.Request_.Headers_ = tx.variables.requestHeaders.Data()
+			al.Transaction_.Request_.Headers_ = sanitiser.requestHeaders(tx.variables.requestHeaders.Data())
 		case types.AuditLogPartRequestBody:
 			reader, err := tx.requestBodyBuffer.Reader()
 			if err == nil {
 				content, err := io.ReadAll(reader)
 				if err == nil {
-					al.Transaction_.Request_.Body_ = string(content)
+					if tx.variables.reqbodyProcessor.Get() == "URLENCODED" {
+						al.Transaction_.Request_.Body_ = sanitiser.query(string(content))
+					} else {
+						al.Transaction_.Request_.Body_ = sanitiser.str(string(content))
+					}
 				}
 			}
 
@@ -1506,14 +1553,14 @@ func (tx *Transaction) AuditLog() *auditlog.Log {
 			if al.Transaction_.Response_ == nil {
 				al.Transaction_.Response_ = &auditlog.TransactionResponse{}
 			}
-			al.Transaction_.Response_.Body_ = tx.variables.responseBody.Get()
+			al.Transaction_.Response_.Body_ = sanitiser.str(tx.variables.responseBody.Get())
 		case types.AuditLogPartResponseHeaders:
 			if al.Transaction_.Response_ == nil {
 				al.Transaction_.Response_ = &auditlog.TransactionResponse{}
 			}
 			status, _ := strconv.Atoi(tx.variables.responseStatus.Get())
 			al.Transaction_.Response_.Status_ = status
-			al.Transaction_.Response_.Headers_ = tx.variables.responseHeaders.Data()
+			al.Transaction_.Response_.Headers_ = sanitiser.responseHeaders(tx.variables.responseHeaders.Data())
 		case types.AuditLogPartAuditLogTrailer:
 			auditLogPartAuditLogTrailerSet = true
 			al.Transaction_.Producer_ = &auditlog.TransactionProducer{
@@ -1523,6 +1570,8 @@ func (tx *Transaction) AuditLog() *auditlog.Log {
 				RuleEngine_: tx.RuleEngine.String(),
 				Stopwatch_:  tx.GetStopWatch(),
 				Rulesets_:   tx.WAF.ComponentNames,
+
+				RulesPerformanceInfo_: tx.rulesPerformanceInfo(),
 			}
 		case types.AuditLogPartRulesMatched:
 			auditLogPartRulesMatchedSet = true
@@ -1536,14 +1585,14 @@ func (tx *Transaction) AuditLog() *auditlog.Log {
 					for _, matchData := range mr.MatchedDatas() {
 						newAlEntry := auditlog.Message{
 							Actionset_: strings.Join(tx.WAF.ComponentNames, " "),
-							Message_:   matchData.Message(),
+							Message_:   sanitiser.str(matchData.Message()),
 							Data_: &auditlog.MessageData{
 								File_:     mr.Rule().File(),
 								Line_:     mr.Rule().Line(),
 								ID_:       r.ID(),
 								Rev_:      r.Revision(),
-								Msg_:      matchData.Message(),
-								Data_:     matchData.Data(),
+								Msg_:      sanitiser.str(matchData.Message()),
+								Data_:     sanitiser.str(matchData.Data()),
 								Severity_: r.Severity(),
 								Ver_:      r.Version(),
 								Maturity_: r.Maturity(),
@@ -1555,7 +1604,7 @@ func (tx *Transaction) AuditLog() *auditlog.Log {
 						// If AuditLogPartAuditLogTrailer (H) is set, we expect to log the error messages emitted by the rules
 						// in the audit log
 						if auditLogPartAuditLogTrailerSet {
-							newAlEntry.ErrorMessage_ = mr.ErrorLog()
+							newAlEntry.ErrorMessage_ = sanitiser.str(mr.ErrorLog())
 						}
 						al.Messages_ = append(al.Messages_, newAlEntry)
 					}
@@ -1578,14 +1627,14 @@ func (tx *Transaction) AuditLog() *auditlog.Log {
 				for _, matchData := range mr.MatchedDatas() {
 					al.Messages_ = append(al.Messages_, auditlog.Message{
 						Actionset_: strings.Join(tx.WAF.ComponentNames, " "),
-						Message_:   matchData.Message(),
+						Message_:   sanitiser.str(matchData.Message()),
 						Data_: &auditlog.MessageData{
 							File_:     mr.Rule().File(),
 							Line_:     mr.Rule().Line(),
 							ID_:       r.ID(),
 							Rev_:      r.Revision(),
-							Msg_:      matchData.Message(),
-							Data_:     matchData.Data(),
+							Msg_:      sanitiser.str(matchData.Message()),
+							Data_:     sanitiser.str(matchData.Data()),
 							Severity_: r.Severity(),
 							Ver_:      r.Version(),
 							Maturity_: r.Maturity(),
@@ -1593,7 +1642,7 @@ func (tx *Transaction) AuditLog() *auditlog.Log {
 							Tags_:     r.Tags(),
 							Raw_:      r.Raw(),
 						},
-						ErrorMessage_: mr.ErrorLog(),
+						ErrorMessage_: sanitiser.str(mr.ErrorLog()),
 					})
 				}
 			}
@@ -1629,6 +1678,9 @@ func (tx *Transaction) Close() error {
 	if err := tx.responseBodyBuffer.Reset(); err != nil {
 		errs = append(errs, fmt.Errorf("reseting response body buffer: %v", err))
 	}
+	tx.modifiedResponseBody = nil
+	tx.responseBodyPrepend = tx.responseBodyPrepend[:0]
+	tx.responseBodyAppend = tx.responseBodyAppend[:0]
 
 	if tx.IsInterrupted() {
 		tx.debugLogger.Debug().
@@ -20,6 +20,7 @@ import (
 	"github.com/corazawaf/coraza/v3/experimental/plugins/macro"
 	"github.com/corazawaf/coraza/v3/experimental/plugins/plugintypes"
 	"github.com/corazawaf/coraza/v3/internal/collections"
+	"github.com/corazawaf/coraza/v3/internal/cookies"
 	"github.com/corazawaf/coraza/v3/internal/corazarules"
 	"github.com/corazawaf/coraza/v3/internal/environment"
 	utils "github.com/corazawaf/coraza/v3/internal/strings"
@@ -875,7 +876,7 @@ func TestLogCallback(t *testing.T) {
 					Variable_: variables.UniqueID,
 				},
 			})
-			tx.WAF.Rules.rules = append(tx.WAF.Rules.rules, *rule)
+			tx.WAF.Rules.store(append(tx.WAF.Rules.GetRules(), *rule))
 
 			it := tx.ProcessRequestHeaders()
 			if testCase.shouldInterrupt {
@@ -976,6 +977,47 @@ func TestMultipleCookiesWithSpaceBetweenThem(t *testing.T) {
 	}
 }
 
+func TestRFC2965Cookies(t *testing.T) {
+	waf := NewWAF()
+	waf.CookieFormat = cookies.FormatRFC2965
+	tx := waf.NewTransaction()
+	tx.AddRequestHeader("cookie", `$Version="1"; session="a;b"; $Path="/acme", lang=en`)
+	want := map[string]string{"$Version": "1", "session": "a;b", "$Path": "/acme", "lang": "en"}
+	for k, v := range want {
+		if have := tx.variables.requestCookies.Get(k); len(have) != 1 || have[0] != v {
+			t.Errorf("unexpected value of cookie %q, want %q, have %q", k, v, have)
+		}
+	}
+	if err := tx.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestArgumentSeparator(t *testing.T) {
+	waf := NewWAF()
+	waf.ArgumentSeparator = ';'
+	tx := waf.NewTransaction()
+	tx.RequestBodyAccess = true
+	tx.ProcessURI("/?a=1;b=2&c", "POST", "HTTP/1.1")
+	tx.AddRequestHeader("content-type", "application/x-www-form-urlencoded")
+	tx.ProcessRequestHeaders()
+	if _, _, err := tx.WriteRequestBody([]byte("d=3;e=4&f")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.ProcessRequestBody(); err != nil {
+		t.Fatal(err)
+	}
+	if have := tx.variables.argsGet.Get("b"); len(have) != 1 || have[0] != "2&c" {
+		t.Errorf("unexpected value of the get argument b, have %q", have)
+	}
+	if have := tx.variables.argsPost.Get("e"); len(have) != 1 || have[0] != "4&f" {
+		t.Errorf("unexpected value of the post argument e, have %q", have)
+	}
+	if err := tx.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
 func collectionValues(t *testing.T, col collection.Collection) []string {
 	t.Helper()
 	var values []string
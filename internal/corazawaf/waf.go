@@ -13,11 +13,13 @@ import (
 	"os"
 	"regexp"
 	"strconv"
+	stdsync "sync"
 	"time"
 
 	"github.com/corazawaf/coraza/v3/debuglog"
 	"github.com/corazawaf/coraza/v3/experimental/plugins/plugintypes"
 	"github.com/corazawaf/coraza/v3/internal/auditlog"
+	"github.com/corazawaf/coraza/v3/internal/cookies"
 	"github.com/corazawaf/coraza/v3/internal/environment"
 	stringutils "github.com/corazawaf/coraza/v3/internal/strings"
 	"github.com/corazawaf/coraza/v3/internal/sync"
@@ -39,6 +41,10 @@ type WAF struct {
 	// ruleGroup object, contains all rules and helpers
 	Rules RuleGroup
 
+	// Scopes override the configuration and the rules for the transactions they
+	// match, e.g. a virtual host or a location
+	Scopes []*Scope
+
 	// If true, transactions will have access to the request body
 	RequestBodyAccess bool
 
@@ -99,7 +105,12 @@ type WAF struct {
 
 	ResponseBodyLimitAction types.BodyLimitAction
 
-	ArgumentSeparator string
+	// ArgumentSeparator separates the arguments of the query string and of the urlencoded
+	// request bodies, set by SecArgumentSeparator
+	ArgumentSeparator byte
+
+	// CookieFormat is the syntax of the request cookies, set by SecCookieFormat
+	CookieFormat cookies.Format
 
 	// ProducerConnector is used by connectors to identify the producer
 	// on audit logs, for example, apache-modcoraza
@@ -137,8 +148,51 @@ type WAF struct {
 	// Configures the maximum number of ARGS that will be accepted for processing.
 	ArgumentLimit int
 
+	// RBLTimeout bounds the DNS resolution time of every @rbl lookup
+	RBLTimeout time.Duration
+
+	// HTTPBLKey is the Project Honeypot http:BL access key used by @rbl
+	HTTPBLKey string
+
+	// InspectFileTimeout bounds the time spent by @inspectFile on every file
+	InspectFileTimeout time.Duration
+
+	// RulePerfTime is the evaluation time from which rules are reported in the
+	// audit log and aggregated by RulePerformance, 0 disables the profiling
+	RulePerfTime time.Duration
+
+	// ProcessEnv makes the setenv action also set the variables in the process
+	// environment, besides the ENV collection of the transaction
+	ProcessEnv bool
+
+	// ContentInjection enables the injection of content in the response body
+	// by the prepend and append actions
+	ContentInjection bool
+
+	// HashEngine enables the signing of links in HTML responses and the
+	// validation of the signatures by @validateHash
+	HashEngine bool
+
+	// HashKey is the key used to sign links
+	HashKey []byte
+
+	// HashKeyMode selects the data bound to the signature besides the link
+	HashKeyMode HashKeyMode
+
+	// HashParam is the query parameter carrying the signature
+	HashParam string
+
+	// HashMethods select the links to be signed
+	HashMethods []HashMethod
+
 	// Used for storing and retrieving persistent collection data (e.g., SESSION, IP, GLOBAL)
 	persistenceEngine ptypes.PersistentEngine
+
+	// datasetsMu serializes runtime dataset updates
+	datasetsMu stdsync.Mutex
+
+	// rulePerf aggregates the evaluations of the rules above RulePerfTime
+	rulePerf rulePerfStats
 }
 
 // Options is used to pass options to the WAF instance
@@ -187,13 +241,12 @@ func (w *WAF) newTransaction(opts Options) *Transaction {
 	tx.AuditLogParts = w.AuditLogParts
 	tx.AuditLogFormat = w.AuditLogFormat
 	tx.ForceRequestBodyVariable = false
-	tx.RequestBodyAccess = w.RequestBodyAccess
-	tx.RequestBodyLimit = int64(w.RequestBodyLimit)
-	tx.ResponseBodyAccess = w.ResponseBodyAccess
-	tx.ResponseBodyLimit = int64(w.ResponseBodyLimit)
-	tx.RuleEngine = w.RuleEngine
-	tx.HashEngine = false
-	tx.HashEnforcement = false
+	tx.HashEngine = w.HashEngine
+	tx.HashEnforcement = w.HashEngine
+	tx.modifiedResponseBody = nil
+	tx.responseBodyPrepend = tx.responseBodyPrepend[:0]
+	tx.responseBodyAppend = tx.responseBodyAppend[:0]
+	tx.sanitisation.reset()
 	tx.lastPhase = 0
 	tx.ruleRemoveByID = nil
 	tx.ruleRemoveTargetByID = map[int][]ruleVariableParams{}
@@ -201,6 +254,7 @@ func (w *WAF) newTransaction(opts Options) *Transaction {
 	tx.AllowType = 0
 	tx.Capture = false
 	tx.stopWatches = map[types.RulePhase]int64{}
+	tx.slowRules = nil
 	tx.WAF = w
 	tx.debugLogger = w.Logger.With(debuglog.Str("tx_id", tx.id))
 	tx.Timestamp = time.Now().UnixNano()
@@ -232,6 +286,8 @@ func (w *WAF) newTransaction(opts Options) *Transaction {
 		tx.variables = *NewTransactionVariables(tx.WAF.persistenceEngine)
 		tx.transformationCache = map[transformationKey]*transformationValue{}
 	}
+	// RuleEngine, body access and limits are those of the WAF until a scope is selected
+	tx.setScope(nil)
 
 	// set capture variables
 	for i := 0; i <= 10; i++ {
@@ -319,9 +375,10 @@ func NewWAF() *WAF {
 			types.AuditLogPartResponseHeaders,
 			types.AuditLogPartAuditLogTrailer,
 		},
-		AuditLogFormat: "Native",
-		Logger:         logger,
-		ArgumentLimit:  1000,
+		AuditLogFormat:    "Native",
+		Logger:            logger,
+		ArgumentLimit:     1000,
+		ArgumentSeparator: '&',
 	}
 
 	if environment.HasAccessToFS {
@@ -427,6 +484,10 @@ func (w *WAF) Validate() error {
 		return errors.New("argument limit should be bigger than 0")
 	}
 
+	if w.HashEngine && len(w.HashKey) == 0 {
+		return errors.New("hash engine requires a hash key")
+	}
+
 	return nil
 }
 
@@ -435,3 +496,54 @@ func (w *WAF) Validate() error {
 func (w *WAF) SetPersistenceEngine(engine ptypes.PersistentEngine) {
 	w.persistenceEngine = engine
 }
+
+// UpdateDataset replaces the values of a SecDataset for every rule operator bound to
+// it, e.g. @pmFromDataset or @ipMatchFromDataset. All the matchers are built before
+// any of them is swapped, so transactions never see a partially updated dataset and
+// the request path is not locked. It returns an error if no rule uses the dataset or
+// if a matcher can't be built, in which case no operator is updated.
+func (w *WAF) UpdateDataset(name string, values []string) error {
+	w.datasetsMu.Lock()
+	defer w.datasetsMu.Unlock()
+
+	var commits []func()
+	// the rules of the scopes share the operators of the rules they inherit, only their
+	// own rules have operators of their own
+	groups := []*RuleGroup{&w.Rules}
+	for _, s := range w.Scopes {
+		groups = append(groups, s.Rules())
+	}
+	for _, g := range groups {
+		rules := g.GetRules()
+		for i := range rules {
+			for r := &rules[i]; r != nil; r = r.Chain {
+				if r.operator == nil {
+					continue
+				}
+				op, ok := r.operator.Operator.(plugintypes.DatasetOperator)
+				if !ok || op.Dataset() != name {
+					continue
+				}
+				commit, err := op.PrepareDataset(values)
+				if err != nil {
+					return fmt.Errorf("failed to update dataset %q for rule %d: %w", name, r.ID_, err)
+				}
+				commits = append(commits, commit)
+			}
+		}
+	}
+
+	if len(commits) == 0 {
+		return fmt.Errorf("dataset %q is not used by any rule", name)
+	}
+
+	for _, commit := range commits {
+		commit()
+	}
+
+	w.Logger.Debug().
+		Str("dataset_name", name).
+		Int("operators", len(commits)).
+		Msg("Dataset updated")
+	return nil
+}
@@ -0,0 +1,387 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package expr
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"github.com/corazawaf/coraza/v3/collection"
+	"github.com/corazawaf/coraza/v3/experimental/plugins/plugintypes"
+	"github.com/corazawaf/coraza/v3/types"
+	"github.com/corazawaf/coraza/v3/types/variables"
+)
+
+// ErrStepLimit is returned when the evaluation of an expression exceeds MaxSteps
+var ErrStepLimit = errors.New("expression step limit exceeded")
+
+var errDivisionByZero = errors.New("division by zero")
+
+// env is the state of an evaluation
+type env struct {
+	tx    plugintypes.TransactionState
+	input string
+	steps int
+}
+
+// step accounts for a step of the evaluation, n values processed at once count as n steps
+func (e *env) step(n int) error {
+	e.steps += n
+	if e.steps > MaxSteps {
+		return ErrStepLimit
+	}
+	return nil
+}
+
+// maxPatternLength is the maximum length of the patterns evaluated at runtime, e.g. taken
+// from a variable
+const maxPatternLength = 1024
+
+// compileRegex compiles a pattern evaluated at runtime, it may come from the request so
+// it's neither cached nor unbounded, and compiling it counts a step per byte
+func (e *env) compileRegex(pattern string) (*regexp.Regexp, error) {
+	if len(pattern) > maxPatternLength {
+		return nil, fmt.Errorf("regex of %d bytes exceeds the maximum of %d", len(pattern), maxPatternLength)
+	}
+	if err := e.step(len(pattern)); err != nil {
+		return nil, err
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regex %q: %v", pattern, err)
+	}
+	return re, nil
+}
+
+// collection returns the collection of the variable, nil if the transaction has none
+func (e *env) collection(v variables.RuleVariable) collection.Collection {
+	tv := e.tx.Variables()
+	// persistent collections are not iterated by All
+	switch v {
+	case variables.IP:
+		return tv.IP()
+	case variables.Session:
+		return tv.Session()
+	case variables.User:
+		return tv.User()
+	case variables.Global:
+		return tv.Global()
+	case variables.Resource:
+		return tv.Resource()
+	}
+	var col collection.Collection
+	tv.All(func(rv variables.RuleVariable, c collection.Collection) bool {
+		if rv == v {
+			col = c
+			return false
+		}
+		return true
+	})
+	return col
+}
+
+// node is a node of the syntax tree, values are strings, ints, bools or, for the
+// variables selecting several values, []string.
+type node interface {
+	eval(e *env) (interface{}, error)
+}
+
+type literal struct {
+	v interface{}
+}
+
+func (n literal) eval(e *env) (interface{}, error) {
+	return n.v, e.step(1)
+}
+
+// input is the value evaluated by the @expr operator
+type input struct{}
+
+func (input) eval(e *env) (interface{}, error) {
+	return e.input, e.step(1)
+}
+
+type variable struct {
+	v     variables.RuleVariable
+	key   string
+	keyed bool
+	rx    *regexp.Regexp
+	count bool
+}
+
+func (n *variable) eval(e *env) (interface{}, error) {
+	if err := e.step(1); err != nil {
+		return nil, err
+	}
+	var values []string
+	// a key selects a single value, like the macros do
+	single := n.keyed
+	switch col := e.collection(n.v).(type) {
+	case nil:
+	case collection.Single:
+		values = []string{col.Get()}
+		single = true
+	case collection.Keyed:
+		switch {
+		case n.keyed:
+			values = col.Get(n.key)
+		case n.rx != nil:
+			values = matchValues(col.FindRegex(n.rx))
+		default:
+			values = matchValues(col.FindAll())
+		}
+	default:
+		values = matchValues(col.FindAll())
+	}
+	if err := e.step(len(values)); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case n.count:
+		return len(values), nil
+	case !single:
+		return values, nil
+	case len(values) == 0:
+		return "", nil
+	}
+	return values[0], nil
+}
+
+func matchValues(mds []types.MatchData) []string {
+	values := make([]string, 0, len(mds))
+	for _, md := range mds {
+		values = append(values, md.Value())
+	}
+	return values
+}
+
+type sequence []node
+
+func (n sequence) eval(e *env) (res interface{}, err error) {
+	for _, s := range n {
+		if res, err = s.eval(e); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+type conditional struct {
+	cond, then, otherwise node
+}
+
+func (n *conditional) eval(e *env) (interface{}, error) {
+	c, err := n.cond.eval(e)
+	if err != nil {
+		return nil, err
+	}
+	if toBool(c) {
+		return n.then.eval(e)
+	}
+	return n.otherwise.eval(e)
+}
+
+type logical struct {
+	or          bool
+	left, right node
+}
+
+func (n *logical) eval(e *env) (interface{}, error) {
+	l, err := n.left.eval(e)
+	if err != nil {
+		return nil, err
+	}
+	// short-circuit evaluation, the right side may call setvar
+	if toBool(l) == n.or {
+		return n.or, nil
+	}
+	r, err := n.right.eval(e)
+	if err != nil {
+		return nil, err
+	}
+	return toBool(r), nil
+}
+
+type unary struct {
+	op      string
+	operand node
+}
+
+func (n *unary) eval(e *env) (interface{}, error) {
+	v, err := n.operand.eval(e)
+	if err != nil {
+		return nil, err
+	}
+	if n.op == "!" {
+		return !toBool(v), nil
+	}
+	return -toInt(v), nil
+}
+
+// match matches the left side, any of its values if several, with a regex
+type match struct {
+	negated bool
+	left    node
+	pattern node
+	// rx is the compiled pattern if it's a literal
+	rx *regexp.Regexp
+}
+
+func (n *match) eval(e *env) (interface{}, error) {
+	l, err := n.left.eval(e)
+	if err != nil {
+		return nil, err
+	}
+	rx := n.rx
+	if rx == nil {
+		p, err := n.pattern.eval(e)
+		if err != nil {
+			return nil, err
+		}
+		if rx, err = e.compileRegex(toString(p)); err != nil {
+			return nil, err
+		}
+	}
+	values, ok := l.([]string)
+	if !ok {
+		values = []string{toString(l)}
+	}
+	if err := e.step(len(values)); err != nil {
+		return nil, err
+	}
+	for _, v := range values {
+		if rx.MatchString(v) {
+			return !n.negated, nil
+		}
+	}
+	return n.negated, nil
+}
+
+type binary struct {
+	op          string
+	left, right node
+}
+
+func (n *binary) eval(e *env) (interface{}, error) {
+	l, err := n.left.eval(e)
+	if err != nil {
+		return nil, err
+	}
+	r, err := n.right.eval(e)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.op {
+	case "==":
+		return equal(l, r), nil
+	case "!=":
+		return !equal(l, r), nil
+	case "<":
+		return toInt(l) < toInt(r), nil
+	case "<=":
+		return toInt(l) <= toInt(r), nil
+	case ">":
+		return toInt(l) > toInt(r), nil
+	case ">=":
+		return toInt(l) >= toInt(r), nil
+	case "+":
+		if !isInt(l) && !isInt(r) {
+			return toString(l) + toString(r), nil
+		}
+		return toInt(l) + toInt(r), nil
+	case "-":
+		return toInt(l) - toInt(r), nil
+	case "*":
+		return toInt(l) * toInt(r), nil
+	case "/", "%":
+		d := toInt(r)
+		if d == 0 {
+			return nil, errDivisionByZero
+		}
+		if n.op == "/" {
+			return toInt(l) / d, nil
+		}
+		return toInt(l) % d, nil
+	}
+	return nil, errors.New("unknown operator " + n.op)
+}
+
+// equal compares numbers if either side is one, and strings otherwise
+func equal(l, r interface{}) bool {
+	if isInt(l) || isInt(r) {
+		if _, ok := parseInt(l); ok {
+			if _, ok := parseInt(r); ok {
+				return toInt(l) == toInt(r)
+			}
+		}
+	}
+	if lb, ok := l.(bool); ok {
+		return lb == toBool(r)
+	}
+	if rb, ok := r.(bool); ok {
+		return rb == toBool(l)
+	}
+	return toString(l) == toString(r)
+}
+
+func isInt(v interface{}) bool {
+	_, ok := v.(int)
+	return ok
+}
+
+func parseInt(v interface{}) (int, bool) {
+	switch v := v.(type) {
+	case int:
+		return v, true
+	case bool:
+		if v {
+			return 1, true
+		}
+		return 0, true
+	}
+	n, err := strconv.Atoi(toString(v))
+	return n, err == nil
+}
+
+// toInt converts the value to an int, strings not representing a number are 0
+func toInt(v interface{}) int {
+	n, _ := parseInt(v)
+	return n
+}
+
+// toString converts the value to a string, lists are represented by their first value
+func toString(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case int:
+		return strconv.Itoa(v)
+	case bool:
+		return strconv.FormatBool(v)
+	case []string:
+		if len(v) > 0 {
+			return v[0]
+		}
+	}
+	return ""
+}
+
+// toBool converts the value to a bool, empty strings and lists and 0 are false
+func toBool(v interface{}) bool {
+	switch v := v.(type) {
+	case bool:
+		return v
+	case int:
+		return v != 0
+	case string:
+		return v != ""
+	case []string:
+		return len(v) > 0
+	}
+	return false
+}
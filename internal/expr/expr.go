@@ -0,0 +1,65 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+// Package expr implements the sandboxed expression language of SecRuleScript and of the
+// @expr operator. Expressions read the variables of the transaction, their only side
+// effect is setvar, and their evaluation is bounded by MaxSteps.
+//
+//	&ARGS:id == 1 && ARGS:id =~ '^[0-9]+$'
+//	TX:anomaly_score >= 5 ? setvar('tx.blocked=1') : false
+//	REQUEST_HEADERS:/^x-/ =~ 'attack'; len(value) > 100
+//
+// Values are strings, integers, booleans and lists of strings:
+//   - VARIABLE:key is the first value of the key, like in macros, "" if there is none
+//   - VARIABLE and VARIABLE:/regex/ are the list of the values selected
+//   - &VARIABLE and &VARIABLE:key are the count of the values selected
+//   - value is the value evaluated by the @expr operator
+//
+// Keys not quoted end at the first space or operator other than "-", use spaces around
+// the operators after a key, e.g. "TX:score - 1" and "a ? TX:b : c".
+//
+// Comparisons and arithmetic convert strings to integers, like the @eq and @gt operators,
+// "+" concatenates when neither side is an integer. =~ and !~ match a regex against any
+// value of a list. Expressions are separated by ";", the result is the last one, and
+// comments start with "#". The functions are len, int, str, lower, upper, contains,
+// startsWith, endsWith and setvar, which takes the argument of the setvar action, e.g.
+// setvar('tx.score=+5').
+package expr
+
+import (
+	"github.com/corazawaf/coraza/v3/experimental/plugins/plugintypes"
+)
+
+// MaxSteps is the maximum number of steps of an evaluation, every node of the expression
+// and every value processed is a step.
+const MaxSteps = 10000
+
+// Program is a compiled expression, it's safe for concurrent use
+type Program struct {
+	root node
+}
+
+// Compile parses the expression
+func Compile(src string) (*Program, error) {
+	tokens, err := tokenize(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	root, err := p.parseScript()
+	if err != nil {
+		return nil, err
+	}
+	return &Program{root: root}, nil
+}
+
+// Eval evaluates the program for the transaction, input is the value bound to "value".
+// It returns whether the result is true, i.e. not false, 0 or empty.
+func (p *Program) Eval(tx plugintypes.TransactionState, input string) (bool, error) {
+	e := &env{tx: tx, input: input}
+	res, err := p.root.eval(e)
+	if err != nil {
+		return false, err
+	}
+	return toBool(res), nil
+}
@@ -0,0 +1,221 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package expr
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/corazawaf/coraza/v3/internal/corazawaf"
+	"github.com/corazawaf/coraza/v3/internal/memoize"
+)
+
+func newTestTransaction(t *testing.T) *corazawaf.Transaction {
+	t.Helper()
+	tx := corazawaf.NewWAF().NewTransaction()
+	tx.ProcessURI("/login?id=5&id=6&user=admin&cmd=wget", "POST", "HTTP/1.1")
+	tx.AddRequestHeader("X-Forwarded-For", "10.0.0.1")
+	tx.AddRequestHeader("X-Real-IP", "10.0.0.2")
+	tx.Variables().TX().Set("anomaly_score", []string{"5"})
+	t.Cleanup(func() {
+		_ = tx.Close()
+	})
+	return tx
+}
+
+func TestEval(t *testing.T) {
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{"true", true},
+		{"false", false},
+		{"0", false},
+		{"''", false},
+		{"'a'", true},
+		{"1 + 2 * 3 == 7", true},
+		{"(1 + 2) * 3 == 9", true},
+		{"-1 < 0", true},
+		{"7 / 2 == 3 && 7 % 2 == 1", true},
+		{"'a' + 'b' == 'ab'", true},
+		{"'10' > '9'", true},
+		{"'a' == 0", false},
+		{"!false && !0", true},
+		{"true ? 'yes' == 'yes' : false", true},
+		{"REQUEST_METHOD == 'POST'", true},
+		{"request_method == 'POST'", true},
+		{"ARGS:id == 5", true},
+		{"ARGS:id == '6'", false},
+		{"&ARGS:id == 2", true},
+		{"&ARGS == 4", true},
+		{"&ARGS:unknown == 0 && ARGS:unknown == ''", true},
+		{"ARGS =~ '^wget$'", true},
+		{"ARGS !~ '^curl$'", true},
+		{"ARGS:/^us/ == 'admin'", true},
+		{"REQUEST_HEADERS:/^x-/ =~ '10.0.0.2'", true},
+		{"REQUEST_HEADERS:X-Forwarded-For == '10.0.0.1'", true},
+		{"REQUEST_HEADERS:'x-real-ip' == '10.0.0.2'", true},
+		{"TX:anomaly_score >= 5", true},
+		{"TX:anomaly_score - 1 == 4", true},
+		{"len(ARGS) == 4 && len(ARGS:user) == 5", true},
+		{"upper(ARGS:user) == 'ADMIN' && startsWith(REQUEST_URI, '/login')", true},
+		{"endsWith(REQUEST_FILENAME, 'in') && contains(QUERY_STRING, 'cmd=')", true},
+		{"str(1) + str(2) == '12' && int('12') == 12", true},
+		{"ARGS:user =~ 'ad' + 'min'", true},
+		{"# a comment\nfalse; # another one\ntrue", true},
+	}
+	tx := newTestTransaction(t)
+	for _, tc := range tests {
+		p, err := Compile(tc.expr)
+		if err != nil {
+			t.Errorf("failed to compile %q: %v", tc.expr, err)
+			continue
+		}
+		have, err := p.Eval(tx, "")
+		if err != nil {
+			t.Errorf("failed to evaluate %q: %v", tc.expr, err)
+			continue
+		}
+		if have != tc.want {
+			t.Errorf("unexpected result of %q, want %t, have %t", tc.expr, tc.want, have)
+		}
+	}
+}
+
+func TestEvalInput(t *testing.T) {
+	p, err := Compile("len(value) == 3 && value =~ '^[a-z]+$'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := newTestTransaction(t)
+	if ok, err := p.Eval(tx, "abc"); err != nil || !ok {
+		t.Errorf("expected a match, got %t (%v)", ok, err)
+	}
+	if ok, err := p.Eval(tx, "abcd"); err != nil || ok {
+		t.Errorf("unexpected match, got %t (%v)", ok, err)
+	}
+}
+
+func TestSetvar(t *testing.T) {
+	p, err := Compile(`
+		setvar('tx.anomaly_score=+3');
+		setvar('TX.flag');
+		setvar('tx.user=' + ARGS:user);
+		setvar('!tx.removed');
+		TX:anomaly_score >= 8 || setvar('tx.not_evaluated=1')
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := newTestTransaction(t)
+	col := tx.Variables().TX()
+	col.Set("removed", []string{"1"})
+	if ok, err := p.Eval(tx, ""); err != nil || !ok {
+		t.Fatalf("expected a match, got %t (%v)", ok, err)
+	}
+
+	want := map[string]string{
+		"anomaly_score": "8",
+		"flag":          "1",
+		"user":          "admin",
+		"removed":       "",
+		"not_evaluated": "",
+	}
+	for k, v := range want {
+		if have := strings.Join(col.Get(k), ","); have != v {
+			t.Errorf("unexpected value of tx.%s, want %q, have %q", k, v, have)
+		}
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	tests := []string{
+		"1 / 0",
+		"ARGS:user =~ '(' + 'a'",
+		"setvar('request_headers.foo=bar')",
+		"setvar('tx')",
+	}
+	tx := newTestTransaction(t)
+	for _, expr := range tests {
+		p, err := Compile(expr)
+		if err != nil {
+			t.Errorf("failed to compile %q: %v", expr, err)
+			continue
+		}
+		if _, err := p.Eval(tx, ""); err == nil {
+			t.Errorf("expected an error evaluating %q", expr)
+		}
+	}
+}
+
+func TestStepLimit(t *testing.T) {
+	// each evaluation of the script takes a few steps, repeated until the limit is exceeded
+	script := strings.Repeat("ARGS =~ 'x' || ", MaxSteps/4) + "false"
+	p, err := Compile(script)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Eval(newTestTransaction(t), ""); !errors.Is(err, ErrStepLimit) {
+		t.Errorf("expected the step limit to be exceeded, got %v", err)
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := []string{
+		"",
+		"1 +",
+		"(1",
+		"'unterminated",
+		"1 ? 2",
+		"UNKNOWN_VARIABLE == 1",
+		"unknown(1)",
+		"len(1, 2)",
+		"value =~ '('",
+		"ARGS:/(/ == 1",
+		"ARGS:/unterminated",
+		"1 $ 2",
+		"1 2",
+		"&1",
+	}
+	for _, expr := range tests {
+		if _, err := Compile(expr); err == nil {
+			t.Errorf("expected an error compiling %q", expr)
+		}
+	}
+}
+
+func TestRuntimeRegex(t *testing.T) {
+	// the patterns are not shared with the other users of memoize, which may cache other
+	// types under the same string, e.g. @pm
+	_, _ = memoize.Do("admin", func() (interface{}, error) { return struct{}{}, nil })
+	_, _ = memoize.Do("ad", func() (interface{}, error) { return struct{}{}, nil })
+
+	tx := newTestTransaction(t)
+	for _, src := range []string{"'admin' =~ ARGS:user", "ARGS:user =~ 'ad'"} {
+		p, err := Compile(src)
+		if err != nil {
+			t.Fatalf("failed to compile %q: %v", src, err)
+		}
+		if ok, err := p.Eval(tx, ""); err != nil || !ok {
+			t.Errorf("expected a match of %q, got %t (%v)", src, ok, err)
+		}
+	}
+
+	p, err := Compile("value =~ value")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Eval(tx, strings.Repeat("a", maxPatternLength+1)); err == nil {
+		t.Error("expected an error for a pattern exceeding the maximum length")
+	}
+	// compiling the runtime patterns counts as steps
+	script := strings.Repeat("'a' =~ value || ", MaxSteps/maxPatternLength+1) + "false"
+	if p, err = Compile(script); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Eval(tx, strings.Repeat("b", maxPatternLength)); !errors.Is(err, ErrStepLimit) {
+		t.Errorf("expected the step limit to be exceeded, got %v", err)
+	}
+}
@@ -0,0 +1,141 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package expr
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/corazawaf/coraza/v3/collection"
+	"github.com/corazawaf/coraza/v3/types/variables"
+)
+
+type function struct {
+	args int
+	fn   func(e *env, args []interface{}) (interface{}, error)
+}
+
+var functions = map[string]function{
+	"len": {1, func(_ *env, args []interface{}) (interface{}, error) {
+		if values, ok := args[0].([]string); ok {
+			return len(values), nil
+		}
+		return len(toString(args[0])), nil
+	}},
+	"int": {1, func(_ *env, args []interface{}) (interface{}, error) {
+		return toInt(args[0]), nil
+	}},
+	"str": {1, func(_ *env, args []interface{}) (interface{}, error) {
+		return toString(args[0]), nil
+	}},
+	"lower": {1, func(_ *env, args []interface{}) (interface{}, error) {
+		return strings.ToLower(toString(args[0])), nil
+	}},
+	"upper": {1, func(_ *env, args []interface{}) (interface{}, error) {
+		return strings.ToUpper(toString(args[0])), nil
+	}},
+	"contains": {2, func(_ *env, args []interface{}) (interface{}, error) {
+		return strings.Contains(toString(args[0]), toString(args[1])), nil
+	}},
+	"startsWith": {2, func(_ *env, args []interface{}) (interface{}, error) {
+		return strings.HasPrefix(toString(args[0]), toString(args[1])), nil
+	}},
+	"endsWith": {2, func(_ *env, args []interface{}) (interface{}, error) {
+		return strings.HasSuffix(toString(args[0]), toString(args[1])), nil
+	}},
+	"setvar": {1, setvar},
+}
+
+type call struct {
+	name string
+	fn   func(e *env, args []interface{}) (interface{}, error)
+	args []node
+}
+
+func (n *call) eval(e *env) (interface{}, error) {
+	if err := e.step(1); err != nil {
+		return nil, err
+	}
+	args := make([]interface{}, len(n.args))
+	for i, a := range n.args {
+		v, err := a.eval(e)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = v
+	}
+	res, err := n.fn(e, args)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", n.name, err)
+	}
+	return res, nil
+}
+
+// editableCollections are the collections setvar can change, like the setvar action
+var editableCollections = map[string]variables.RuleVariable{
+	"tx":       variables.TX,
+	"ip":       variables.IP,
+	"session":  variables.Session,
+	"user":     variables.User,
+	"global":   variables.Global,
+	"resource": variables.Resource,
+}
+
+// setvar creates, removes or updates a variable with the syntax of the setvar action,
+// e.g. setvar('tx.score=+5') or setvar('!tx.flag'). It always returns true.
+func setvar(e *env, args []interface{}) (interface{}, error) {
+	data := toString(args[0])
+	remove := strings.HasPrefix(data, "!")
+	if remove {
+		data = data[1:]
+	}
+	name, value, hasValue := strings.Cut(data, "=")
+	colName, key, _ := strings.Cut(name, ".")
+	v, ok := editableCollections[strings.ToLower(colName)]
+	if !ok {
+		return nil, fmt.Errorf("invalid editable collection %q", colName)
+	}
+	key = strings.ToLower(strings.TrimSpace(key))
+	if key == "" {
+		return nil, errors.New("invalid arguments, expected syntax {collection}.{key}={value}")
+	}
+	if !hasValue && !remove {
+		// like the action, a variable without value is a flag
+		value = "1"
+	}
+
+	col, ok := e.collection(v).(collection.Editable)
+	if !ok {
+		return nil, fmt.Errorf("collection %q is not editable", colName)
+	}
+	e.tx.DebugLogger().Debug().
+		Str("var_key", key).
+		Str("var_value", value).
+		Msg("Expression setvar evaluated")
+
+	if remove {
+		col.Remove(key)
+		return true, nil
+	}
+	if len(value) > 0 && (value[0] == '+' || value[0] == '-') {
+		if n, err := strconv.Atoi(value[1:]); err == nil {
+			if value[0] == '-' {
+				n = -n
+			}
+			if p, ok := col.(collection.Persistent); ok {
+				p.Sum(key, n)
+				return true, nil
+			}
+			current := 0
+			if values := col.Get(key); len(values) > 0 {
+				current = toInt(values[0])
+			}
+			value = strconv.Itoa(current + n)
+		}
+	}
+	col.Set(key, []string{value})
+	return true, nil
+}
@@ -0,0 +1,162 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package expr
+
+import (
+	"fmt"
+	"strings"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenNumber
+	tokenString
+	tokenIdent
+	// tokenKey is the key of a variable, following the colon, like "id" in ARGS:id
+	tokenKey
+	// tokenRegexKey is a regex key of a variable, like ^id_ in ARGS:/^id_/
+	tokenRegexKey
+	tokenOperator
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+// operatorTokens are sorted so that the longest operators are matched first
+var operatorTokens = []string{
+	"==", "!=", "<=", ">=", "=~", "!~", "&&", "||",
+	"<", ">", "!", "&", "+", "-", "*", "/", "%", "(", ")", ",", ";", "?", ":",
+}
+
+// keyTerminators end the keys not quoted, e.g. ARGS:id)
+const keyTerminators = " \t\r\n()[],;!=<>&|?+*%"
+
+func tokenize(src string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			i++
+		case c == '#':
+			// comments run until the end of the line
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case c >= '0' && c <= '9':
+			start := i
+			for i < len(src) && src[i] >= '0' && src[i] <= '9' {
+				i++
+			}
+			tokens = append(tokens, token{tokenNumber, src[start:i], start})
+		case c == '\'' || c == '"':
+			s, n, err := readQuoted(src, i)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{tokenString, s, i})
+			i += n
+		case isIdentStart(c):
+			start := i
+			for i < len(src) && isIdentPart(src[i]) {
+				i++
+			}
+			tokens = append(tokens, token{tokenIdent, src[start:i], start})
+			// the colon right after a name, without spaces, introduces the key of a variable
+			if i+1 < len(src) && src[i] == ':' && !strings.ContainsRune(keyTerminators, rune(src[i+1])) {
+				key, n, err := readKey(src, i+1)
+				if err != nil {
+					return nil, err
+				}
+				tokens = append(tokens, key)
+				i += 1 + n
+			}
+		default:
+			op := ""
+			for _, o := range operatorTokens {
+				if strings.HasPrefix(src[i:], o) {
+					op = o
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("unexpected character %q at %d", c, i)
+			}
+			tokens = append(tokens, token{tokenOperator, op, i})
+			i += len(op)
+		}
+	}
+	return append(tokens, token{tokenEOF, "", len(src)}), nil
+}
+
+// readKey reads the key of a variable starting at i, it returns the token and its length
+func readKey(src string, i int) (token, int, error) {
+	switch src[i] {
+	case '\'', '"':
+		s, n, err := readQuoted(src, i)
+		return token{tokenKey, s, i}, n, err
+	case '/':
+		for j := i + 1; j < len(src); j++ {
+			if src[j] == '\\' {
+				j++
+				continue
+			}
+			if src[j] == '/' {
+				return token{tokenRegexKey, src[i+1 : j], i}, j + 1 - i, nil
+			}
+		}
+		return token{}, 0, fmt.Errorf("unterminated regex key at %d", i)
+	}
+	end := i
+	for end < len(src) && !strings.ContainsRune(keyTerminators, rune(src[end])) {
+		end++
+	}
+	return token{tokenKey, src[i:end], i}, end - i, nil
+}
+
+// readQuoted reads the string quoted at i, it returns the unescaped string and the length
+// of the quoted one
+func readQuoted(src string, i int) (string, int, error) {
+	quote := src[i]
+	var sb strings.Builder
+	for j := i + 1; j < len(src); j++ {
+		c := src[j]
+		switch {
+		case c == quote:
+			return sb.String(), j + 1 - i, nil
+		case c == '\\' && j+1 < len(src):
+			j++
+			switch src[j] {
+			case 'n':
+				sb.WriteByte('\n')
+			case 't':
+				sb.WriteByte('\t')
+			case 'r':
+				sb.WriteByte('\r')
+			default:
+				// \\, \' and \" are written as is, like the escapes of regexes
+				if src[j] != '\\' && src[j] != '\'' && src[j] != '"' {
+					sb.WriteByte('\\')
+				}
+				sb.WriteByte(src[j])
+			}
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated string at %d", i)
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isIdentPart(c byte) bool {
+	return isIdentStart(c) || (c >= '0' && c <= '9')
+}
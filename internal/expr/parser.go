@@ -0,0 +1,329 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package expr
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"github.com/corazawaf/coraza/v3/internal/memoize"
+	"github.com/corazawaf/coraza/v3/types/variables"
+)
+
+// parser is a recursive descent parser, from the lowest to the highest precedence:
+//
+//	script     = expr { ";" expr } [ ";" ]
+//	expr       = or [ "?" expr ":" expr ]
+//	or         = and { "||" and }
+//	and        = comparison { "&&" comparison }
+//	comparison = sum [ ( "==" | "!=" | "<" | "<=" | ">" | ">=" | "=~" | "!~" ) sum ]
+//	sum        = product { ( "+" | "-" ) product }
+//	product    = unary { ( "*" | "/" | "%" ) unary }
+//	unary      = ( "!" | "-" ) unary | primary
+//	primary    = number | string | "true" | "false" | "value" | "(" expr ")"
+//	           | function "(" [ expr { "," expr } ] ")" | [ "&" ] variable [ ":" key ]
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+// accept consumes the next token if it's one of the operators
+func (p *parser) accept(ops ...string) (string, bool) {
+	t := p.peek()
+	if t.kind != tokenOperator {
+		return "", false
+	}
+	for _, op := range ops {
+		if t.text == op {
+			p.pos++
+			return op, true
+		}
+	}
+	return "", false
+}
+
+func (p *parser) expect(op string) error {
+	if _, ok := p.accept(op); !ok {
+		return p.unexpected()
+	}
+	return nil
+}
+
+func (p *parser) unexpected() error {
+	t := p.peek()
+	if t.kind == tokenEOF {
+		return fmt.Errorf("unexpected end of expression")
+	}
+	return fmt.Errorf("unexpected %q at %d", t.text, t.pos)
+}
+
+func (p *parser) parseScript() (node, error) {
+	var s sequence
+	for {
+		n, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		s = append(s, n)
+		if _, ok := p.accept(";"); !ok || p.peek().kind == tokenEOF {
+			break
+		}
+	}
+	if p.peek().kind != tokenEOF {
+		return nil, p.unexpected()
+	}
+	if len(s) == 1 {
+		return s[0], nil
+	}
+	return s, nil
+}
+
+func (p *parser) parseExpr() (node, error) {
+	cond, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := p.accept("?"); !ok {
+		return cond, nil
+	}
+	then, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(":"); err != nil {
+		return nil, err
+	}
+	otherwise, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	return &conditional{cond, then, otherwise}, nil
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.accept("||"); !ok {
+			return left, nil
+		}
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &logical{or: true, left: left, right: right}
+	}
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseComparison()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.accept("&&"); !ok {
+			return left, nil
+		}
+		right, err := p.parseComparison()
+		if err != nil {
+			return nil, err
+		}
+		left = &logical{left: left, right: right}
+	}
+}
+
+func (p *parser) parseComparison() (node, error) {
+	left, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+	op, ok := p.accept("==", "!=", "<=", ">=", "<", ">", "=~", "!~")
+	if !ok {
+		return left, nil
+	}
+	right, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+	if op == "=~" || op == "!~" {
+		m := &match{negated: op == "!~", left: left, pattern: right}
+		// literal patterns are compiled once
+		if lit, ok := right.(literal); ok {
+			if m.rx, err = compileRegex(toString(lit.v)); err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+	}
+	return &binary{op: op, left: left, right: right}, nil
+}
+
+func (p *parser) parseSum() (node, error) {
+	left, err := p.parseProduct()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.accept("+", "-")
+		if !ok {
+			return left, nil
+		}
+		right, err := p.parseProduct()
+		if err != nil {
+			return nil, err
+		}
+		left = &binary{op: op, left: left, right: right}
+	}
+}
+
+func (p *parser) parseProduct() (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.accept("*", "/", "%")
+		if !ok {
+			return left, nil
+		}
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &binary{op: op, left: left, right: right}
+	}
+}
+
+func (p *parser) parseUnary() (node, error) {
+	op, ok := p.accept("!", "-")
+	if !ok {
+		return p.parsePrimary()
+	}
+	operand, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	return &unary{op: op, operand: operand}, nil
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenNumber:
+		n, err := strconv.Atoi(t.text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q at %d", t.text, t.pos)
+		}
+		return literal{n}, nil
+	case tokenString:
+		return literal{t.text}, nil
+	case tokenIdent:
+		return p.parseIdent(t, false)
+	case tokenOperator:
+		switch t.text {
+		case "(":
+			n, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			return n, p.expect(")")
+		case "&":
+			if ident := p.peek(); ident.kind == tokenIdent {
+				p.pos++
+				return p.parseIdent(ident, true)
+			}
+			return nil, p.unexpected()
+		}
+	}
+	if t.kind != tokenEOF {
+		p.pos--
+	}
+	return nil, p.unexpected()
+}
+
+func (p *parser) parseIdent(t token, count bool) (node, error) {
+	if !count {
+		if _, ok := p.accept("("); ok {
+			return p.parseCall(t)
+		}
+		switch t.text {
+		case "true":
+			return literal{true}, nil
+		case "false":
+			return literal{false}, nil
+		case "value":
+			return input{}, nil
+		}
+	}
+
+	v, err := variables.Parse(t.text)
+	if err != nil {
+		return nil, fmt.Errorf("unknown variable %q at %d", t.text, t.pos)
+	}
+	n := &variable{v: v, count: count}
+	switch k := p.peek(); k.kind {
+	case tokenKey:
+		p.pos++
+		n.key = k.text
+		n.keyed = true
+	case tokenRegexKey:
+		p.pos++
+		if n.rx, err = compileRegex(k.text); err != nil {
+			return nil, err
+		}
+	}
+	return n, nil
+}
+
+func (p *parser) parseCall(name token) (node, error) {
+	fn, ok := functions[name.text]
+	if !ok {
+		return nil, fmt.Errorf("unknown function %q at %d", name.text, name.pos)
+	}
+	c := &call{name: name.text, fn: fn.fn}
+	if _, ok := p.accept(")"); !ok {
+		for {
+			arg, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			c.args = append(c.args, arg)
+			if _, ok := p.accept(","); !ok {
+				break
+			}
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+	}
+	if len(c.args) != fn.args {
+		return nil, fmt.Errorf("%s expects %d arguments, got %d", name.text, fn.args, len(c.args))
+	}
+	return c, nil
+}
+
+// compileRegex compiles a literal pattern of the expression, the regexes are shared by the
+// expressions using the same pattern
+func compileRegex(pattern string) (*regexp.Regexp, error) {
+	re, err := memoize.Do("expr:rx:"+pattern, func() (interface{}, error) { return regexp.Compile(pattern) })
+	if err != nil {
+		return nil, fmt.Errorf("invalid regex %q: %v", pattern, err)
+	}
+	return re.(*regexp.Regexp), nil
+}
@@ -0,0 +1,38 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !coraza.disabled_operators.expr
+
+package operators
+
+import (
+	"github.com/corazawaf/coraza/v3/experimental/plugins/plugintypes"
+	"github.com/corazawaf/coraza/v3/internal/expr"
+)
+
+// exprOp evaluates an expression, the value of the variable is bound to "value",
+// see the expr package for the syntax
+type exprOp struct {
+	program *expr.Program
+}
+
+func newExpr(options plugintypes.OperatorOptions) (plugintypes.Operator, error) {
+	program, err := expr.Compile(options.Arguments)
+	if err != nil {
+		return nil, err
+	}
+	return &exprOp{program: program}, nil
+}
+
+func (o *exprOp) Evaluate(tx plugintypes.TransactionState, value string) bool {
+	res, err := o.program.Eval(tx, value)
+	if err != nil {
+		tx.DebugLogger().Error().Err(err).Msg("Failed to evaluate expression")
+		return false
+	}
+	return res
+}
+
+func init() {
+	Register("expr", newExpr)
+}
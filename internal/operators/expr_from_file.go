@@ -0,0 +1,28 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !coraza.disabled_operators.exprFromFile
+
+package operators
+
+import (
+	"github.com/corazawaf/coraza/v3/experimental/plugins/plugintypes"
+	"github.com/corazawaf/coraza/v3/internal/expr"
+)
+
+// newExprFromFile loads the expression of the file, it is the operator of SecRuleScript
+func newExprFromFile(options plugintypes.OperatorOptions) (plugintypes.Operator, error) {
+	data, err := loadFromFile(options.Arguments, options.Path, options.Root)
+	if err != nil {
+		return nil, err
+	}
+	program, err := expr.Compile(string(data))
+	if err != nil {
+		return nil, err
+	}
+	return &exprOp{program: program}, nil
+}
+
+func init() {
+	Register("exprFromFile", newExprFromFile)
+}
@@ -0,0 +1,64 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package operators
+
+import (
+	"os"
+	"testing"
+
+	"github.com/corazawaf/coraza/v3/experimental/plugins/plugintypes"
+	"github.com/corazawaf/coraza/v3/internal/corazawaf"
+)
+
+func TestExpr(t *testing.T) {
+	tests := []struct {
+		expr  string
+		input string
+		want  bool
+	}{
+		{"len(value) > 3", "abcd", true},
+		{"len(value) > 3", "abc", false},
+		{"value =~ '^[0-9]+$' && int(value) % 2 == 0", "1234", true},
+		{"lower(value) == 'select' ? true : contains(value, '--')", "1 OR 1=1 --", true},
+		// errors don't match
+		{"value / 0", "1", false},
+	}
+	tx := corazawaf.NewWAF().NewTransaction()
+	for _, tc := range tests {
+		op, err := newExpr(plugintypes.OperatorOptions{Arguments: tc.expr})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if have := op.Evaluate(tx, tc.input); have != tc.want {
+			t.Errorf("unexpected result of %q for %q, want %t, have %t", tc.expr, tc.input, tc.want, have)
+		}
+	}
+
+	if _, err := newExpr(plugintypes.OperatorOptions{Arguments: "len(value"}); err == nil {
+		t.Error("expected an error for an invalid expression")
+	}
+}
+
+func TestExprFromFile(t *testing.T) {
+	op, err := newExprFromFile(plugintypes.OperatorOptions{
+		Arguments: "script.expr",
+		Path:      []string{"op"},
+		Root:      os.DirFS("testdata"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := corazawaf.NewWAF().NewTransaction()
+	if !op.Evaluate(tx, "42") || op.Evaluate(tx, "420") {
+		t.Error("unexpected result of the script")
+	}
+
+	if _, err := newExprFromFile(plugintypes.OperatorOptions{
+		Arguments: "unknown.expr",
+		Path:      []string{"op"},
+		Root:      os.DirFS("testdata"),
+	}); err == nil {
+		t.Error("expected an error for a missing script")
+	}
+}
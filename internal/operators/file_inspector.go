@@ -0,0 +1,104 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package operators
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/corazawaf/coraza/v3/experimental/plugins/plugintypes"
+)
+
+const (
+	// defaultInspectFileTimeout is used when neither SecInspectFileTimeout nor
+	// the timeout argument are set
+	defaultInspectFileTimeout = 10 * time.Second
+
+	// goInspectorPrefix selects an in-process inspector instead of an external program
+	goInspectorPrefix = "go:"
+
+	inspectFileTimeoutArg = "timeout="
+)
+
+var fileInspectors = map[string]plugintypes.FileInspector{}
+
+// RegisterFileInspector registers a named in-process inspector for @inspectFile.
+// If the inspector already exists it will be overwritten
+func RegisterFileInspector(name string, fn plugintypes.FileInspector) {
+	fileInspectors[name] = fn
+}
+
+// parseInspectFileArguments splits the @inspectFile arguments into the target, that is
+// a path or a go: inspector name, and the timeout. The timeout is taken from the
+// optional trailing timeout=DURATION argument, then from SecInspectFileTimeout.
+func parseInspectFileArguments(options plugintypes.OperatorOptions) (string, time.Duration, error) {
+	target := strings.TrimSpace(options.Arguments)
+	timeout := options.InspectFileTimeout
+
+	if idx := strings.LastIndexAny(target, " \t"); idx != -1 && strings.HasPrefix(target[idx+1:], inspectFileTimeoutArg) {
+		d, err := time.ParseDuration(target[idx+1+len(inspectFileTimeoutArg):])
+		if err != nil {
+			return "", 0, fmt.Errorf("invalid timeout: %w", err)
+		}
+		timeout = d
+		target = strings.TrimSpace(target[:idx])
+	}
+
+	if target == "" {
+		return "", 0, fmt.Errorf("missing file inspector")
+	}
+
+	if timeout < 0 {
+		return "", 0, fmt.Errorf("invalid timeout: %s", timeout)
+	}
+	if timeout == 0 {
+		timeout = defaultInspectFileTimeout
+	}
+
+	return target, timeout, nil
+}
+
+// goInspectFile runs a registered in-process inspector
+type goInspectFile struct {
+	name    string
+	fn      plugintypes.FileInspector
+	timeout time.Duration
+}
+
+var _ plugintypes.Operator = (*goInspectFile)(nil)
+
+func newGoInspectFile(target string, timeout time.Duration) (plugintypes.Operator, error) {
+	name := strings.TrimPrefix(target, goInspectorPrefix)
+	fn, ok := fileInspectors[name]
+	if !ok {
+		return nil, fmt.Errorf("file inspector %s not found", name)
+	}
+	return &goInspectFile{name: name, fn: fn, timeout: timeout}, nil
+}
+
+// Evaluate runs the inspector with a context cancelled after the timeout. The timeout is
+// only enforced by the inspectors honouring the context, the others are not interrupted.
+func (o *goInspectFile) Evaluate(tx plugintypes.TransactionState, value string) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), o.timeout)
+	defer cancel()
+
+	match, err := o.fn(ctx, tx, value)
+	if err == nil && ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	if err != nil {
+		if tx == nil {
+			return false
+		}
+		tx.DebugLogger().Debug().
+			Str("operator", "inspectFile").
+			Str("inspector", o.name).
+			Err(err).
+			Msg("File inspection failed")
+		return false
+	}
+	return match
+}
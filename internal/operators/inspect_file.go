@@ -8,30 +8,67 @@ package operators
 
 import (
 	"context"
+	"os"
 	"os/exec"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/corazawaf/coraza/v3/experimental/plugins/plugintypes"
 )
 
+// inspectFileWaitDelay bounds the wait for the output of the children of a killed program
+const inspectFileWaitDelay = 100 * time.Millisecond
+
 type inspectFile struct {
-	path string
+	path    string
+	timeout time.Duration
 }
 
 var _ plugintypes.Operator = (*inspectFile)(nil)
 
 func newInspectFile(options plugintypes.OperatorOptions) (plugintypes.Operator, error) {
-	return &inspectFile{path: options.Arguments}, nil
+	target, timeout, err := parseInspectFileArguments(options)
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.HasPrefix(target, goInspectorPrefix) {
+		return newGoInspectFile(target, timeout)
+	}
+
+	return &inspectFile{path: resolveInspectFilePath(target, options.Path), timeout: timeout}, nil
+}
+
+// resolveInspectFilePath resolves relative paths against the configuration
+// directories like @pmFromFile does. As the program is executed, the OS
+// filesystem is used instead of the parser root. Unresolved names are kept
+// as is so that they are looked up in the PATH.
+func resolveInspectFilePath(path string, dirs []string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+
+	for _, dir := range dirs {
+		if dir == "" {
+			continue
+		}
+		candidate := filepath.Join(dir, path)
+		if fi, err := os.Stat(candidate); err == nil && !fi.IsDir() {
+			return candidate
+		}
+	}
+
+	return path
 }
 
 func (o *inspectFile) Evaluate(tx plugintypes.TransactionState, value string) bool {
-	// TODO parametrize timeout
-	// TODO add relative path capabilities
 	// TODO add lua special support
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), o.timeout)
 	defer cancel()
 	// Add /bin/bash to context?
 	cmd := exec.CommandContext(ctx, o.path, value)
+	cmd.WaitDelay = inspectFileWaitDelay
 	output, err := cmd.CombinedOutput()
 	if ctx.Err() == context.DeadlineExceeded || err != nil {
 		return false
@@ -7,12 +7,17 @@
 package operators
 
 import (
+	"context"
+	"errors"
 	_ "fmt"
+	"os"
 	"path/filepath"
 	"runtime"
 	"testing"
+	"time"
 
 	"github.com/corazawaf/coraza/v3/experimental/plugins/plugintypes"
+	"github.com/corazawaf/coraza/v3/internal/corazawaf"
 )
 
 func TestInspectFileExitCode(t *testing.T) {
@@ -83,3 +88,138 @@ func TestInspectFileOutput(t *testing.T) {
 		})
 	}
 }
+
+func TestInspectFileArguments(t *testing.T) {
+	tests := []struct {
+		args    string
+		timeout time.Duration
+		target  string
+		dirTO   time.Duration
+		wantErr bool
+	}{
+		{args: "/bin/echo", target: "/bin/echo", timeout: defaultInspectFileTimeout},
+		{args: "/bin/echo", dirTO: time.Second, target: "/bin/echo", timeout: time.Second},
+		{args: "/bin/echo timeout=250ms", dirTO: time.Second, target: "/bin/echo", timeout: 250 * time.Millisecond},
+		{args: "go:stub timeout=2s", target: "go:stub", timeout: 2 * time.Second},
+		{args: "/bin/echo timeout=abc", wantErr: true},
+		{args: "/bin/echo timeout=-1s", wantErr: true},
+		{args: "", wantErr: true},
+	}
+
+	for _, tc := range tests {
+		tt := tc
+		t.Run(tt.args, func(t *testing.T) {
+			target, timeout, err := parseInspectFileArguments(plugintypes.OperatorOptions{
+				Arguments:          tt.args,
+				InspectFileTimeout: tt.dirTO,
+			})
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if want, have := tt.target, target; want != have {
+				t.Errorf("unexpected target: want %q, have %q", want, have)
+			}
+			if want, have := tt.timeout, timeout; want != have {
+				t.Errorf("unexpected timeout: want %s, have %s", want, have)
+			}
+		})
+	}
+}
+
+func TestInspectFileRelativePath(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Skipping test on Windows")
+	}
+
+	dir := t.TempDir()
+	script := filepath.Join(dir, "scan.sh")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\necho \"0 found $1\"\n"), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	ipf, err := newInspectFile(plugintypes.OperatorOptions{
+		Arguments: "scan.sh",
+		Path:      []string{filepath.Join(dir, "missing"), dir},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, have := script, ipf.(*inspectFile).path; want != have {
+		t.Errorf("unexpected path: want %q, have %q", want, have)
+	}
+	if !ipf.Evaluate(nil, "upload.bin") {
+		t.Error("expected match")
+	}
+}
+
+func TestInspectFileTimeout(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Skipping test on Windows")
+	}
+
+	dir := t.TempDir()
+	script := filepath.Join(dir, "slow.sh")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\nsleep 2\necho 0\n"), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	ipf, err := newInspectFile(plugintypes.OperatorOptions{Arguments: script + " timeout=50ms"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	if ipf.Evaluate(nil, "upload.bin") {
+		t.Error("unexpected match on timeout")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("timeout not enforced, took %s", elapsed)
+	}
+}
+
+func TestInspectFileGoInspector(t *testing.T) {
+	RegisterFileInspector("clamav-stub", func(ctx context.Context, _ plugintypes.TransactionState, path string) (bool, error) {
+		switch path {
+		case "eicar.com":
+			return true, nil
+		case "slow.bin":
+			<-ctx.Done()
+			return true, nil
+		case "broken.bin":
+			return true, errors.New("cannot read file")
+		}
+		return false, nil
+	})
+
+	if _, err := newInspectFile(plugintypes.OperatorOptions{Arguments: "go:unknown"}); err == nil {
+		t.Error("expected error for unknown inspector")
+	}
+
+	ipf, err := newInspectFile(plugintypes.OperatorOptions{Arguments: "go:clamav-stub timeout=50ms"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx := corazawaf.NewWAF().NewTransaction()
+	tests := map[string]bool{
+		"eicar.com":  true,
+		"clean.txt":  false,
+		"slow.bin":   false,
+		"broken.bin": false,
+	}
+	for path, want := range tests {
+		if have := ipf.Evaluate(tx, path); want != have {
+			t.Errorf("inspector result for %s: want %t, have %t", path, want, have)
+		}
+	}
+
+	// errors are only logged when there is a transaction
+	if ipf.Evaluate(nil, "broken.bin") {
+		t.Error("unexpected match for a failed inspection")
+	}
+}
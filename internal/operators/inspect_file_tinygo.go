@@ -7,15 +7,30 @@
 package operators
 
 import (
+	"strings"
+
 	"github.com/corazawaf/coraza/v3/experimental/plugins/plugintypes"
 )
 
 type inspectFile struct{}
 
-func newInspectFile(plugintypes.OperatorOptions) (plugintypes.Operator, error) {
+// newInspectFile only supports in-process inspectors as programs can't be executed.
+// Programs are replaced by an operator always matching, so @inspectFile is reported as
+// unavailable to <IfOperator>, even if the Go inspectors, e.g. go:clamav, keep working.
+func newInspectFile(options plugintypes.OperatorOptions) (plugintypes.Operator, error) {
+	target, timeout, err := parseInspectFileArguments(options)
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.HasPrefix(target, goInspectorPrefix) {
+		return newGoInspectFile(target, timeout)
+	}
+
 	return &unconditionalMatch{}, nil
 }
 
 func init() {
 	Register("inspectFile", newInspectFile)
+	stubs["inspectFile"] = struct{}{}
 }
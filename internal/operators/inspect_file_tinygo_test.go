@@ -0,0 +1,22 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build tinygo
+// +build tinygo
+
+package operators
+
+import (
+	"testing"
+)
+
+func TestStubsUnavailable(t *testing.T) {
+	for _, name := range []string{"inspectFile", "rbl"} {
+		if Available(name) {
+			t.Errorf("unexpected @%s available in TinyGo", name)
+		}
+		if _, ok := operators[name]; !ok {
+			t.Errorf("expected @%s to be registered for compatibility", name)
+		}
+	}
+}
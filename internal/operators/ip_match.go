@@ -6,14 +6,15 @@
 package operators
 
 import (
-	"net"
+	"net/netip"
 	"strings"
 
 	"github.com/corazawaf/coraza/v3/experimental/plugins/plugintypes"
+	"github.com/corazawaf/coraza/v3/internal/memoize"
 )
 
 type ipMatch struct {
-	subnets []net.IPNet
+	trie *ipTrie
 }
 
 var _ plugintypes.Operator = (*ipMatch)(nil)
@@ -21,36 +22,31 @@ var _ plugintypes.Operator = (*ipMatch)(nil)
 func newIPMatch(options plugintypes.OperatorOptions) (plugintypes.Operator, error) {
 	data := options.Arguments
 
-	var subnets []net.IPNet
-	for _, sb := range strings.Split(data, ",") {
-		sb = strings.TrimSpace(sb)
-		if sb == "" {
-			continue
-		}
-		if strings.Contains(sb, ":") && !strings.Contains(sb, "/") {
-			// ipv6
-			sb += "/128"
-		} else if strings.Contains(sb, ".") && !strings.Contains(sb, "/") {
-			// ipv4
-			sb += "/32"
-		}
-		_, subnet, err := net.ParseCIDR(sb)
-		if err != nil {
-			continue
-		}
-		subnets = append(subnets, *subnet)
-	}
-	return &ipMatch{subnets: subnets}, nil
+	return newMemoizedIPMatch(data, func() []string { return strings.Split(data, ",") }), nil
+}
+
+// newMemoizedIPMatch builds an ipMatch operator whose trie is shared by all the
+// operators built with the same key.
+func newMemoizedIPMatch(key string, entries func() []string) *ipMatch {
+	t, _ := memoize.Do("ipMatch:"+key, func() (interface{}, error) { return newIPTrie(entries()), nil })
+	return &ipMatch{trie: t.(*ipTrie)}
 }
 
 func (o *ipMatch) Evaluate(tx plugintypes.TransactionState, value string) bool {
-	ip := net.ParseIP(value)
-	for _, subnet := range o.subnets {
-		if subnet.Contains(ip) {
-			return true
-		}
+	addr, err := netip.ParseAddr(value)
+	if err != nil {
+		return false
+	}
+
+	prefix, ok := o.trie.lookup(addr)
+	if !ok {
+		return false
+	}
+
+	if tx != nil && tx.Capturing() {
+		tx.CaptureField(0, prefix)
 	}
-	return false
+	return true
 }
 
 func init() {
@@ -7,11 +7,18 @@ package operators
 
 import (
 	"fmt"
-	"strings"
+	"sync/atomic"
 
 	"github.com/corazawaf/coraza/v3/experimental/plugins/plugintypes"
 )
 
+type ipMatchFromDataset struct {
+	dataset string
+	matcher atomic.Pointer[ipMatch]
+}
+
+var _ plugintypes.DatasetOperator = (*ipMatchFromDataset)(nil)
+
 func newIPMatchFromDataset(options plugintypes.OperatorOptions) (plugintypes.Operator, error) {
 	data := options.Arguments
 	dataset, ok := options.Datasets[data]
@@ -19,12 +26,29 @@ func newIPMatchFromDataset(options plugintypes.OperatorOptions) (plugintypes.Ope
 		return nil, fmt.Errorf("dataset %q not found", data)
 	}
 
-	datasetParsed := strings.Join(dataset, ",")
-
-	opts := plugintypes.OperatorOptions{
-		Arguments: datasetParsed,
+	o := &ipMatchFromDataset{dataset: data}
+	commit, err := o.PrepareDataset(dataset)
+	if err != nil {
+		return nil, err
 	}
-	return newIPMatch(opts)
+	commit()
+	return o, nil
+}
+
+func (o *ipMatchFromDataset) Evaluate(tx plugintypes.TransactionState, value string) bool {
+	return o.matcher.Load().Evaluate(tx, value)
+}
+
+func (o *ipMatchFromDataset) Dataset() string {
+	return o.dataset
+}
+
+// PrepareDataset accepts an empty list of values, e.g. a blocklist emptied by its feed,
+// which then matches no address.
+func (o *ipMatchFromDataset) PrepareDataset(values []string) (func(), error) {
+	// Updated datasets are not memoized as they are specific to this WAF.
+	matcher := &ipMatch{trie: newIPTrie(values)}
+	return func() { o.matcher.Store(matcher) }, nil
 }
 
 func init() {
@@ -50,3 +50,42 @@ func TestIpMatchFromEmptyDataset(t *testing.T) {
 		t.Error("Empty dataset not checked")
 	}
 }
+
+func TestIpMatchFromDatasetUpdate(t *testing.T) {
+	opts := plugintypes.OperatorOptions{
+		Arguments: "test_1",
+		Datasets: map[string][]string{
+			"test_1": {"127.0.0.1"},
+		},
+	}
+
+	ipm, err := newIPMatchFromDataset(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dop := ipm.(plugintypes.DatasetOperator)
+	if want, have := "test_1", dop.Dataset(); want != have {
+		t.Errorf("unexpected dataset: want %q, have %q", want, have)
+	}
+
+	commit, err := dop.PrepareDataset([]string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ipm.Evaluate(nil, "127.0.0.1") || ipm.Evaluate(nil, "10.1.1.1") {
+		t.Error("dataset updated before commit")
+	}
+	commit()
+	if ipm.Evaluate(nil, "127.0.0.1") || !ipm.Evaluate(nil, "10.1.1.1") {
+		t.Error("dataset not updated after commit")
+	}
+
+	commit, err = dop.PrepareDataset(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	commit()
+	if ipm.Evaluate(nil, "10.1.1.1") {
+		t.Error("empty dataset matched")
+	}
+}
@@ -21,25 +21,22 @@ func newIPMatchFromFile(options plugintypes.OperatorOptions) (plugintypes.Operat
 		return nil, err
 	}
 
-	dataParsed := strings.Builder{}
-	sc := bufio.NewScanner(bytes.NewReader(data))
-	for sc.Scan() {
-		l := sc.Text()
-		l = strings.TrimSpace(l)
-		if len(l) == 0 {
-			continue
+	return newMemoizedIPMatch(strings.Join(options.Path, ",")+path, func() []string {
+		var entries []string
+		sc := bufio.NewScanner(bytes.NewReader(data))
+		for sc.Scan() {
+			l := sc.Text()
+			l = strings.TrimSpace(l)
+			if len(l) == 0 {
+				continue
+			}
+			if l[0] == '#' {
+				continue
+			}
+			entries = append(entries, l)
 		}
-		if l[0] == '#' {
-			continue
-		}
-		dataParsed.WriteString(",")
-		dataParsed.WriteString(l)
-	}
-
-	opts := plugintypes.OperatorOptions{
-		Arguments: dataParsed.String(),
-	}
-	return newIPMatch(opts)
+		return entries
+	}), nil
 }
 
 func init() {
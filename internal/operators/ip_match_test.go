@@ -5,9 +5,14 @@ package operators
 
 import (
 	_ "fmt"
+	"math/rand"
+	"net"
+	"net/netip"
+	"strconv"
 	"testing"
 
 	"github.com/corazawaf/coraza/v3/experimental/plugins/plugintypes"
+	"github.com/corazawaf/coraza/v3/internal/corazawaf"
 )
 
 func TestOneAddress(t *testing.T) {
@@ -52,3 +57,110 @@ func TestMultipleAddress(t *testing.T) {
 		}
 	}
 }
+
+func TestIPMatchLongestPrefix(t *testing.T) {
+	ipm, err := newIPMatch(plugintypes.OperatorOptions{
+		Arguments: "10.0.0.0/8, 10.1.0.0/16, 10.1.2.3, 0.0.0.0/0, 2001:db8::/32, 2001:db8:1::/48, ::ffff:192.168.0.0/112, invalid",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := corazawaf.NewWAF().NewTransaction()
+	tx.Capture = true
+
+	tests := []struct {
+		addr  string
+		match string
+	}{
+		{"10.1.2.3", "10.1.2.3"},
+		{"10.1.2.4", "10.1.0.0/16"},
+		{"10.2.0.1", "10.0.0.0/8"},
+		{"11.0.0.1", "0.0.0.0/0"},
+		{"::ffff:10.1.2.3", "10.1.2.3"},
+		{"192.168.1.1", "::ffff:192.168.0.0/112"},
+		{"2001:db8:1::1", "2001:db8:1::/48"},
+		{"2001:db8:2::1", "2001:db8::/32"},
+		{"2001:db9::1", ""},
+		{"not an ip", ""},
+	}
+	for _, tc := range tests {
+		t.Run(tc.addr, func(t *testing.T) {
+			tx.CaptureField(0, "")
+			if want, have := tc.match != "", ipm.Evaluate(tx, tc.addr); want != have {
+				t.Fatalf("unexpected result: want %t, have %t", want, have)
+			}
+			if want, have := tc.match, tx.Variables().TX().Get("0")[0]; want != have {
+				t.Errorf("unexpected capture: want %q, have %q", want, have)
+			}
+		})
+	}
+}
+
+func TestIPTrieMatchesNaiveLookup(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	entries := randomPrefixes(r, 2000)
+	trie := newIPTrie(entries)
+
+	var subnets []*net.IPNet
+	for _, e := range entries {
+		_, n, err := net.ParseCIDR(e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		subnets = append(subnets, n)
+	}
+
+	for i := 0; i < 20000; i++ {
+		addr := randomAddr(r)
+		want := false
+		for _, n := range subnets {
+			if n.Contains(addr.AsSlice()) {
+				want = true
+				break
+			}
+		}
+		if _, have := trie.lookup(addr); want != have {
+			t.Fatalf("unexpected result for %s: want %t, have %t", addr, want, have)
+		}
+	}
+}
+
+func randomAddr(r *rand.Rand) netip.Addr {
+	if r.Intn(2) == 0 {
+		// Keep a small address space so that random addresses hit the prefixes
+		return netip.AddrFrom4([4]byte{10, byte(r.Intn(4)), byte(r.Intn(256)), byte(r.Intn(256))})
+	}
+	var b [16]byte
+	b[0], b[1], b[2] = 0x20, 0x01, byte(r.Intn(4))
+	r.Read(b[3:])
+	return netip.AddrFrom16(b)
+}
+
+func randomPrefixes(r *rand.Rand, n int) []string {
+	entries := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		addr := randomAddr(r)
+		bits := 8 + r.Intn(addr.BitLen()-7)
+		entries = append(entries, netip.PrefixFrom(addr, bits).Masked().String())
+	}
+	return entries
+}
+
+func BenchmarkIPMatch(b *testing.B) {
+	for _, size := range []int{10, 1000, 100000, 1000000} {
+		r := rand.New(rand.NewSource(1))
+		trie := newIPTrie(randomPrefixes(r, size))
+		ipm := &ipMatch{trie: trie}
+		addrs := make([]string, 1024)
+		for i := range addrs {
+			addrs[i] = randomAddr(r).String()
+		}
+
+		b.Run(strconv.Itoa(size), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				ipm.Evaluate(nil, addrs[i%len(addrs)])
+			}
+		})
+	}
+}
@@ -0,0 +1,196 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package operators
+
+import (
+	"math/bits"
+	"net/netip"
+	"strings"
+)
+
+// ipTrie is a path compressed binary trie (Patricia trie) of IPv4 and IPv6 prefixes.
+// Lookups walk at most one node per distinct prefix length along the path of the
+// address, so their cost depends on the address length rather than on the number of
+// prefixes. Once built, the trie is read-only and safe to share across rules and
+// transactions.
+type ipTrie struct {
+	v4 *ipTrieNode
+	v6 *ipTrieNode
+}
+
+// ipTrieNode holds a prefix of up to 128 bits, IPv4 prefixes are stored in the most
+// significant bits of hi.
+type ipTrieNode struct {
+	hi, lo uint64
+	bits   int
+	// entry is the prefix as it was listed, it is empty for branching nodes
+	// that don't represent a listed prefix.
+	entry string
+	child [2]*ipTrieNode
+}
+
+// parseIPPrefix parses an IP address or a CIDR. Addresses are treated as single host
+// prefixes and IPv4-mapped IPv6 addresses as IPv4.
+func parseIPPrefix(s string) (netip.Prefix, bool) {
+	if strings.Contains(s, "/") {
+		p, err := netip.ParsePrefix(s)
+		if err != nil {
+			return netip.Prefix{}, false
+		}
+		if p.Addr().Is4In6() && p.Bits() >= 96 {
+			p = netip.PrefixFrom(p.Addr().Unmap(), p.Bits()-96)
+		}
+		return p.Masked(), true
+	}
+
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, false
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), true
+}
+
+// newIPTrie builds a trie from a list of IP addresses and CIDRs, invalid entries
+// are ignored.
+func newIPTrie(entries []string) *ipTrie {
+	t := &ipTrie{}
+	for _, e := range entries {
+		e = strings.TrimSpace(e)
+		if e == "" {
+			continue
+		}
+		p, ok := parseIPPrefix(e)
+		if !ok {
+			continue
+		}
+		t.insert(p, e)
+	}
+	return t
+}
+
+func addrKey(addr netip.Addr) (uint64, uint64) {
+	if addr.Is4() {
+		b := addr.As4()
+		return uint64(b[0])<<56 | uint64(b[1])<<48 | uint64(b[2])<<40 | uint64(b[3])<<32, 0
+	}
+	b := addr.As16()
+	var hi, lo uint64
+	for i := 0; i < 8; i++ {
+		hi = hi<<8 | uint64(b[i])
+		lo = lo<<8 | uint64(b[i+8])
+	}
+	return hi, lo
+}
+
+// commonPrefixLen returns the number of leading bits shared by both keys
+func commonPrefixLen(hi1, lo1, hi2, lo2 uint64) int {
+	if x := hi1 ^ hi2; x != 0 {
+		return bits.LeadingZeros64(x)
+	}
+	return 64 + bits.LeadingZeros64(lo1^lo2)
+}
+
+// bitAt returns the bit at position i, counting from the most significant one
+func bitAt(hi, lo uint64, i int) int {
+	if i < 64 {
+		return int(hi>>(63-i)) & 1
+	}
+	return int(lo>>(127-i)) & 1
+}
+
+// maskKey keeps only the first n bits of the key
+func maskKey(hi, lo uint64, n int) (uint64, uint64) {
+	switch {
+	case n == 0:
+		return 0, 0
+	case n < 64:
+		return hi & ^(^uint64(0) >> n), 0
+	case n == 64:
+		return hi, 0
+	case n < 128:
+		return hi, lo & ^(^uint64(0) >> (n - 64))
+	default:
+		return hi, lo
+	}
+}
+
+func (t *ipTrie) insert(p netip.Prefix, entry string) {
+	hi, lo := addrKey(p.Addr())
+	n := &t.v6
+	if p.Addr().Is4() {
+		n = &t.v4
+	}
+	plen := p.Bits()
+
+	for {
+		node := *n
+		if node == nil {
+			*n = &ipTrieNode{hi: hi, lo: lo, bits: plen, entry: entry}
+			return
+		}
+
+		common := commonPrefixLen(hi, lo, node.hi, node.lo)
+		if common > plen {
+			common = plen
+		}
+		if common > node.bits {
+			common = node.bits
+		}
+
+		if common == node.bits {
+			if node.bits == plen {
+				// Duplicated prefix, or a branching node becoming a listed prefix.
+				if node.entry == "" {
+					node.entry = entry
+				}
+				return
+			}
+			n = &node.child[bitAt(hi, lo, node.bits)]
+			continue
+		}
+
+		if common == plen {
+			// The new prefix contains the existing node.
+			leaf := &ipTrieNode{hi: hi, lo: lo, bits: plen, entry: entry}
+			leaf.child[bitAt(node.hi, node.lo, plen)] = node
+			*n = leaf
+			return
+		}
+
+		// Both prefixes diverge after the common bits, add a branching node.
+		bhi, blo := maskKey(hi, lo, common)
+		branch := &ipTrieNode{hi: bhi, lo: blo, bits: common}
+		branch.child[bitAt(hi, lo, common)] = &ipTrieNode{hi: hi, lo: lo, bits: plen, entry: entry}
+		branch.child[bitAt(node.hi, node.lo, common)] = node
+		*n = branch
+		return
+	}
+}
+
+// lookup returns the most specific listed prefix containing the address
+func (t *ipTrie) lookup(addr netip.Addr) (string, bool) {
+	addr = addr.Unmap()
+	hi, lo := addrKey(addr)
+	node := t.v6
+	if addr.Is4() {
+		node = t.v4
+	}
+	maxBits := addr.BitLen()
+
+	var match string
+	for node != nil {
+		if commonPrefixLen(hi, lo, node.hi, node.lo) < node.bits {
+			break
+		}
+		if node.entry != "" {
+			match = node.entry
+		}
+		if node.bits >= maxBits {
+			break
+		}
+		node = node.child[bitAt(hi, lo, node.bits)]
+	}
+	return match, match != ""
+}
@@ -11,6 +11,10 @@ import (
 
 var operators = map[string]plugintypes.OperatorFactory{}
 
+// stubs are the operators registered for compatibility which are not evaluated in this
+// build, e.g. @rbl in TinyGo always matches
+var stubs = map[string]struct{}{}
+
 // Get returns an operator by name
 func Get(name string, options plugintypes.OperatorOptions) (plugintypes.Operator, error) {
 	if op, ok := operators[name]; ok {
@@ -19,6 +23,15 @@ func Get(name string, options plugintypes.OperatorOptions) (plugintypes.Operator
 	return nil, fmt.Errorf("operator %s not found", name)
 }
 
+// Available returns whether the operator is registered and evaluated in this build
+func Available(name string) bool {
+	if _, ok := stubs[name]; ok {
+		return false
+	}
+	_, ok := operators[name]
+	return ok
+}
+
 // Register registers a new operator
 // If the operator already exists it will be overwritten
 func Register(name string, op plugintypes.OperatorFactory) {
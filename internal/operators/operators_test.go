@@ -144,3 +144,17 @@ func unmarshalTests(t *testing.T, json []byte) []Test {
 	}
 	return tests
 }
+
+func TestAvailable(t *testing.T) {
+	if !Available("rx") {
+		t.Error("expected @rx to be available")
+	}
+	if Available("unknown") {
+		t.Error("unexpected unknown operator available")
+	}
+	stubs["rx"] = struct{}{}
+	defer delete(stubs, "rx")
+	if Available("rx") {
+		t.Error("unexpected stub operator available")
+	}
+}
@@ -7,6 +7,7 @@ package operators
 
 import (
 	"fmt"
+	"sync/atomic"
 
 	ahocorasick "github.com/petar-dambovaliev/aho-corasick"
 
@@ -14,22 +15,50 @@ import (
 	"github.com/corazawaf/coraza/v3/internal/memoize"
 )
 
+type pmFromDataset struct {
+	dataset string
+	matcher atomic.Pointer[ahocorasick.AhoCorasick]
+}
+
+var _ plugintypes.DatasetOperator = (*pmFromDataset)(nil)
+
 func newPMFromDataset(options plugintypes.OperatorOptions) (plugintypes.Operator, error) {
 	data := options.Arguments
 	dataset, ok := options.Datasets[data]
 	if !ok {
 		return nil, fmt.Errorf("dataset %q not found", data)
 	}
+
+	m, _ := memoize.Do(data, func() (interface{}, error) { return buildPMFromDataset(dataset), nil })
+	matcher := m.(ahocorasick.AhoCorasick)
+
+	o := &pmFromDataset{dataset: data}
+	o.matcher.Store(&matcher)
+	return o, nil
+}
+
+func buildPMFromDataset(dataset []string) ahocorasick.AhoCorasick {
 	builder := ahocorasick.NewAhoCorasickBuilder(ahocorasick.Opts{
 		AsciiCaseInsensitive: true,
 		MatchOnlyWholeWords:  false,
 		MatchKind:            ahocorasick.LeftMostLongestMatch,
 		DFA:                  true,
 	})
+	return builder.Build(dataset)
+}
 
-	m, _ := memoize.Do(data, func() (interface{}, error) { return builder.Build(dataset), nil })
+func (o *pmFromDataset) Evaluate(tx plugintypes.TransactionState, value string) bool {
+	return pmEvaluate(*o.matcher.Load(), tx, value)
+}
+
+func (o *pmFromDataset) Dataset() string {
+	return o.dataset
+}
 
-	return &pm{matcher: m.(ahocorasick.AhoCorasick)}, nil
+func (o *pmFromDataset) PrepareDataset(values []string) (func(), error) {
+	// Updated datasets are not memoized as they are specific to this WAF.
+	matcher := buildPMFromDataset(values)
+	return func() { o.matcher.Store(&matcher) }, nil
 }
 
 func init() {
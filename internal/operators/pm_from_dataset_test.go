@@ -35,3 +35,29 @@ func TestPmFromDataset(t *testing.T) {
 		t.Error(fmt.Errorf("pmFromDataset should have failed"))
 	}
 }
+
+func TestPmFromDatasetUpdate(t *testing.T) {
+	opts := plugintypes.OperatorOptions{
+		Arguments: "test_update",
+		Datasets: map[string][]string{
+			"test_update": {"attack"},
+		},
+	}
+	pm, err := newPMFromDataset(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := corazawaf.NewWAF().NewTransaction()
+
+	commit, err := pm.(plugintypes.DatasetOperator).PrepareDataset([]string{"exploit"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !pm.Evaluate(tx, "an attack") || pm.Evaluate(tx, "an exploit") {
+		t.Error("dataset updated before commit")
+	}
+	commit()
+	if pm.Evaluate(tx, "an attack") || !pm.Evaluate(tx, "an exploit") {
+		t.Error("dataset not updated after commit")
+	}
+}
@@ -8,81 +8,327 @@ package operators
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
+	"golang.org/x/sync/singleflight"
+
 	"github.com/corazawaf/coraza/v3/experimental/plugins/plugintypes"
 )
 
-const timeout = 500 * time.Millisecond
+const (
+	// defaultRBLTimeout is used when SecRblTimeout is not set
+	defaultRBLTimeout = 500 * time.Millisecond
+
+	// rblPositiveTTL is the time a listed address is kept in the cache
+	rblPositiveTTL = 5 * time.Minute
+
+	// rblNegativeTTL is the time a non listed address is kept in the cache
+	rblNegativeTTL = time.Minute
+
+	// rblMaxCacheEntries caps the memory used by the lookup cache
+	rblMaxCacheEntries = 10000
+
+	// rblMaxConcurrentLookups caps the DNS queries in-flight across all transactions
+	rblMaxConcurrentLookups = 64
+
+	httpBLService = "dnsbl.httpbl.org"
+)
 
 type rbl struct {
 	service  string
+	httpBL   bool
+	key      string
+	timeout  time.Duration
 	resolver *net.Resolver
+	cache    *rblCache
 }
 
 var _ plugintypes.Operator = (*rbl)(nil)
 
 func newRBL(options plugintypes.OperatorOptions) (plugintypes.Operator, error) {
-	data := options.Arguments
+	service := strings.Trim(strings.TrimSpace(options.Arguments), ".")
+	if service == "" {
+		return nil, errors.New("missing RBL service")
+	}
+
+	timeout := options.RBLTimeout
+	if timeout <= 0 {
+		timeout = defaultRBLTimeout
+	}
+
+	httpBL := service == httpBLService || strings.HasSuffix(service, "."+httpBLService)
+	if httpBL && options.HTTPBLKey == "" {
+		return nil, fmt.Errorf("missing SecHttpBlKey for RBL service %q", service)
+	}
 
 	return &rbl{
-		service:  data,
+		service:  service,
+		httpBL:   httpBL,
+		key:      options.HTTPBLKey,
+		timeout:  timeout,
 		resolver: net.DefaultResolver,
+		cache:    defaultRBLCache,
 	}, nil
 }
 
 // https://github.com/mrichman/godnsbl
 // https://github.com/SpiderLabs/ModSecurity/blob/b66224853b4e9d30e0a44d16b29d5ed3842a6b11/src/operators/rbl.cc
 func (o *rbl) Evaluate(tx plugintypes.TransactionState, ipAddr string) bool {
-	// TODO validate address
-	resC := make(chan bool)
-	ctx, cancel := context.WithCancel(context.Background())
-
-	defer func() {
-		cancel()
-	}()
-
-	addr := fmt.Sprintf("%s.%s", ipAddr, o.service)
-	var captures []string
-	go func(ctx context.Context) {
-		defer func() {
-			close(resC)
-		}()
-		res, err := o.resolver.LookupHost(ctx, addr)
+	name, ok := o.queryName(ipAddr)
+	if !ok {
+		tx.DebugLogger().Debug().
+			Str("operator", "rbl").
+			Str("value", ipAddr).
+			Msg("Skipping RBL lookup for invalid IP address")
+		return false
+	}
 
-		if err != nil {
-			resC <- false
-			return
+	res, err := o.cache.lookup(name, o.timeout, o.resolve)
+	if err != nil {
+		tx.DebugLogger().Debug().
+			Str("operator", "rbl").
+			Str("query", name).
+			Err(err).
+			Msg("RBL lookup failed")
+		return false
+	}
+
+	if !res.listed {
+		return false
+	}
+
+	if res.msg != "" {
+		tx.Variables().TX().Set("httpbl_msg", []string{res.msg})
+		if tx.Capturing() {
+			tx.CaptureField(0, res.msg)
 		}
-		// var status string
-		if len(res) > 0 {
-			txt, err := o.resolver.LookupTXT(ctx, addr)
-			if err != nil {
-				resC <- false
-				return
-			}
+	}
+	return true
+}
+
+// queryName builds the DNS name to be queried for the given IP address. IPv4
+// octets and IPv6 nibbles are reversed as required by DNSBLs, and the http:BL
+// access key is prepended when querying Project Honeypot.
+func (o *rbl) queryName(value string) (string, bool) {
+	ip := net.ParseIP(strings.TrimSpace(value))
+	if ip == nil {
+		return "", false
+	}
 
-			if len(txt) > 0 {
-				status := txt[0]
-				captures = append(captures, status)
-				tx.Variables().TX().Set("httpbl_msg", []string{status})
+	var sb strings.Builder
+	if o.httpBL {
+		sb.WriteString(o.key)
+		sb.WriteByte('.')
+	}
+	writeReverseIP(&sb, ip)
+	sb.WriteByte('.')
+	sb.WriteString(o.service)
+	return sb.String(), true
+}
+
+func writeReverseIP(sb *strings.Builder, ip net.IP) {
+	const hexDigits = "0123456789abcdef"
+
+	if ip4 := ip.To4(); ip4 != nil {
+		for i := len(ip4) - 1; i >= 0; i-- {
+			sb.WriteString(strconv.Itoa(int(ip4[i])))
+			if i > 0 {
+				sb.WriteByte('.')
 			}
 		}
+		return
+	}
 
-		resC <- true
-	}(ctx)
+	ip6 := ip.To16()
+	for i := len(ip6) - 1; i >= 0; i-- {
+		sb.WriteByte(hexDigits[ip6[i]&0x0f])
+		sb.WriteByte('.')
+		sb.WriteByte(hexDigits[ip6[i]>>4])
+		if i > 0 {
+			sb.WriteByte('.')
+		}
+	}
+}
+
+// resolve queries the RBL service. Names that do not exist are reported as not
+// listed without error so that they can be negatively cached. The TXT record is
+// optional, listed addresses without one are reported with no message.
+func (o *rbl) resolve(ctx context.Context, name string) (rblResult, error) {
+	addrs, err := o.resolver.LookupHost(ctx, name)
+	if err != nil {
+		return rblResult{}, ignoreNotFound(err)
+	}
+	if len(addrs) == 0 {
+		return rblResult{}, nil
+	}
+
+	if o.httpBL {
+		return decodeHTTPBL(addrs[0]), nil
+	}
 
-	select {
-	case res := <-resC:
-		if res && len(captures) > 0 {
-			tx.CaptureField(0, captures[0])
+	// the A record lists the address, like in ModSecurity the TXT record only
+	// describes the listing and is optional
+	res := rblResult{listed: true}
+	if txt, err := o.resolver.LookupTXT(ctx, name); err == nil && len(txt) > 0 {
+		res.msg = txt[0]
+	}
+	return res, nil
+}
+
+func ignoreNotFound(err error) error {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+		return nil
+	}
+	return err
+}
+
+// decodeHTTPBL decodes an http:BL response in the form 127.days.threat.type
+// https://www.projecthoneypot.org/httpbl_api.php
+func decodeHTTPBL(addr string) rblResult {
+	ip := net.ParseIP(addr).To4()
+	if ip == nil || ip[0] != 127 {
+		// Any other response is an http:BL error, e.g. an invalid access key.
+		return rblResult{}
+	}
+
+	var visitor string
+	switch ip[3] {
+	case 0:
+		visitor = "Search Engine"
+	case 1:
+		visitor = "Suspicious IP"
+	case 2:
+		visitor = "Harvester IP"
+	case 3:
+		visitor = "Suspicious harvester IP"
+	case 4:
+		visitor = "Comment spammer IP"
+	case 5:
+		visitor = "Suspicious comment spammer IP"
+	case 6:
+		visitor = "Harvester and comment spammer IP"
+	case 7:
+		visitor = "Suspicious harvester comment spammer IP"
+	default:
+		visitor = "Unknown visitor type"
+	}
+
+	return rblResult{
+		listed: true,
+		msg:    fmt.Sprintf("%s: %d days since last activity, threat score %d", visitor, ip[1], ip[2]),
+	}
+}
+
+type rblResult struct {
+	listed bool
+	msg    string
+}
+
+type rblCacheEntry struct {
+	rblResult
+	expiresAt time.Time
+}
+
+// rblCache is a TTL cache of RBL results shared by all the @rbl operators. Concurrent
+// lookups for the same name are collapsed and the total number of in-flight lookups
+// is bounded.
+type rblCache struct {
+	mu      sync.Mutex
+	entries map[string]rblCacheEntry
+	group   singleflight.Group
+	slots   chan struct{}
+	now     func() time.Time
+}
+
+var defaultRBLCache = newRBLCache()
+
+func newRBLCache() *rblCache {
+	return &rblCache{
+		entries: map[string]rblCacheEntry{},
+		slots:   make(chan struct{}, rblMaxConcurrentLookups),
+		now:     time.Now,
+	}
+}
+
+var errRBLLookupsExhausted = errors.New("too many concurrent RBL lookups")
+
+func (c *rblCache) lookup(name string, timeout time.Duration, resolve func(context.Context, string) (rblResult, error)) (rblResult, error) {
+	if res, ok := c.get(name); ok {
+		return res, nil
+	}
+
+	v, err, _ := c.group.Do(name, func() (interface{}, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+
+		select {
+		case c.slots <- struct{}{}:
+		case <-ctx.Done():
+			return rblResult{}, errRBLLookupsExhausted
+		}
+		defer func() { <-c.slots }()
+
+		res, err := resolve(ctx, name)
+		if err != nil {
+			// Transient failures such as timeouts are not cached.
+			return rblResult{}, err
+		}
+		c.set(name, res)
+		return res, nil
+	})
+	if err != nil {
+		return rblResult{}, err
+	}
+	return v.(rblResult), nil
+}
+
+func (c *rblCache) get(name string) (rblResult, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[name]
+	if !ok {
+		return rblResult{}, false
+	}
+	if c.now().After(e.expiresAt) {
+		delete(c.entries, name)
+		return rblResult{}, false
+	}
+	return e.rblResult, true
+}
+
+func (c *rblCache) set(name string, res rblResult) {
+	ttl := rblNegativeTTL
+	if res.listed {
+		ttl = rblPositiveTTL
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	if len(c.entries) >= rblMaxCacheEntries {
+		for k, e := range c.entries {
+			if now.After(e.expiresAt) {
+				delete(c.entries, k)
+			}
+		}
+		if len(c.entries) >= rblMaxCacheEntries {
+			// Still full of live entries, drop an arbitrary one to make room.
+			for k := range c.entries {
+				delete(c.entries, k)
+				break
+			}
 		}
-		return res
-	case <-time.After(timeout):
-		return false
 	}
+	c.entries[name] = rblCacheEntry{rblResult: res, expiresAt: now.Add(ttl)}
 }
 
 func init() {
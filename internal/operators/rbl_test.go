@@ -7,7 +7,13 @@
 package operators
 
 import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/foxcpp/go-mockdns"
 
@@ -22,68 +28,239 @@ func (l *testLogger) Printf(format string, v ...interface{}) {
 	l.t.Logf(format, v...)
 }
 
-func TestRbl(t *testing.T) {
-	opts := plugintypes.OperatorOptions{
-		Arguments: "xbl.spamhaus.org",
-	}
+func newTestRBL(t *testing.T, opts plugintypes.OperatorOptions, zones map[string]mockdns.Zone) *rbl {
+	t.Helper()
+
 	op, err := newRBL(opts)
 	if err != nil {
-		t.Fatal("Cannot init rbl operator")
+		t.Fatalf("Cannot init rbl operator: %v", err)
+	}
+
+	srv, err := mockdns.NewServerWithLogger(zones, &testLogger{t}, false)
+	if err != nil {
+		t.Fatalf("Cannot start mockdns server: %v", err)
 	}
+	t.Cleanup(func() { srv.Close() })
 
-	logger := &testLogger{t}
+	r := op.(*rbl)
+	r.resolver = &net.Resolver{}
+	r.cache = newRBLCache()
+	srv.PatchNet(r.resolver)
+	return r
+}
 
-	srv, err := mockdns.NewServerWithLogger(map[string]mockdns.Zone{
-		"valid_no_txt.xbl.spamhaus.org.": {
-			A: []string{"1.2.3.4"},
+func TestRbl(t *testing.T) {
+	op := newTestRBL(t, plugintypes.OperatorOptions{
+		Arguments: "xbl.spamhaus.org",
+	}, map[string]mockdns.Zone{
+		"4.3.2.1.xbl.spamhaus.org.": {
+			A: []string{"127.0.0.4"},
 		},
-		"valid_txt.xbl.spamhaus.org.": {
-			A:   []string{"1.2.3.5"},
+		"5.3.2.1.xbl.spamhaus.org.": {
+			A:   []string{"127.0.0.4"},
 			TXT: []string{"not blocked"},
 		},
-		"blocked.xbl.spamhaus.org.": {
-			A:   []string{"1.2.3.6"},
+		"6.3.2.1.xbl.spamhaus.org.": {
+			A:   []string{"127.0.0.4"},
 			TXT: []string{"blocked"},
 		},
-	}, logger, false)
-	if err != nil {
-		t.Fatalf("Cannot start mockdns server: %v", err)
-	}
-	defer srv.Close()
-
-	srv.PatchNet(op.(*rbl).resolver)
-	defer mockdns.UnpatchNet(op.(*rbl).resolver)
+		"1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.xbl.spamhaus.org.": {
+			A:   []string{"127.0.0.4"},
+			TXT: []string{"blocked v6"},
+		},
+	})
 
-	t.Run("Valid hostname with no TXT record", func(t *testing.T) {
-		if op.Evaluate(nil, "valid_no_txt") {
-			t.Errorf("Unexpected result for valid hostname with no TXT record")
+	t.Run("Listed address with no TXT record", func(t *testing.T) {
+		tx := corazawaf.NewWAF().NewTransaction()
+		if !op.Evaluate(tx, "1.2.3.4") {
+			t.Errorf("Unexpected result for listed address with no TXT record")
 		}
 	})
 
-	t.Run("Valid hostname with TXT record", func(t *testing.T) {
+	t.Run("Listed address with TXT record", func(t *testing.T) {
 		tx := corazawaf.NewWAF().NewTransaction()
-		if !op.Evaluate(tx, "valid_txt") {
-			t.Errorf("Unexpected result for valid hostname")
+		if !op.Evaluate(tx, "1.2.3.5") {
+			t.Errorf("Unexpected result for listed address")
 		}
 		if want, have := "not blocked", tx.Variables().TX().Get("httpbl_msg")[0]; want != have {
-			t.Errorf("Unexpected result for valid hostname: want %q, have %q", want, have)
+			t.Errorf("Unexpected result for listed address: want %q, have %q", want, have)
 		}
 	})
 
-	t.Run("Invalid hostname", func(t *testing.T) {
-		if op.Evaluate(nil, "invalid") {
-			t.Errorf("Unexpected result for invalid hostname")
+	t.Run("Not listed address", func(t *testing.T) {
+		tx := corazawaf.NewWAF().NewTransaction()
+		if op.Evaluate(tx, "10.0.0.1") {
+			t.Errorf("Unexpected result for not listed address")
 		}
 	})
 
-	t.Run("Blocked hostname", func(t *testing.T) {
+	t.Run("Invalid address", func(t *testing.T) {
 		tx := corazawaf.NewWAF().NewTransaction()
-		if !op.Evaluate(tx, "blocked") {
-			t.Fatal("Unexpected result for blocked hostname")
+		if op.Evaluate(tx, "blocked") {
+			t.Errorf("Unexpected result for invalid address")
+		}
+	})
+
+	t.Run("Blocked address", func(t *testing.T) {
+		tx := corazawaf.NewWAF().NewTransaction()
+		if !op.Evaluate(tx, "1.2.3.6") {
+			t.Fatal("Unexpected result for blocked address")
 		}
-		t.Log(tx.Variables().TX().Get("httpbl_msg"))
 		if want, have := "blocked", tx.Variables().TX().Get("httpbl_msg")[0]; want != have {
-			t.Errorf("Unexpected result for valid hostname: want %q, have %q", want, have)
+			t.Errorf("Unexpected result for blocked address: want %q, have %q", want, have)
+		}
+	})
+
+	t.Run("Blocked IPv6 address", func(t *testing.T) {
+		tx := corazawaf.NewWAF().NewTransaction()
+		if !op.Evaluate(tx, "2001:db8::1") {
+			t.Fatal("Unexpected result for blocked IPv6 address")
+		}
+		if want, have := "blocked v6", tx.Variables().TX().Get("httpbl_msg")[0]; want != have {
+			t.Errorf("Unexpected result for blocked IPv6 address: want %q, have %q", want, have)
 		}
 	})
 }
+
+func TestRblHTTPBL(t *testing.T) {
+	if _, err := newRBL(plugintypes.OperatorOptions{Arguments: "dnsbl.httpbl.org"}); err == nil {
+		t.Fatal("expected error for missing http:BL key")
+	}
+
+	op := newTestRBL(t, plugintypes.OperatorOptions{
+		Arguments: "dnsbl.httpbl.org",
+		HTTPBLKey: "abcdefghijkl",
+	}, map[string]mockdns.Zone{
+		"abcdefghijkl.4.3.2.1.dnsbl.httpbl.org.": {
+			A: []string{"127.3.5.1"},
+		},
+		"abcdefghijkl.5.3.2.1.dnsbl.httpbl.org.": {
+			A: []string{"127.1.1.0"},
+		},
+		"abcdefghijkl.6.3.2.1.dnsbl.httpbl.org.": {
+			A: []string{"128.0.0.1"},
+		},
+	})
+
+	tests := []struct {
+		addr   string
+		listed bool
+		msg    string
+	}{
+		{"1.2.3.4", true, "Suspicious IP: 3 days since last activity, threat score 5"},
+		{"1.2.3.5", true, "Search Engine: 1 days since last activity, threat score 1"},
+		{"1.2.3.6", false, ""},
+		{"1.2.3.7", false, ""},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.addr, func(t *testing.T) {
+			tx := corazawaf.NewWAF().NewTransaction()
+			if want, have := tc.listed, op.Evaluate(tx, tc.addr); want != have {
+				t.Fatalf("unexpected result: want %t, have %t", want, have)
+			}
+			if !tc.listed {
+				return
+			}
+			if want, have := tc.msg, tx.Variables().TX().Get("httpbl_msg")[0]; want != have {
+				t.Errorf("unexpected message: want %q, have %q", want, have)
+			}
+		})
+	}
+}
+
+func TestRblQueryName(t *testing.T) {
+	op := &rbl{service: "zen.spamhaus.org"}
+	tests := map[string]string{
+		"127.0.0.2":          "2.0.0.127.zen.spamhaus.org",
+		" 10.1.2.3 ":         "3.2.1.10.zen.spamhaus.org",
+		"::ffff:1.2.3.4":     "4.3.2.1.zen.spamhaus.org",
+		"2001:db8::567:89ab": "b.a.9.8.7.6.5.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.zen.spamhaus.org",
+	}
+	for in, want := range tests {
+		have, ok := op.queryName(in)
+		if !ok {
+			t.Errorf("unexpected invalid address %q", in)
+			continue
+		}
+		if want != have {
+			t.Errorf("unexpected query name for %q: want %q, have %q", in, want, have)
+		}
+	}
+
+	for _, in := range []string{"", "1.2.3", "localhost", "1.2.3.4; drop"} {
+		if _, ok := op.queryName(in); ok {
+			t.Errorf("expected invalid address %q", in)
+		}
+	}
+}
+
+func TestRblCache(t *testing.T) {
+	c := newRBLCache()
+	now := time.Now()
+	c.now = func() time.Time { return now }
+
+	var calls int32
+	resolve := func(_ context.Context, name string) (rblResult, error) {
+		atomic.AddInt32(&calls, 1)
+		switch {
+		case strings.HasPrefix(name, "listed"):
+			return rblResult{listed: true, msg: "listed"}, nil
+		case strings.HasPrefix(name, "error"):
+			return rblResult{}, errors.New("timeout")
+		default:
+			return rblResult{}, nil
+		}
+	}
+
+	for i := 0; i < 3; i++ {
+		if res, err := c.lookup("listed.example", time.Second, resolve); err != nil || !res.listed {
+			t.Fatalf("unexpected result: %v, %v", res, err)
+		}
+		if res, err := c.lookup("clean.example", time.Second, resolve); err != nil || res.listed {
+			t.Fatalf("unexpected result: %v, %v", res, err)
+		}
+	}
+	if want, have := int32(2), atomic.LoadInt32(&calls); want != have {
+		t.Fatalf("unexpected number of lookups: want %d, have %d", want, have)
+	}
+
+	// Negative entries expire before positive ones
+	now = now.Add(rblNegativeTTL + time.Second)
+	_, _ = c.lookup("listed.example", time.Second, resolve)
+	_, _ = c.lookup("clean.example", time.Second, resolve)
+	if want, have := int32(3), atomic.LoadInt32(&calls); want != have {
+		t.Fatalf("unexpected number of lookups: want %d, have %d", want, have)
+	}
+
+	now = now.Add(rblPositiveTTL)
+	_, _ = c.lookup("listed.example", time.Second, resolve)
+	if want, have := int32(4), atomic.LoadInt32(&calls); want != have {
+		t.Fatalf("unexpected number of lookups: want %d, have %d", want, have)
+	}
+
+	// Errors are not cached
+	for i := 0; i < 2; i++ {
+		if _, err := c.lookup("error.example", time.Second, resolve); err == nil {
+			t.Fatal("expected error")
+		}
+	}
+	if want, have := int32(6), atomic.LoadInt32(&calls); want != have {
+		t.Fatalf("unexpected number of lookups: want %d, have %d", want, have)
+	}
+}
+
+func TestRblConcurrencyLimit(t *testing.T) {
+	c := newRBLCache()
+	for i := 0; i < rblMaxConcurrentLookups; i++ {
+		c.slots <- struct{}{}
+	}
+
+	_, err := c.lookup("blocked.example", 10*time.Millisecond, func(context.Context, string) (rblResult, error) {
+		t.Fatal("unexpected lookup")
+		return rblResult{}, nil
+	})
+	if !errors.Is(err, errRBLLookupsExhausted) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
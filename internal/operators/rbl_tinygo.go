@@ -16,4 +16,5 @@ func newRBL(plugintypes.OperatorOptions) (plugintypes.Operator, error) {
 
 func init() {
 	Register("rbl", newRBL)
+	stubs["rbl"] = struct{}{}
 }
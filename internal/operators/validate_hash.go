@@ -0,0 +1,53 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !coraza.disabled_operators.validateHash
+
+package operators
+
+import (
+	"regexp"
+
+	"github.com/corazawaf/coraza/v3/experimental/plugins/plugintypes"
+	"github.com/corazawaf/coraza/v3/internal/memoize"
+)
+
+// hashValidator is implemented by transactions supporting the hash engine
+type hashValidator interface {
+	ValidateHash(uri string) bool
+}
+
+type validateHash struct {
+	re *regexp.Regexp
+}
+
+var _ plugintypes.Operator = (*validateHash)(nil)
+
+func newValidateHash(options plugintypes.OperatorOptions) (plugintypes.Operator, error) {
+	data := options.Arguments
+
+	re, err := memoize.Do(data, func() (interface{}, error) { return regexp.Compile(data) })
+	if err != nil {
+		return nil, err
+	}
+	return &validateHash{re: re.(*regexp.Regexp)}, nil
+}
+
+// Evaluate matches when the value, usually REQUEST_URI, matches the regular expression
+// and doesn't carry a valid signature. Nothing is enforced when the hash engine or
+// the hash enforcement are disabled for the transaction.
+func (o *validateHash) Evaluate(tx plugintypes.TransactionState, value string) bool {
+	if !o.re.MatchString(value) {
+		return false
+	}
+
+	v, ok := tx.(hashValidator)
+	if !ok {
+		return false
+	}
+	return !v.ValidateHash(value)
+}
+
+func init() {
+	Register("validateHash", newValidateHash)
+}
@@ -0,0 +1,87 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package operators
+
+import (
+	"html"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/corazawaf/coraza/v3/experimental/plugins/plugintypes"
+	"github.com/corazawaf/coraza/v3/internal/corazawaf"
+)
+
+func TestValidateHash(t *testing.T) {
+	if _, err := newValidateHash(plugintypes.OperatorOptions{Arguments: "("}); err == nil {
+		t.Fatal("expected error for invalid regex")
+	}
+
+	op, err := newValidateHash(plugintypes.OperatorOptions{Arguments: `\.php`})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	waf := corazawaf.NewWAF()
+	waf.HashEngine = true
+	waf.HashKey = []byte("key")
+	waf.HashMethods = []corazawaf.HashMethod{
+		{Target: corazawaf.HashHref, Match: func(string) bool { return true }},
+	}
+	waf.ResponseBodyAccess = true
+	waf.ResponseBodyMimeTypes = []string{"text/html"}
+
+	// Signed links are obtained from a response body
+	stx := waf.NewTransaction()
+	defer stx.Close()
+	stx.ProcessURI("/", "GET", "HTTP/1.1")
+	stx.ProcessRequestHeaders()
+	if _, err := stx.ProcessRequestBody(); err != nil {
+		t.Fatal(err)
+	}
+	stx.AddResponseHeader("Content-Type", "text/html")
+	stx.ProcessResponseHeaders(200, "HTTP/1.1")
+	if _, _, err := stx.WriteResponseBody([]byte(`<a href="/index.php?id=1">x</a>`)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stx.ProcessResponseBody(); err != nil {
+		t.Fatal(err)
+	}
+	r, err := stx.ResponseBodyReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	link := html.UnescapeString(strings.TrimSuffix(strings.TrimPrefix(string(signed), `<a href="`), `">x</a>`))
+
+	tx := waf.NewTransaction()
+	defer tx.Close()
+
+	tests := []struct {
+		value string
+		match bool
+	}{
+		{"/index.html", false},
+		{"/index.php?id=1", true},
+		{"/index.php?id=2&hmac=abc", true},
+		{link, false},
+	}
+	for _, tc := range tests {
+		if want, have := tc.match, op.Evaluate(tx, tc.value); want != have {
+			t.Errorf("unexpected result for %q: want %t, have %t", tc.value, want, have)
+		}
+	}
+
+	tx.HashEnforcement = false
+	if op.Evaluate(tx, "/index.php?id=1") {
+		t.Error("unexpected match with the hash enforcement disabled")
+	}
+
+	if op.Evaluate(nil, "/index.php") {
+		t.Error("unexpected match without transaction")
+	}
+}
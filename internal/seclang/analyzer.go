@@ -0,0 +1,359 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package seclang
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp/syntax"
+	"sort"
+	"strings"
+
+	"github.com/corazawaf/coraza/v3/internal/corazawaf"
+	utils "github.com/corazawaf/coraza/v3/internal/strings"
+	"github.com/corazawaf/coraza/v3/types"
+)
+
+// Severity is the severity of a finding
+type Severity int
+
+const (
+	// SeverityWarning is an issue which doesn't prevent the configuration from loading
+	SeverityWarning Severity = iota
+	// SeverityError is an issue which fails the configuration
+	SeverityError
+)
+
+func (s Severity) String() string {
+	if s == SeverityError {
+		return "error"
+	}
+	return "warning"
+}
+
+// The checks of the analyzer, see Finding.Check
+const (
+	// CheckDirective reports the directives failing to compile
+	CheckDirective = "directive"
+	// CheckDuplicateID reports the rules using the ID of a previous rule
+	CheckDuplicateID = "duplicate-id"
+	// CheckChain reports the chains missing their terminating rule
+	CheckChain = "chain"
+	// CheckSkipAfter reports the skipAfter actions without a marker after the rule
+	CheckSkipAfter = "skip-after"
+	// CheckPhase reports the variables populated after the phase of their rule
+	CheckPhase = "phase"
+	// CheckRegex reports the regexes failing to compile
+	CheckRegex = "regex"
+	// CheckDeprecated reports the deprecated directives
+	CheckDeprecated = "deprecated"
+	// CheckUnsupported reports the directives with no effect in Coraza
+	CheckUnsupported = "unsupported"
+)
+
+// Finding is an issue of a configuration reported by an Analyzer
+type Finding struct {
+	// File and Line are the position of the directive, its first line if it spans multiple
+	// lines. Line is 0 if the issue concerns the whole file.
+	File string
+	Line int
+	// Severity is the severity of the issue
+	Severity Severity
+	// Check is the check reporting the issue, e.g. CheckDuplicateID
+	Check string
+	// Message describes the issue
+	Message string
+}
+
+// String formats the finding as FILE:LINE: SEVERITY: MESSAGE (CHECK)
+func (f Finding) String() string {
+	pos := f.File
+	if f.Line > 0 {
+		pos = fmt.Sprintf("%s:%d", f.File, f.Line)
+	}
+	return fmt.Sprintf("%s: %s: %s (%s)", pos, f.Severity, f.Message, f.Check)
+}
+
+// deprecatedDirectives are the directives deprecated by ModSecurity, with the reason
+var deprecatedDirectives = map[string]string{
+	"secgsblookupdb": "the Google Safe Browsing API v2 it relies on has been shut down",
+}
+
+// unsupportedDirectives are the directives accepted for compatibility with ModSecurity
+// which have no effect in Coraza, with the reason
+var unsupportedDirectives = map[string]string{
+	"secconnengine":              "connection filtering is not implemented",
+	"secconnreadstatelimit":      "connection filtering is not implemented",
+	"secconnwritestatelimit":     "connection filtering is not implemented",
+	"seccollectiontimeout":       "the timeout of the collections is not configurable",
+	"secpcrematchlimit":          "regexes are evaluated by RE2 in linear time",
+	"secpcrematchlimitrecursion": "regexes are evaluated by RE2 in linear time",
+	"secrequestbodynofileslimit": "the limit is not enforced",
+	"sectmpdir":                  "the directive is not supported",
+}
+
+// skippedDirectives are the directives not evaluated by the analyzer as they have side
+// effects outside of the configuration, e.g. creating files
+var skippedDirectives = map[string]struct{}{
+	"secdebuglog": {},
+}
+
+// Analyzer parses a configuration without running it and reports its issues. Unlike the
+// Parser, it doesn't stop at the first directive failing to compile, so that all the
+// issues of a configuration are reported at once:
+//   - the directives failing to compile, the regexes in particular
+//   - the rules whose ID is already used in the same configuration context
+//   - the chains missing their terminating rule, including the ones continued by a rule
+//     with an ID
+//   - the skipAfter actions without a marker after the rule, which skip the rest of the phase
+//   - the variables populated after the phase of their rule, which are always empty
+//   - the deprecated directives and the ones with no effect in Coraza
+type Analyzer struct {
+	parser *Parser
+	linter *linter
+}
+
+// NewAnalyzer creates an analyzer, the configuration is loaded into a new WAF
+func NewAnalyzer() *Analyzer {
+	p := NewParser(corazawaf.NewWAF())
+	l := &linter{
+		ids:    map[*corazawaf.Scope]map[int]*corazawaf.Rule{},
+		starts: map[lintPosition]int{},
+	}
+	p.options.linter = l
+	return &Analyzer{parser: p, linter: l}
+}
+
+// SetRoot sets the root of the filesystem for resolving paths, see Parser.SetRoot
+func (a *Analyzer) SetRoot(root fs.FS) {
+	a.parser.SetRoot(root)
+}
+
+// FromFile analyzes the directives of the file, and of the files it includes
+func (a *Analyzer) FromFile(path string) {
+	if err := a.parser.FromFile(path); err != nil {
+		a.linter.add(path, 0, SeverityError, CheckDirective, err.Error())
+	}
+}
+
+// FromString analyzes the directives, they are reported at the position "_inline_"
+func (a *Analyzer) FromString(data string) {
+	if err := a.parser.FromString(data); err != nil {
+		a.linter.add("_inline_", 0, SeverityError, CheckDirective, err.Error())
+	}
+}
+
+// Findings returns the issues found in the configuration analyzed, sorted by position
+func (a *Analyzer) Findings() []Finding {
+	l := *a.linter
+	l.findings = append([]Finding(nil), a.linter.findings...)
+	waf := a.parser.options.WAF
+	l.checkRules(waf.Rules.GetRules())
+	for _, s := range waf.Scopes {
+		l.checkRules(s.Rules().GetRules())
+	}
+	l.checkSkips()
+
+	sort.SliceStable(l.findings, func(i, j int) bool {
+		fi, fj := l.findings[i], l.findings[j]
+		if fi.File != fj.File {
+			return fi.File < fj.File
+		}
+		return fi.Line < fj.Line
+	})
+	return l.findings
+}
+
+// linter collects the findings while the parser evaluates the directives
+type linter struct {
+	findings []Finding
+	// reported is whether the rule of the current directive has been reported by the checks
+	// of the rules, the error of its directive is not reported twice
+	reported bool
+	// starts maps the last line of the directives to their first one, the rules only know
+	// their last line
+	starts map[lintPosition]int
+	// seq numbers the directives to order the markers and the skipAfter actions
+	seq     int
+	ids     map[*corazawaf.Scope]map[int]*corazawaf.Rule
+	markers []lintMarker
+	skips   []lintMarker
+}
+
+// lintPosition is the position of the last line of a directive
+type lintPosition struct {
+	file string
+	line int
+}
+
+// lintMarker is a marker, or the target of a skipAfter action
+type lintMarker struct {
+	name  string
+	file  string
+	line  int
+	seq   int
+	scope *corazawaf.Scope
+}
+
+func (l *linter) add(file string, line int, severity Severity, check string, msg string) {
+	l.findings = append(l.findings, Finding{
+		File:     file,
+		Line:     line,
+		Severity: severity,
+		Check:    check,
+		Message:  msg,
+	})
+}
+
+// directive is called before a directive spanning the lines from line to lastLine is
+// evaluated, it returns whether the directive is evaluated
+func (l *linter) directive(directive, opts string, scope *corazawaf.Scope, file string, line, lastLine int) bool {
+	l.seq++
+	l.reported = false
+	if lastLine != line {
+		l.starts[lintPosition{file, lastLine}] = line
+	}
+	if reason, ok := deprecatedDirectives[directive]; ok {
+		l.add(file, line, SeverityWarning, CheckDeprecated, fmt.Sprintf("directive %q is deprecated, %s", directive, reason))
+	}
+	if reason, ok := unsupportedDirectives[directive]; ok {
+		l.add(file, line, SeverityWarning, CheckUnsupported, fmt.Sprintf("directive %q has no effect, %s", directive, reason))
+	}
+
+	switch directive {
+	case "secmarker":
+		l.markers = append(l.markers, lintMarker{name: opts, file: file, line: line, seq: l.seq, scope: scope})
+	case "secrule", "secaction", "secrulescript":
+		if actions, err := parseActions(ruleActions(directive, opts)); err == nil {
+			for _, a := range actions {
+				if a.Key == "skipafter" {
+					l.skips = append(l.skips, lintMarker{name: a.Value, file: file, line: line, seq: l.seq, scope: scope})
+				}
+			}
+		}
+	}
+
+	_, skipped := skippedDirectives[directive]
+	return !skipped
+}
+
+// ruleActions returns the actions of the directives creating rules
+func ruleActions(directive, opts string) string {
+	switch directive {
+	case "secrule":
+		_, _, actions, _ := parseActionOperator(opts)
+		return actions
+	case "secrulescript":
+		_, actions, _ := cutSelector(opts)
+		return actions
+	}
+	return utils.MaybeRemoveQuotes(opts)
+}
+
+// rule is called before a rule is added to the scope
+func (l *linter) rule(r *corazawaf.Rule, scope *corazawaf.Scope) {
+	if r.ID_ == 0 {
+		return
+	}
+	ids := l.ids[scope]
+	if ids == nil {
+		ids = map[int]*corazawaf.Rule{}
+		l.ids[scope] = ids
+	}
+	if prev, ok := ids[r.ID_]; ok {
+		l.add(r.File_, l.ruleLine(r), SeverityError, CheckDuplicateID,
+			fmt.Sprintf("rule ID %d is already used at %s:%d", r.ID_, prev.File_, l.ruleLine(prev)))
+		l.reported = true
+		return
+	}
+	ids[r.ID_] = r
+}
+
+// ruleLine returns the first line of the directive of the rule
+func (l *linter) ruleLine(r *corazawaf.Rule) int {
+	if line, ok := l.starts[lintPosition{r.File_, r.Line_}]; ok {
+		return line
+	}
+	return r.Line_
+}
+
+// recover records the error of a directive, the parser continues with the next one
+func (l *linter) recover(pe *types.ParseError) {
+	var rxErr *syntax.Error
+	switch {
+	case errors.As(pe.Err, &rxErr):
+		l.add(pe.File, pe.Line, SeverityError, CheckRegex, fmt.Sprintf("invalid regex %q: %s", rxErr.Expr, rxErr.Code))
+	case !l.reported:
+		l.add(pe.File, pe.Line, SeverityError, CheckDirective, pe.Err.Error())
+	}
+	l.reported = false
+}
+
+// checkRules checks the chains and the phases of the rules of a configuration context
+func (l *linter) checkRules(rules []corazawaf.Rule) {
+	for i := range rules {
+		r := &rules[i]
+		last := r
+		for c := r.Chain; c != nil; c = c.Chain {
+			if c.ID_ != 0 {
+				l.add(c.File_, l.ruleLine(c), SeverityWarning, CheckChain,
+					fmt.Sprintf("rule %d is chained to rule %d, the chain may be missing its terminating rule", c.ID_, r.ID_))
+			}
+			last = c
+		}
+		if last.HasChain && last.Chain == nil {
+			l.add(last.File_, l.ruleLine(last), SeverityError, CheckChain,
+				fmt.Sprintf("the chain of rule %d is missing its terminating rule", r.ID_))
+		}
+
+		if late := r.LateVariables(); len(late) > 0 {
+			names := make([]string, 0, len(late))
+			for _, v := range late {
+				names = append(names, v.Name())
+			}
+			l.add(r.File_, l.ruleLine(r), SeverityWarning, CheckPhase,
+				fmt.Sprintf("rule %d in phase %d uses %s, populated in a later phase", r.ID_, r.Phase_, strings.Join(names, ", ")))
+		}
+	}
+}
+
+// checkSkips checks that every skipAfter action has a marker after it, in the same scope
+// or in a scope inheriting its rules
+func (l *linter) checkSkips() {
+	for _, s := range l.skips {
+		defined, reachable := false, false
+		for _, m := range l.markers {
+			if m.name != s.name {
+				continue
+			}
+			defined = true
+			if m.seq > s.seq && inherits(m.scope, s.scope) {
+				reachable = true
+				break
+			}
+		}
+		switch {
+		case !defined:
+			l.add(s.file, s.line, SeverityWarning, CheckSkipAfter,
+				fmt.Sprintf("skipAfter marker %q is not defined, the rest of the phase is skipped", s.name))
+		case !reachable:
+			l.add(s.file, s.line, SeverityWarning, CheckSkipAfter,
+				fmt.Sprintf("skipAfter marker %q is not after the rule, the rest of the phase is skipped", s.name))
+		}
+	}
+}
+
+// inherits returns whether the rules of scope follow the ones of parent, nil being the WAF
+func inherits(scope, parent *corazawaf.Scope) bool {
+	if parent == nil {
+		return true
+	}
+	for s := scope; s != nil; s = s.Parent() {
+		if s == parent {
+			return true
+		}
+	}
+	return false
+}
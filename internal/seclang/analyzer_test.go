@@ -0,0 +1,108 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package seclang
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/corazawaf/coraza/v3/internal/corazawaf"
+	"github.com/corazawaf/coraza/v3/types"
+	"github.com/corazawaf/coraza/v3/types/variables"
+)
+
+// checksPhases returns whether the phases of the variables are checked, they aren't with
+// multiphase evaluation, which evaluates the variables in their own phase
+func checksPhases(t *testing.T) bool {
+	t.Helper()
+	r := corazawaf.NewRule()
+	r.Phase_ = types.PhaseRequestHeaders
+	if err := r.AddVariable(variables.RequestBody, "", false); err != nil {
+		t.Fatal(err)
+	}
+	return len(r.LateVariables()) > 0
+}
+
+func TestAnalyzer(t *testing.T) {
+	a := NewAnalyzer()
+	a.FromFile("./testdata/lint/main.conf")
+
+	want := []string{
+		`testdata/lint/main.conf:3: warning: directive "secpcrematchlimit" has no effect, regexes are evaluated by RE2 in linear time (unsupported)`,
+		`testdata/lint/main.conf:4: warning: directive "secgsblookupdb" is deprecated, the Google Safe Browsing API v2 it relies on has been shut down (deprecated)`,
+		`testdata/lint/main.conf:7: error: invalid regex "(?sm)(unclosed": missing closing ) (regex)`,
+		`testdata/lint/main.conf:8: error: rule ID 1 is already used at testdata/lint/main.conf:6 (duplicate-id)`,
+		`testdata/lint/main.conf:9: error: failed to compile the directive "secrule": operator unknownOperator not found (directive)`,
+		`testdata/lint/main.conf:13: warning: rule 4 in phase 1 uses REQUEST_BODY, populated in a later phase (phase)`,
+		`testdata/lint/main.conf:15: warning: rule 5 in phase 2 uses RESPONSE_BODY, populated in a later phase (phase)`,
+		`testdata/lint/main.conf:17: warning: rule 6 is chained to rule 5, the chain may be missing its terminating rule (chain)`,
+		`testdata/lint/main.conf:18: warning: skipAfter marker "BEFORE" is not after the rule, the rest of the phase is skipped (skip-after)`,
+		`testdata/lint/main.conf:19: warning: skipAfter marker "UNDEFINED" is not defined, the rest of the phase is skipped (skip-after)`,
+		`testdata/lint/main.conf:22: error: invalid regex "[a-": missing closing ] (regex)`,
+		`testdata/lint/main.conf:23: error: the chain of rule 11 is missing its terminating rule (chain)`,
+		`testdata/lint/rules.conf:3: error: rule ID 100 is already used at testdata/lint/rules.conf:2 (duplicate-id)`,
+	}
+	var have []string
+	for _, f := range a.Findings() {
+		have = append(have, f.String())
+	}
+	if !checksPhases(t) {
+		want = slices.DeleteFunc(want, func(f string) bool { return strings.HasSuffix(f, "(phase)") })
+	}
+	if strings.Join(have, "\n") != strings.Join(want, "\n") {
+		t.Errorf("unexpected findings\nwant:\n%s\nhave:\n%s", strings.Join(want, "\n"), strings.Join(have, "\n"))
+	}
+}
+
+func TestAnalyzerScopes(t *testing.T) {
+	a := NewAnalyzer()
+	a.FromString(`
+SecRule REQUEST_URI "@rx /" "id:1,phase:1,pass,skipAfter:END_HOST"
+<VirtualHost example.com>
+    SecRule REQUEST_URI "@rx /" "id:1,phase:1,deny"
+    SecRule REQUEST_URI "@rx /" "id:2,phase:1,pass,skipAfter:END_GLOBAL"
+    SecRule REQUEST_URI "@rx /" "id:3,phase:1,pass,skipAfter:END_LOCATION"
+    <Location /admin>
+        SecRule REQUEST_URI "@rx /" "id:2,phase:1,deny"
+        SecMarker END_LOCATION
+    </Location>
+    SecMarker END_HOST
+</VirtualHost>
+SecMarker END_GLOBAL
+SecDebugLog /nonexistent/debug.log
+SecRule ARGS "@rx x" "id:3,phase:1,deny"
+SecRule ARGS "@rx x" "id:3,phase:1,deny"
+`)
+	want := []string{
+		`_inline_:5: warning: skipAfter marker "END_GLOBAL" is not after the rule, the rest of the phase is skipped (skip-after)`,
+		`_inline_:16: error: rule ID 3 is already used at _inline_:15 (duplicate-id)`,
+	}
+	var have []string
+	for _, f := range a.Findings() {
+		have = append(have, f.String())
+	}
+	if strings.Join(have, "\n") != strings.Join(want, "\n") {
+		t.Errorf("unexpected findings\nwant:\n%s\nhave:\n%s", strings.Join(want, "\n"), strings.Join(have, "\n"))
+	}
+}
+
+func TestAnalyzerFileErrors(t *testing.T) {
+	a := NewAnalyzer()
+	a.FromFile("./testdata/lint/unknown.conf")
+	a.FromString("Include ./testdata/lint/unknown.conf\nSecRule ARGS \"@rx x\" \"id:1,phase:2,deny,chain\"")
+	findings := a.Findings()
+	if len(findings) != 3 {
+		t.Fatalf("unexpected findings %v", findings)
+	}
+	if f := findings[0]; f.File != "./testdata/lint/unknown.conf" || f.Line != 0 || f.Severity != SeverityError || f.Check != CheckDirective {
+		t.Errorf("unexpected finding %v", f)
+	}
+	if f := findings[1]; f.File != "_inline_" || f.Line != 1 || f.Check != CheckDirective {
+		t.Errorf("unexpected finding %v", f)
+	}
+	if f := findings[2]; f.File != "_inline_" || f.Line != 2 || f.Check != CheckChain {
+		t.Errorf("unexpected finding %v", f)
+	}
+}
@@ -6,19 +6,25 @@
 package seclang
 
 import (
+	"crypto/rand"
 	"errors"
 	"fmt"
 	"io/fs"
+	"path"
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/corazawaf/coraza/v3/debuglog"
 	"github.com/corazawaf/coraza/v3/internal/auditlog"
+	"github.com/corazawaf/coraza/v3/internal/cookies"
 	"github.com/corazawaf/coraza/v3/internal/corazawaf"
 	"github.com/corazawaf/coraza/v3/internal/environment"
+	"github.com/corazawaf/coraza/v3/internal/io"
 	"github.com/corazawaf/coraza/v3/internal/memoize"
 	utils "github.com/corazawaf/coraza/v3/internal/strings"
+	"github.com/corazawaf/coraza/v3/internal/transformations"
 	"github.com/corazawaf/coraza/v3/types"
 )
 
@@ -32,13 +38,41 @@ type DirectiveOptions struct {
 	Path     []string
 	Datasets map[string][]string
 
+	// Scope is the configuration scope the directive applies to, nil outside of
+	// <VirtualHost> and <Location> blocks.
+	Scope *corazawaf.Scope
+
 	// Parser is configuration of the parser, populated by multiple directives and consumed by
 	// directives that parse.
 	Parser ParserConfig
+
+	// linter collects the findings of an Analyzer, nil when parsing
+	linter *linter
 }
 
 type directive = func(options *DirectiveOptions) error
 
+// addRule adds the rule to the current configuration context
+func (options *DirectiveOptions) addRule(rule *corazawaf.Rule) error {
+	if options.linter != nil && rule != nil {
+		options.linter.rule(rule, options.Scope)
+	}
+	if options.Scope != nil {
+		return options.Scope.AddRule(rule)
+	}
+	return options.WAF.Rules.Add(rule)
+}
+
+// editRules applies the edit to the rules of the current configuration context, within
+// a scope it is applied once the rules inherited by the scope are known.
+func (options *DirectiveOptions) editRules(edit func(e *corazawaf.RuleEditor) error) error {
+	if options.Scope != nil {
+		options.Scope.EditRules(edit)
+		return nil
+	}
+	return options.WAF.Rules.Edit(edit)
+}
+
 // Description: Include and evaluate a file or file pattern.
 // Syntax: Include [PATH_TO_CONF_FILES]
 // ---
@@ -59,6 +93,31 @@ func directiveInclude(_ *DirectiveOptions) error {
 
 var _ directive = directiveInclude
 
+// Description: Define a variable expanded in the following directives.
+// Syntax: Define NAME [VALUE]
+// ---
+// Define sets the variable NAME to VALUE, "" if it's missing. The references to the
+// variable, `${NAME}`, are replaced by its value in the following directives, including
+// the paths of Include and the actions of the rules. The references to the variables not
+// defined are replaced by the environment variable of the same name if it's set, otherwise
+// they are kept as is. In the variables and the operator of SecRule and in the script of
+// SecRuleScript, which may match `${...}` payloads literally, only the defined variables
+// are replaced. The defined variables also meet the condition of `<IfDefined NAME>` blocks.
+//
+// Example:
+// ```apache
+// Define CRS_DIR /etc/coraza/crs
+// Define BLOCKING_STATUS 403
+//
+// Include ${CRS_DIR}/rules/*.conf
+// SecRule ARGS "@rx attack" "id:1,phase:2,deny,status:${BLOCKING_STATUS}"
+// ```
+func directiveDefine(_ *DirectiveOptions) error {
+	return errors.New("not implemented")
+}
+
+var _ directive = directiveDefine
+
 var errEmptyOptions = errors.New("expected options")
 
 func directiveSecComponentSignature(options *DirectiveOptions) error {
@@ -114,7 +173,7 @@ func directiveSecMarker(options *DirectiveOptions) error {
 	rule.Phase_ = 0
 	rule.Line_ = options.Parser.LastLine
 	rule.File_ = options.Parser.ConfigFile
-	if err := options.WAF.Rules.Add(rule); err != nil {
+	if err := options.addRule(rule); err != nil {
 		return err
 	}
 	options.WAF.Logger.Debug().Msg("Added secmark rule")
@@ -143,11 +202,12 @@ func directiveSecAction(options *DirectiveOptions) error {
 		Raw:          options.Raw,
 		Directive:    "SecAction",
 		Data:         options.Opts,
+		Scope:        options.Scope,
 	})
 	if err != nil {
 		return err
 	}
-	if err := options.WAF.Rules.Add(rule); err != nil {
+	if err := options.addRule(rule); err != nil {
 		return err
 	}
 	options.WAF.Logger.Debug().
@@ -185,6 +245,7 @@ func directiveSecRule(options *DirectiveOptions) error {
 		Directive:    "SecRule",
 		Data:         options.Opts,
 		Datasets:     options.Datasets,
+		Scope:        options.Scope,
 	})
 	if err != nil && !ignoreErrors {
 		return err
@@ -195,7 +256,7 @@ func directiveSecRule(options *DirectiveOptions) error {
 			Msg("Ignoring rule compilation error")
 		return nil
 	}
-	err = options.WAF.Rules.Add(rule)
+	err = options.addRule(rule)
 	if err != nil && !ignoreErrors {
 		return err
 	} else if err != nil && ignoreErrors {
@@ -208,6 +269,69 @@ func directiveSecRule(options *DirectiveOptions) error {
 	return nil
 }
 
+// Description: Creates a rule evaluating an expression script, a sandboxed replacement
+// of the ModSecurity Lua scripts.
+// Syntax: SecRuleScript PATH "ACTIONS"
+// ---
+// The script is loaded from the path, relative to the directory of the configuration file,
+// and the rule matches when its result is true, i.e. not false, 0 or empty. Scripts read
+// the variables of the transaction, can change the editable collections with `setvar` and
+// are stopped after a maximum number of evaluation steps. The same expressions are evaluated
+// inline against the value of each variable by the `@expr` operator.
+//
+// The actions are the ones of `SecRule`, they are executed when the script matches.
+//
+// Example:
+// ```apache
+// SecRuleScript scripts/correlation.expr "id:1000,phase:2,deny,status:403,msg:'Correlated attack'"
+// ```
+//
+// With `scripts/correlation.expr`:
+// ```
+// # block clients sending the same suspicious argument in the query and the body
+// &ARGS_GET:cmd > 0 && ARGS_GET:cmd == ARGS_POST:cmd && ARGS:cmd =~ '(?i)(wget|curl)';
+// ```
+func directiveSecRuleScript(options *DirectiveOptions) error {
+	if len(options.Opts) == 0 {
+		return errEmptyOptions
+	}
+
+	path, actions, ok := cutSelector(options.Opts)
+	if !ok {
+		return errors.New("syntax error: SecRuleScript PATH \"ACTIONS\"")
+	}
+	rule, err := ParseRule(RuleOptions{
+		WithOperator: false,
+		WAF:          options.WAF,
+		ParserConfig: options.Parser,
+		Raw:          options.Raw,
+		Directive:    "SecRuleScript",
+		Data:         actions,
+		Scope:        options.Scope,
+	})
+	if err != nil {
+		return err
+	}
+	rp := RuleParser{
+		rule: rule,
+		options: RuleOptions{
+			WAF:          options.WAF,
+			ParserConfig: options.Parser,
+		},
+		defaultActions: map[types.RulePhase][]ruleAction{},
+	}
+	if err := rp.ParseOperator("@exprFromFile " + path); err != nil {
+		return fmt.Errorf("failed to load script %q: %v", path, err)
+	}
+	if err := options.addRule(rule); err != nil {
+		return err
+	}
+	options.WAF.Logger.Debug().
+		Str("path", path).
+		Msg("Added SecRuleScript")
+	return nil
+}
+
 // Description: Configures whether response bodies are to be buffered.
 // Syntax: SecResponseBodyAccess On|Off
 // Default: Off
@@ -226,6 +350,10 @@ func directiveSecResponseBodyAccess(options *DirectiveOptions) error {
 	if err != nil {
 		return err
 	}
+	if options.Scope != nil {
+		options.Scope.ResponseBodyAccess = &b
+		return nil
+	}
 	options.WAF.ResponseBodyAccess = b
 	return nil
 }
@@ -245,6 +373,13 @@ func directiveSecRequestBodyLimit(options *DirectiveOptions) error {
 	if err != nil {
 		return err
 	}
+	if options.Scope != nil {
+		if err := validateScopedBodyLimit(limit); err != nil {
+			return err
+		}
+		options.Scope.RequestBodyLimit = &limit
+		return nil
+	}
 	options.WAF.RequestBodyLimit = limit
 	return nil
 }
@@ -267,6 +402,10 @@ func directiveSecRequestBodyAccess(options *DirectiveOptions) error {
 	if err != nil {
 		return err
 	}
+	if options.Scope != nil {
+		options.Scope.RequestBodyAccess = &b
+		return nil
+	}
 	options.WAF.RequestBodyAccess = b
 	return nil
 }
@@ -282,10 +421,28 @@ func directiveSecRequestBodyAccess(options *DirectiveOptions) error {
 // (block, deny, drop, allow, proxy and redirect)
 func directiveSecRuleEngine(options *DirectiveOptions) error {
 	engine, err := types.ParseRuleEngineStatus(options.Opts)
+	if options.Scope != nil {
+		if err == nil {
+			options.Scope.RuleEngine = &engine
+		}
+		return err
+	}
 	options.WAF.RuleEngine = engine
 	return err
 }
 
+// validateScopedBodyLimit checks the body limits of scopes, the ones of the WAF are
+// checked once the configuration is complete.
+func validateScopedBodyLimit(limit int64) error {
+	if limit <= 0 {
+		return errors.New("body limit should be bigger than 0")
+	}
+	if limit > 1024*1024*1024 {
+		return errors.New("body limit should be at most 1GB")
+	}
+	return nil
+}
+
 func directiveUnsupported(options *DirectiveOptions) error {
 	return nil
 }
@@ -309,15 +466,19 @@ func directiveSecServerSignature(options *DirectiveOptions) error {
 }
 
 // Description: Removes the matching rules from the current configuration context.
-// Syntax: SecRuleRemoveByTag [TAG]
+// Syntax: SecRuleRemoveByTag [TAG|/REGEX/]
 // ---
 // Normally, you would use `SecRuleRemoveById` to remove rules, but it may occasionally
 // be easier to disable an entire group of rules with `SecRuleRemoveByTag`. Matching is
-// by case-sensitive string equality.
+// by case-sensitive string equality, or by regular expression when the tag is enclosed
+// in slashes. Conditions on the ID or the message of the rules are added with `&`,
+// see `SecRuleRemoveById`.
 //
 // Example:
 // ```apache
 // SecRuleRemoveByTag attack-dos
+// SecRuleRemoveByTag /^attack-(sqli|xss)$/
+// SecRuleRemoveByTag "paranoia-level/4&id=942000-942999"
 // ```
 //
 // Note: OWASP CRS has a list of supported tags https://coreruleset.org/docs/rules/metadata/
@@ -326,58 +487,136 @@ func directiveSecRuleRemoveByTag(options *DirectiveOptions) error {
 		return errEmptyOptions
 	}
 
-	options.WAF.Rules.DeleteByTag(options.Opts)
-	return nil
+	selector, err := corazawaf.ParseRuleSelector(corazawaf.RuleSelectorTag, options.Opts)
+	if err != nil {
+		return err
+	}
+	return options.editRules(func(e *corazawaf.RuleEditor) error {
+		e.Delete(selector)
+		return nil
+	})
 }
 
+// Description: Removes the matching rules from the current configuration context.
+// Syntax: SecRuleRemoveByMsg [MSG|/REGEX/]
+// ---
+// Removes the rules whose message is the given one, or matches the regular expression
+// enclosed in slashes. Conditions on the ID or the tags of the rules are added with `&`,
+// see `SecRuleRemoveById`. A message without any `id=`, `tag=`, `msg=` or regex condition
+// is matched exactly as a whole, so that messages containing `&` keep working.
+//
+// Example:
+// ```apache
+// SecRuleRemoveByMsg "SQL Injection Attack Detected via libinjection"
+// SecRuleRemoveByMsg /^Remote Command Execution/
+// ```
 func directiveSecRuleRemoveByMsg(options *DirectiveOptions) error {
 	if len(options.Opts) == 0 {
 		return errEmptyOptions
 	}
 
-	options.WAF.Rules.DeleteByMsg(options.Opts)
-	return nil
+	selector, err := corazawaf.ParseRuleSelector(corazawaf.RuleSelectorMsg, options.Opts)
+	if err != nil {
+		return err
+	}
+	return options.editRules(func(e *corazawaf.RuleEditor) error {
+		e.Delete(selector)
+		return nil
+	})
 }
 
 // Description: Removes the matching rules from the current configuration context.
 // Syntax: SecRuleRemoveById ...[ID OR RANGE]
+// ---
+// The IDs and ranges are separated by spaces, the rules matching any of them are removed.
+// Each of them may be combined with conditions on the tags or the message of the rules,
+// separated by `&`: `tag=TAG`, `msg=MSG`, where the value is matched exactly or by the
+// regular expression enclosed in slashes. The same selectors are supported by
+// `SecRuleRemoveByTag`, `SecRuleRemoveByMsg`, the `SecRuleUpdate*` directives and
+// the `ctl` action, where conditions without a field apply to the tag or the message.
+//
+// Example:
+// ```apache
+// SecRuleRemoveById 920100 920200-920299
+// SecRuleRemoveById 942000-942999&tag=/^paranoia-level\/[34]$/
+// ```
 func directiveSecRuleRemoveByID(options *DirectiveOptions) error {
 	if len(options.Opts) == 0 {
 		return errEmptyOptions
 	}
 
-	idsOrRanges := strings.Fields(options.Opts)
-	for _, idOrRange := range idsOrRanges {
-		if idx := strings.Index(idOrRange, "-"); idx == -1 {
-			id, err := strconv.Atoi(idOrRange)
-			if err != nil {
-				return err
-			}
+	selectors, err := parseRuleSelectors(corazawaf.RuleSelectorID, strings.Fields(options.Opts))
+	if err != nil {
+		return err
+	}
+	return options.editRules(func(e *corazawaf.RuleEditor) error {
+		for _, selector := range selectors {
+			e.Delete(selector)
+		}
+		return nil
+	})
+}
 
-			options.WAF.Rules.DeleteByID(id)
-		} else {
-			if idx == 0 {
-				return fmt.Errorf("SecRuleRemoveById: invalid negative id: %s", idOrRange)
-			}
-			start, err := strconv.Atoi(idOrRange[:idx])
-			if err != nil {
-				return err
-			}
+// parseRuleSelectors parses a list of selectors, a rule is selected if any of them matches
+func parseRuleSelectors(field corazawaf.RuleSelectorField, list []string) ([]*corazawaf.RuleSelector, error) {
+	selectors := make([]*corazawaf.RuleSelector, 0, len(list))
+	for _, s := range list {
+		selector, err := corazawaf.ParseRuleSelector(field, s)
+		if err != nil {
+			return nil, err
+		}
+		selectors = append(selectors, selector)
+	}
+	return selectors, nil
+}
 
-			end, err := strconv.Atoi(idOrRange[idx+1:])
-			if err != nil {
-				return err
-			}
+// selectRules returns the rules matched by any of the selectors. Selecting nothing but a
+// single ID that doesn't exist is an error.
+func selectRules(e *corazawaf.RuleEditor, directive string, selectors []*corazawaf.RuleSelector) ([]*corazawaf.Rule, error) {
+	if len(selectors) == 1 {
+		if id, ok := selectors[0].ID(); ok && e.FindByID(id) == nil {
+			return nil, fmt.Errorf("%s: rule \"%d\" not found", directive, id)
+		}
+	}
 
-			if start > end {
-				return fmt.Errorf("invalid range: %s", idOrRange)
+	var rules []*corazawaf.Rule
+	selected := map[*corazawaf.Rule]struct{}{}
+	for _, selector := range selectors {
+		for _, r := range e.Find(selector) {
+			if _, ok := selected[r]; !ok {
+				selected[r] = struct{}{}
+				rules = append(rules, r)
 			}
-
-			options.WAF.Rules.DeleteByRange(start, end)
 		}
 	}
+	return rules, nil
+}
 
-	return nil
+// cutSelector splits the options of the update directives into the rule selectors and the
+// last argument, quoted or not, e.g. `"SQL Injection Attack" "!ARGS:id"`. It also splits the
+// path and the actions of SecRuleScript.
+func cutSelector(opts string) (string, string, bool) {
+	opts = strings.TrimSpace(opts)
+	var selector, arg string
+	if len(opts) > 1 && opts[len(opts)-1] == '"' {
+		start := strings.LastIndex(opts[:len(opts)-1], "\"")
+		if start == -1 {
+			// the opening quote of the selector was removed by the parser
+			start = strings.LastIndexAny(opts, " \t")
+		}
+		if start == -1 {
+			return "", "", false
+		}
+		selector, arg = opts[:start], opts[start+1:len(opts)-1]
+	} else {
+		i := strings.LastIndexAny(opts, " \t")
+		if i == -1 {
+			return "", "", false
+		}
+		selector, arg = opts[:i], strings.Trim(opts[i+1:], "\"")
+	}
+	selector = strings.Trim(strings.TrimSpace(selector), "\"")
+	return selector, arg, selector != "" && arg != ""
 }
 
 func directiveSecResponseBodyMimeTypesClear(options *DirectiveOptions) error {
@@ -442,6 +681,13 @@ func directiveSecResponseBodyLimit(options *DirectiveOptions) error {
 	if err != nil {
 		return err
 	}
+	if options.Scope != nil {
+		if err := validateScopedBodyLimit(limit); err != nil {
+			return err
+		}
+		options.Scope.ResponseBodyLimit = &limit
+		return nil
+	}
 	options.WAF.ResponseBodyLimit = limit
 	return nil
 }
@@ -529,7 +775,123 @@ func directiveSecPcreMatchLimit(options *DirectiveOptions) error {
 	return nil
 }
 
+// Description: Configures the user's registered Honeypot Project HTTP BL API Key
+// to use with `@rbl`.
+// Syntax: SecHttpBlKey [12 char access key]
+// ---
+// If the `@rbl` operator uses the `dnsbl.httpbl.org` RBL (http://www.projecthoneypot.org/httpbl_api.php)
+// you must provide an API key. This key is registered to individual users and is included within
+// the RBL DNS requests. The directive must appear before the rules using `@rbl`.
+//
+// Example:
+// ```apache
+// SecHttpBlKey whdkfieyhtnf
+// SecRule REMOTE_ADDR "@rbl dnsbl.httpbl.org" "id:1,phase:1,deny,log"
+// ```
 func directiveSecHTTPBlKey(options *DirectiveOptions) error {
+	if len(options.Opts) == 0 {
+		return errEmptyOptions
+	}
+
+	key := utils.MaybeRemoveQuotes(options.Opts)
+	if len(key) != 12 {
+		return errors.New("syntax error: SecHttpBlKey expects a 12 characters access key")
+	}
+	for _, c := range key {
+		if c < 'a' || c > 'z' {
+			return errors.New("syntax error: SecHttpBlKey expects a lowercase alphabetic access key")
+		}
+	}
+	options.WAF.HTTPBLKey = key
+	return nil
+}
+
+// Description: Configures the maximum time in milliseconds spent resolving a single `@rbl` lookup.
+// Default: 500
+// Syntax: SecRblTimeout [TIMEOUT_IN_MILLISECONDS]
+// ---
+// Lookups exceeding the timeout are considered as not listed and are not cached. The directive
+// must appear before the rules using `@rbl`.
+//
+// Example:
+// ```apache
+// SecRblTimeout 200
+// ```
+func directiveSecRblTimeout(options *DirectiveOptions) error {
+	if len(options.Opts) == 0 {
+		return errEmptyOptions
+	}
+
+	ms, err := strconv.Atoi(options.Opts)
+	if err != nil {
+		return err
+	}
+	if ms <= 0 {
+		return errors.New("rbl timeout should be bigger than 0")
+	}
+	options.WAF.RBLTimeout = time.Duration(ms) * time.Millisecond
+	return nil
+}
+
+// Description: Sets the performance threshold of the rules, in microseconds.
+// Default: 0 (disabled)
+// Syntax: SecRulePerfTime [USECS]
+// ---
+// The evaluation of the rules, including their chained rules, is timed once the threshold
+// is set. The rules taking at least the threshold are reported in the part H of the audit
+// log as `Rules-Performance-Info`, e.g. `"942100=1520", "932200=1034"`, and are aggregated
+// by the WAF, with the time spent in their operators, to find the rules dominating the
+// latency of the transactions.
+//
+// Example:
+// ```apache
+// SecRulePerfTime 1000
+// ```
+func directiveSecRulePerfTime(options *DirectiveOptions) error {
+	if len(options.Opts) == 0 {
+		return errEmptyOptions
+	}
+
+	usecs, err := strconv.Atoi(options.Opts)
+	if err != nil {
+		return err
+	}
+	if usecs < 0 {
+		return errors.New("rule perf time should be 0 or bigger")
+	}
+	options.WAF.RulePerfTime = time.Duration(usecs) * time.Microsecond
+	return nil
+}
+
+// Description: Configures the maximum time in milliseconds spent by `@inspectFile`
+// inspecting a single file.
+// Default: 10000
+// Syntax: SecInspectFileTimeout [TIMEOUT_IN_MILLISECONDS]
+// ---
+// Inspections exceeding the timeout are considered as no match. The timeout can also be
+// set per rule with the `timeout=DURATION` operator argument, which takes precedence.
+// The directive must appear before the rules using `@inspectFile`. Programs are killed
+// when the timeout expires, while Go inspectors are only asked to stop through their context.
+//
+// Example:
+// ```apache
+// SecInspectFileTimeout 2000
+// SecRule FILES_TMPNAMES "@inspectFile clamscan.sh" "id:1,phase:2,deny,log"
+// SecRule FILES_TMPNAMES "@inspectFile go:clamav timeout=500ms" "id:2,phase:2,deny,log"
+// ```
+func directiveSecInspectFileTimeout(options *DirectiveOptions) error {
+	if len(options.Opts) == 0 {
+		return errEmptyOptions
+	}
+
+	ms, err := strconv.Atoi(options.Opts)
+	if err != nil {
+		return err
+	}
+	if ms <= 0 {
+		return errors.New("inspect file timeout should be bigger than 0")
+	}
+	options.WAF.InspectFileTimeout = time.Duration(ms) * time.Millisecond
 	return nil
 }
 
@@ -537,23 +899,218 @@ func directiveSecGsbLookupDb(options *DirectiveOptions) error {
 	return nil
 }
 
+// parseHashMethod splits the options of SecHashMethodRx and SecHashMethodPm into
+// the target and the unquoted expression
+func parseHashMethod(opts string) (corazawaf.HashTarget, string, error) {
+	name, expr, ok := strings.Cut(strings.TrimSpace(opts), " ")
+	expr = utils.MaybeRemoveQuotes(strings.TrimSpace(expr))
+	if !ok || expr == "" {
+		return 0, "", errors.New("syntax error: expected TYPE and expression")
+	}
+	target, ok := corazawaf.ParseHashTarget(name)
+	if !ok {
+		return 0, "", fmt.Errorf("invalid hash method type %q", name)
+	}
+	return target, expr, nil
+}
+
+// Description: Configures the links to be signed by the hash engine using a list of phrases.
+// Syntax: SecHashMethodPm [TYPE] "[PHRASES]"
+// ---
+// Links of the given type containing any of the space separated phrases, case insensitive,
+// are signed. Supported types are `HashHref`, `HashFormAction`, `HashIframeSrc`,
+// `HashFrameSrc`, `HashScriptSrc` and `HashUrl`, which selects all of them.
+//
+// Example:
+// ```apache
+// SecHashMethodPm HashHref "product_info list_product"
+// ```
 func directiveSecHashMethodPm(options *DirectiveOptions) error {
+	if len(options.Opts) == 0 {
+		return errEmptyOptions
+	}
+
+	target, expr, err := parseHashMethod(options.Opts)
+	if err != nil {
+		return err
+	}
+	phrases := strings.Fields(strings.ToLower(expr))
+	options.WAF.HashMethods = append(options.WAF.HashMethods, corazawaf.HashMethod{
+		Target: target,
+		Match: func(link string) bool {
+			link = strings.ToLower(link)
+			for _, p := range phrases {
+				if strings.Contains(link, p) {
+					return true
+				}
+			}
+			return false
+		},
+	})
 	return nil
 }
 
+// Description: Configures the links to be signed by the hash engine using a regular expression.
+// Syntax: SecHashMethodRx [TYPE] "[REGEX]"
+// ---
+// Links of the given type matching the regular expression are signed. See `SecHashMethodPm`
+// for the supported types.
+//
+// Example:
+// ```apache
+// SecHashMethodRx HashHref "product_info|list_product"
+// SecHashMethodRx HashFormAction "\.php$"
+// ```
 func directiveSecHashMethodRx(options *DirectiveOptions) error {
+	if len(options.Opts) == 0 {
+		return errEmptyOptions
+	}
+
+	target, expr, err := parseHashMethod(options.Opts)
+	if err != nil {
+		return err
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return err
+	}
+	options.WAF.HashMethods = append(options.WAF.HashMethods, corazawaf.HashMethod{
+		Target: target,
+		Match:  re.MatchString,
+	})
 	return nil
 }
 
+// Description: Configures the query parameter carrying the signature of the links.
+// Default: hmac
+// Syntax: SecHashParam [NAME]
+// ---
+// Example:
+// ```apache
+// SecHashParam "hmac"
+// ```
 func directiveSecHashParam(options *DirectiveOptions) error {
+	if len(options.Opts) == 0 {
+		return errEmptyOptions
+	}
+
+	param := utils.MaybeRemoveQuotes(options.Opts)
+	if param == "" || strings.ContainsAny(param, "&=?# ") {
+		return fmt.Errorf("invalid hash parameter %q", param)
+	}
+	options.WAF.HashParam = param
 	return nil
 }
 
+// Description: Configures the key used to sign links and the data bound to the signature.
+// Syntax: SecHashKey [rand|TEXT] [KeyOnly|SessionID|RemoteIP]
+// Default: KeyOnly
+// ---
+// The `rand` key generates a random key on startup, links signed by other instances
+// won't be valid then. The optional mode binds the signature to the key of the
+// `SESSION` collection initialized with `initcol` or to the client address.
+//
+// Example:
+// ```apache
+// SecHashKey "this_is_my_key" KeyOnly
+// SecHashKey rand RemoteIP
+// ```
 func directiveSecHashKey(options *DirectiveOptions) error {
+	if len(options.Opts) == 0 {
+		return errEmptyOptions
+	}
+
+	opts := strings.TrimSpace(options.Opts)
+	var key, mode string
+	if q := opts[0]; q == '"' || q == '\'' {
+		end := strings.IndexByte(opts[1:], q)
+		if end == -1 {
+			return errors.New("syntax error: unterminated hash key")
+		}
+		key, mode = opts[1:end+1], opts[end+2:]
+	} else {
+		key, mode, _ = strings.Cut(opts, " ")
+	}
+	if key == "" {
+		return errors.New("syntax error: empty hash key")
+	}
+
+	switch strings.ToLower(strings.TrimSpace(mode)) {
+	case "", "keyonly":
+		options.WAF.HashKeyMode = corazawaf.HashKeyOnly
+	case "sessionid":
+		options.WAF.HashKeyMode = corazawaf.HashKeySessionID
+	case "remoteip":
+		options.WAF.HashKeyMode = corazawaf.HashKeyRemoteIP
+	default:
+		return fmt.Errorf("invalid hash key mode %q", strings.TrimSpace(mode))
+	}
+
+	if key == "rand" {
+		k := make([]byte, 32)
+		if _, err := rand.Read(k); err != nil {
+			return err
+		}
+		options.WAF.HashKey = k
+		return nil
+	}
+	options.WAF.HashKey = []byte(key)
 	return nil
 }
 
+// Description: Configures the hash engine, which signs the links of HTML responses
+// and enables the `@validateHash` operator.
+// Default: Off
+// Syntax: SecHashEngine On|Off
+// ---
+// The engine requires a key configured with `SecHashKey` and the response bodies to be
+// accessible, see `SecResponseBodyAccess` and `SecResponseBodyMimeType`. Links are signed
+// according to the `SecHashMethodRx` and `SecHashMethodPm` directives, adding the
+// `SecHashParam` parameter to them.
+//
+// Example:
+// ```apache
+// SecHashEngine On
+// SecHashKey "this_is_my_key" KeyOnly
+// SecHashMethodRx HashHref "product_info"
+// SecRule REQUEST_URI "@validateHash product_info" "id:1,phase:1,deny,log"
+// ```
 func directiveSecHashEngine(options *DirectiveOptions) error {
+	if len(options.Opts) == 0 {
+		return errEmptyOptions
+	}
+
+	b, err := parseBoolean(options.Opts)
+	if err != nil {
+		return err
+	}
+	options.WAF.HashEngine = b
+	return nil
+}
+
+// Description: Enables content injection using actions `append` and `prepend`.
+// Default: Off
+// Syntax: SecContentInjection On|Off
+// ---
+// Content is injected in the response body, which requires it to be accessible, see
+// `SecResponseBodyAccess` and `SecResponseBodyMimeType`. Connectors send the modified
+// body with an adjusted Content-Length header.
+//
+// Example:
+// ```apache
+// SecContentInjection On
+// SecRule RESPONSE_CONTENT_TYPE "@beginsWith text/html" "id:1,phase:4,pass,nolog,append:'<!-- %{UNIQUE_ID} -->'"
+// ```
+func directiveSecContentInjection(options *DirectiveOptions) error {
+	if len(options.Opts) == 0 {
+		return errEmptyOptions
+	}
+
+	b, err := parseBoolean(options.Opts)
+	if err != nil {
+		return err
+	}
+	options.WAF.ContentInjection = b
 	return nil
 }
 
@@ -972,75 +1529,48 @@ func directiveSecDebugLogLevel(options *DirectiveOptions) error {
 // Syntax: SecRuleUpdateTargetById ID TARGET1[|TARGET2|TARGET3]
 // ---
 // This directive will append variables to the specified rule with the targets provided in the second parameter.
-// The rule ID can be single IDs or ranges of IDs. The targets are separated by a pipe character.
+// The rule ID can be single IDs or ranges of IDs, combined with conditions on the tags or the message
+// as described in `SecRuleRemoveById`. The targets are separated by a pipe character.
+//
+// Example:
+// ```apache
+// SecRuleUpdateTargetById 942100 !ARGS:password
+// SecRuleUpdateTargetById 942000-942999&tag=attack-sqli "!REQUEST_COOKIES:session"
+// ```
 func directiveSecRuleUpdateTargetByID(options *DirectiveOptions) error {
 	if len(options.Opts) == 0 {
 		return errEmptyOptions
 	}
 
-	idsOrRanges := strings.Fields(options.Opts)
-	length := len(idsOrRanges)
-	if length < 2 {
+	ids, variables, ok := cutSelector(options.Opts)
+	if !ok {
 		return errors.New("syntax error: SecRuleUpdateTargetById id \"VARIABLES\"")
 	}
-	// The last element is expected to be the variable(s)
-	variables := idsOrRanges[length-1]
-	for _, idOrRange := range idsOrRanges[:length-1] {
-		if idx := strings.Index(idOrRange, "-"); idx == -1 {
-			id, err := strconv.Atoi(idOrRange)
-			if err != nil {
-				return err
-			}
-			return updateTargetBySingleID(id, variables, options)
-		} else {
-			if idx == 0 {
-				return fmt.Errorf("SecRuleUpdateTargetById: invalid negative id: %s", idOrRange)
-			}
-			start, err := strconv.Atoi(idOrRange[:idx])
-			if err != nil {
-				return err
-			}
-
-			end, err := strconv.Atoi(idOrRange[idx+1:])
-			if err != nil {
-				return err
-			}
-			if start == end {
-				return updateTargetBySingleID(start, variables, options)
-			}
-			if start > end {
-				return fmt.Errorf("invalid range: %s", idOrRange)
-			}
-
-			for _, rule := range options.WAF.Rules.GetRules() {
-				if rule.ID_ >= start && rule.ID_ <= end {
-					rp := RuleParser{
-						rule:           &rule,
-						options:        RuleOptions{},
-						defaultActions: map[types.RulePhase][]ruleAction{},
-					}
-					if err := rp.ParseVariables(strings.Trim(variables, "\"")); err != nil {
-						return err
-					}
-				}
-			}
-		}
+	selectors, err := parseRuleSelectors(corazawaf.RuleSelectorID, strings.Fields(ids))
+	if err != nil {
+		return err
 	}
-	return nil
+	return options.editRules(func(e *corazawaf.RuleEditor) error {
+		return updateTargets(e, "SecRuleUpdateTargetById", selectors, variables)
+	})
 }
 
-func updateTargetBySingleID(id int, variables string, options *DirectiveOptions) error {
-
-	rule := options.WAF.Rules.FindByID(id)
-	if rule == nil {
-		return fmt.Errorf("SecRuleUpdateTargetById: rule \"%d\" not found", id)
+func updateTargets(e *corazawaf.RuleEditor, directive string, selectors []*corazawaf.RuleSelector, variables string) error {
+	rules, err := selectRules(e, directive, selectors)
+	if err != nil {
+		return err
 	}
-	rp := RuleParser{
-		rule:           rule,
-		options:        RuleOptions{},
-		defaultActions: map[types.RulePhase][]ruleAction{},
+	for _, rule := range rules {
+		rp := RuleParser{
+			rule:           rule,
+			options:        RuleOptions{},
+			defaultActions: map[types.RulePhase][]ruleAction{},
+		}
+		if err := rp.ParseVariables(variables); err != nil {
+			return err
+		}
 	}
-	return rp.ParseVariables(strings.Trim(variables, "\""))
+	return nil
 }
 
 // Description: Updates the action list of the specified rule(s).
@@ -1050,79 +1580,42 @@ func updateTargetBySingleID(id int, variables string, options *DirectiveOptions)
 // It has two limitations: it cannot be used to change the ID or phase of a rule.
 // Only the actions that can appear only once are overwritten.
 // The actions that are allowed to appear multiple times in a list, will be appended to the end of the list.
+// The rules can also be selected by tag or message, see `SecRuleRemoveById`.
 // The following example demonstrates how `SecRuleUpdateActionById` is used:
 // ```apache
 // SecRuleUpdateActionById 12345 "deny,status:403"
+// SecRuleUpdateActionById tag=attack-rce "status:406"
 // ```
 func directiveSecRuleUpdateActionByID(options *DirectiveOptions) error {
 	if len(options.Opts) == 0 {
 		return errEmptyOptions
 	}
 
-	idsOrRanges := strings.Fields(options.Opts)
-	idsOrRangesLen := len(idsOrRanges)
-	if idsOrRangesLen < 2 {
+	ids, actions, ok := cutSelector(options.Opts)
+	if !ok {
 		return errors.New("syntax error: SecRuleUpdateActionById id \"ACTION1,ACTION2,...\"")
 	}
-	// The last element is expected to be the action(s)
-	actions := idsOrRanges[idsOrRangesLen-1]
-	for _, idOrRange := range idsOrRanges[:idsOrRangesLen-1] {
-		if idx := strings.Index(idOrRange, "-"); idx == -1 {
-			id, err := strconv.Atoi(idOrRange)
-			if err != nil {
-				return err
-			}
-			return updateActionBySingleID(id, actions, options)
-		} else {
-			if idx == 0 {
-				return fmt.Errorf("SecRuleUpdateActionById: invalid negative id: %s", idOrRange)
-			}
-			start, err := strconv.Atoi(idOrRange[:idx])
-			if err != nil {
-				return err
+	selectors, err := parseRuleSelectors(corazawaf.RuleSelectorID, strings.Fields(ids))
+	if err != nil {
+		return err
+	}
+	return options.editRules(func(e *corazawaf.RuleEditor) error {
+		rules, err := selectRules(e, "SecRuleUpdateActionById", selectors)
+		if err != nil {
+			return err
+		}
+		for _, rule := range rules {
+			rp := RuleParser{
+				rule:           rule,
+				options:        RuleOptions{},
+				defaultActions: map[types.RulePhase][]ruleAction{},
 			}
-
-			end, err := strconv.Atoi(idOrRange[idx+1:])
-			if err != nil {
+			if err := rp.ParseActions(actions); err != nil {
 				return err
 			}
-			if start == end {
-				return updateActionBySingleID(start, actions, options)
-			}
-			if start > end {
-				return fmt.Errorf("invalid range: %s", idOrRange)
-			}
-
-			for _, rule := range options.WAF.Rules.GetRules() {
-				if rule.ID_ < start && rule.ID_ > end {
-					continue
-				}
-				rp := RuleParser{
-					rule:           &rule,
-					options:        RuleOptions{},
-					defaultActions: map[types.RulePhase][]ruleAction{},
-				}
-				if err := rp.ParseActions(strings.Trim(actions, "\"")); err != nil {
-					return err
-				}
-			}
 		}
-	}
-	return nil
-}
-
-func updateActionBySingleID(id int, actions string, options *DirectiveOptions) error {
-
-	rule := options.WAF.Rules.FindByID(id)
-	if rule == nil {
-		return fmt.Errorf("SecRuleUpdateActionById: rule \"%d\" not found", id)
-	}
-	rp := RuleParser{
-		rule:           rule,
-		options:        RuleOptions{},
-		defaultActions: map[types.RulePhase][]ruleAction{},
-	}
-	return rp.ParseActions(strings.Trim(actions, "\""))
+		return nil
+	})
 }
 
 // Description: Updates the target (variable) list of the specified rule(s) by tag.
@@ -1130,9 +1623,16 @@ func updateActionBySingleID(id int, actions string, options *DirectiveOptions) e
 // ---
 // As an alternative to `SecRuleUpdateTargetById`, this directive will append variables to the specified rule
 // with the targets provided in the second parameter. It can be handy for updating an entire group of rules.
-// Matching is by case-sensitive string equality.
-// This directive will append variables to the specified rule with the targets provided in the second parameter.
-// The rule ID can be single IDs or ranges of IDs. The targets are separated by a pipe character.
+// Matching is by case-sensitive string equality, or by regular expression when the tag is enclosed in slashes,
+// and can be combined with conditions on the ID or the message, see `SecRuleRemoveById`.
+// The targets are separated by a pipe character.
+//
+// Example:
+// ```apache
+// SecRuleUpdateTargetByTag attack-sqli !ARGS:query
+// SecRuleUpdateTargetByTag /^attack-(sqli|xss)$/&id=942000-942999 "!REQUEST_COOKIES:session"
+// ```
+//
 // Note: OWASP CRS has a list of supported tags https://coreruleset.org/docs/rules/metadata/
 func directiveSecRuleUpdateTargetByTag(options *DirectiveOptions) error {
 	tagAndvars := strings.Fields(options.Opts)
@@ -1140,21 +1640,42 @@ func directiveSecRuleUpdateTargetByTag(options *DirectiveOptions) error {
 		return errors.New("syntax error: SecRuleUpdateTargetByTag tag \"VARIABLES\"")
 	}
 
-	for _, rule := range options.WAF.Rules.GetRules() {
-		inputTag := strings.Trim(tagAndvars[0], "\"")
-		if utils.InSlice(inputTag, rule.Tags_) {
-			rp := RuleParser{
-				rule:           &rule,
-				options:        RuleOptions{},
-				defaultActions: map[types.RulePhase][]ruleAction{},
-			}
-			inputVars := strings.Trim(tagAndvars[1], "\"")
-			if err := rp.ParseVariables(inputVars); err != nil {
-				return err
-			}
-		}
+	selector, err := corazawaf.ParseRuleSelector(corazawaf.RuleSelectorTag, strings.Trim(tagAndvars[0], "\""))
+	if err != nil {
+		return err
 	}
-	return nil
+	variables := strings.Trim(tagAndvars[1], "\"")
+	return options.editRules(func(e *corazawaf.RuleEditor) error {
+		return updateTargets(e, "SecRuleUpdateTargetByTag", []*corazawaf.RuleSelector{selector}, variables)
+	})
+}
+
+// Description: Updates the target (variable) list of the specified rule(s) by message.
+// Syntax: SecRuleUpdateTargetByMsg MSG TARGET1[|TARGET2|TARGET3]
+// ---
+// As an alternative to `SecRuleUpdateTargetById`, this directive will append variables to the rules
+// whose message is the given one, or matches the regular expression enclosed in slashes. Conditions
+// on the ID or the tags are added with `&`, see `SecRuleRemoveById` and `SecRuleRemoveByMsg`.
+// The targets are separated by a pipe character.
+//
+// Example:
+// ```apache
+// SecRuleUpdateTargetByMsg "SQL Injection Attack Detected via libinjection" "!ARGS:query"
+// SecRuleUpdateTargetByMsg "/^Remote Command Execution/" "!ARGS:cmd"
+// ```
+func directiveSecRuleUpdateTargetByMsg(options *DirectiveOptions) error {
+	msg, variables, ok := cutSelector(options.Opts)
+	if !ok {
+		return errors.New("syntax error: SecRuleUpdateTargetByMsg \"MESSAGE\" \"VARIABLES\"")
+	}
+
+	selector, err := corazawaf.ParseRuleSelector(corazawaf.RuleSelectorMsg, msg)
+	if err != nil {
+		return err
+	}
+	return options.editRules(func(e *corazawaf.RuleEditor) error {
+		return updateTargets(e, "SecRuleUpdateTargetByMsg", []*corazawaf.RuleSelector{selector}, variables)
+	})
 }
 
 func directiveSecIgnoreRuleCompilationErrors(options *DirectiveOptions) error {
@@ -1198,6 +1719,70 @@ func directiveSecDataset(options *DirectiveOptions) error {
 	return nil
 }
 
+// defaultUnicodeCodePage is the code page loaded by SecUnicodeMap when none is given
+const defaultUnicodeCodePage = 20127
+
+// Description: Loads the code page used by `t:urlDecodeUni` to decode `%uXXXX` sequences.
+// Syntax: SecUnicodeMap [PATH] [CODE_PAGE]
+// Default: 20127
+// ---
+// The file uses the ModSecurity `unicode.mapping` format and is read from the parser root,
+// relative paths are resolved against the directory of the configuration file first.
+// Code points not present in the code page are decoded using their lower byte. Without this
+// directive, a built-in map translating common look-alike characters to ASCII is used.
+// The directive only applies to the rules that follow it.
+//
+// Example:
+// ```apache
+// SecUnicodeMap unicode.mapping 20127
+// SecRule ARGS "@rx <script" "id:1,phase:2,t:urlDecodeUni,deny,log"
+// ```
+func directiveSecUnicodeMap(options *DirectiveOptions) error {
+	if len(options.Opts) == 0 {
+		return errEmptyOptions
+	}
+
+	fields := strings.Fields(options.Opts)
+	if len(fields) > 2 {
+		return errors.New("syntax error: SecUnicodeMap [PATH] [CODE_PAGE]")
+	}
+	codePage := defaultUnicodeCodePage
+	if len(fields) == 2 {
+		cp, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return fmt.Errorf("invalid code page %q", fields[1])
+		}
+		codePage = cp
+	}
+
+	file := utils.MaybeRemoveQuotes(fields[0])
+	data, err := readConfigRelativeFile(options, file)
+	if err != nil {
+		return err
+	}
+	m, err := transformations.ParseUnicodeMap(data, codePage)
+	if err != nil {
+		return fmt.Errorf("failed to load unicode map %s: %w", file, err)
+	}
+	options.Parser.UnicodeMap = m
+	return nil
+}
+
+// readConfigRelativeFile reads a file from the parser root, relative paths are tried
+// against the directory of the current configuration file first.
+func readConfigRelativeFile(options *DirectiveOptions, file string) ([]byte, error) {
+	root := options.Parser.Root
+	if root == nil {
+		root = io.OSFS{}
+	}
+	if !path.IsAbs(file) && options.Parser.ConfigDir != "" {
+		if data, err := fs.ReadFile(root, path.Join(options.Parser.ConfigDir, file)); err == nil {
+			return data, nil
+		}
+	}
+	return fs.ReadFile(root, file)
+}
+
 // Description: Configures the maximum number of ARGS that will be accepted for processing.
 // Default: 1000
 // Syntax: SecArgumentsLimit [LIMIT]
@@ -1220,6 +1805,62 @@ func directiveSecArgumentsLimit(options *DirectiveOptions) error {
 	return nil
 }
 
+// Description: Specifies which character to use as the separator of the arguments of the
+// query string and of the `application/x-www-form-urlencoded` request bodies.
+// Default: &
+// Syntax: SecArgumentSeparator [CHARACTER]
+// ---
+// A few legacy applications use `;` instead of `&`, their arguments are only inspected as
+// such once the separator is set.
+//
+// Example:
+// ```apache
+// SecArgumentSeparator ;
+// ```
+func directiveSecArgumentSeparator(options *DirectiveOptions) error {
+	if len(options.Opts) == 0 {
+		return errEmptyOptions
+	}
+
+	if len(options.Opts) != 1 {
+		return fmt.Errorf("invalid argument separator %q, expected a single character", options.Opts)
+	}
+	options.WAF.ArgumentSeparator = options.Opts[0]
+	return nil
+}
+
+// Description: Selects the cookie format that will be used in the current configuration context.
+// Default: 0
+// Syntax: SecCookieFormat 0|1
+// ---
+// The possible values are:
+// - 0: use version 0 (Netscape) cookies, the name=value pairs are separated by `;`. This is
+// what most applications use.
+// - 1: use version 1 (RFC 2965) cookies, the pairs are separated by `;` or `,` and the values
+// may be quoted. The attributes, e.g. `$Version` and `$Path`, are kept as cookies so that they
+// can be inspected, e.g. with `REQUEST_COOKIES:$Version`.
+//
+// Using an incorrect cookie version may open your installation to evasion attacks against the
+// rules that examine named cookies.
+//
+// Example:
+// ```apache
+// SecCookieFormat 0
+// ```
+func directiveSecCookieFormat(options *DirectiveOptions) error {
+	switch options.Opts {
+	case "0":
+		options.WAF.CookieFormat = cookies.FormatNetscape
+	case "1":
+		options.WAF.CookieFormat = cookies.FormatRFC2965
+	case "":
+		return errEmptyOptions
+	default:
+		return fmt.Errorf("invalid cookie format %q, expected 0 or 1", options.Opts)
+	}
+	return nil
+}
+
 func parseBoolean(data string) (bool, error) {
 	data = strings.ToLower(data)
 	switch data {
@@ -8,7 +8,10 @@ import (
 	"regexp"
 	"strings"
 	"testing"
+	"testing/fstest"
+	"time"
 
+	"github.com/corazawaf/coraza/v3/internal/cookies"
 	"github.com/corazawaf/coraza/v3/internal/corazawaf"
 	"github.com/corazawaf/coraza/v3/internal/environment"
 	"github.com/corazawaf/coraza/v3/types"
@@ -21,11 +24,6 @@ func Test_NonImplementedDirective(t *testing.T) {
 		`SecPcreMatchLimit 1500`,
 		`SecPcreMatchLimitRecursion 1500`,
 		`SecHttpBlKey whdkfieyhtnf`,
-		`SecHashMethodRx HashHref "product_info|list_product"`,
-		`SecHashMethodPm HashHref“product_info list_product”`,
-		`SecHashParam "hmac"`,
-		`SecHashKey "this_is_my_key" KeyOnly`,
-		`SecHashEngine On`,
 	}
 	w := corazawaf.NewWAF()
 	p := NewParser(w)
@@ -87,6 +85,97 @@ func TestSecRuleUpdateTargetByID(t *testing.T) {
 
 }
 
+func TestRuleSelectorDirectives(t *testing.T) {
+	waf := corazawaf.NewWAF()
+	p := NewParser(waf)
+	if err := p.FromString(`
+SecRuleEngine On
+SecRule ARGS "@contains sqli" "id:942100,phase:1,deny,status:403,msg:'SQL Injection Attack',tag:attack-sqli,tag:paranoia-level/1"
+SecRule ARGS "@contains union" "id:942200,phase:1,deny,status:403,msg:'SQL Injection Attack',tag:attack-sqli,tag:paranoia-level/2"
+SecRule ARGS "@contains xss" "id:941100,phase:1,deny,status:403,msg:'XSS Attack',tag:attack-xss"
+SecRule ARGS "@contains script" "id:941200,phase:1,deny,status:403,msg:'XSS Attack',tag:attack-xss"
+SecRule ARGS "@contains rce" "id:932100,phase:1,deny,status:403,msg:'Remote Command Execution: Unix Shell',tag:attack-rce"
+SecRule ARGS "@contains http" "id:920100,phase:1,deny,status:403,msg:'Invalid HTTP Request Line'"
+
+SecRuleRemoveByTag "/^paranoia-level\/[2-4]$/&id=942000-942999"
+SecRuleRemoveByMsg /^Invalid HTTP/
+SecRuleUpdateTargetByMsg "Remote Command Execution: Unix Shell" "!ARGS:cmd"
+SecRuleUpdateTargetById 941000-941999 !ARGS:html
+SecRuleUpdateActionById tag=attack-sqli "status:406"
+`); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]int{
+		"/?a=sqli":      406,
+		"/?a=union":     0,
+		"/?a=http":      0,
+		"/?cmd=rce":     0,
+		"/?c=rce":       403,
+		"/?html=xss":    0,
+		"/?html=script": 0,
+		"/?h=script":    403,
+	}
+	for uri, status := range tests {
+		t.Run(uri, func(t *testing.T) {
+			tx := waf.NewTransaction()
+			defer tx.Close()
+			tx.ProcessURI(uri, "GET", "HTTP/1.1")
+			it := tx.ProcessRequestHeaders()
+			have := 0
+			if it != nil {
+				have = it.Status
+			}
+			if want := status; want != have {
+				t.Errorf("unexpected status, want %d, have %d", want, have)
+			}
+		})
+	}
+}
+
+func TestSecRuleScript(t *testing.T) {
+	waf := corazawaf.NewWAF()
+	p := NewParser(waf)
+	if err := p.FromString(`
+SecRuleEngine On
+SecAction "id:1,phase:1,pass,nolog,setvar:tx.score=0"
+SecRuleScript testdata/scripts/correlation.expr "id:2,phase:1,deny,status:403"
+SecRule ARGS "@expr len(value) > 10 && TX:score > 0" "id:3,phase:1,deny,status:406"
+`); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]int{
+		"/?cmd=ls":                    0,
+		"/?cmd=wget":                  0,
+		"/?cmd=wget&a=averylongvalue": 406,
+		"/?cmd=curl&xff=2":            403,
+	}
+	for uri, status := range tests {
+		t.Run(uri, func(t *testing.T) {
+			tx := waf.NewTransaction()
+			defer tx.Close()
+			tx.ProcessURI(uri, "GET", "HTTP/1.1")
+			if strings.Contains(uri, "xff") {
+				tx.AddRequestHeader("X-Forwarded-For", "10.0.0.1")
+				tx.AddRequestHeader("X-Forwarded-For", "10.0.0.2")
+			}
+			it := tx.ProcessRequestHeaders()
+			have := 0
+			if it != nil {
+				have = it.Status
+			}
+			if want := status; want != have {
+				t.Errorf("unexpected status, want %d, have %d", want, have)
+			}
+		})
+	}
+
+	if err := NewParser(waf).FromString(`SecRuleScript testdata/scripts/unknown.expr "id:4"`); err == nil {
+		t.Error("expected an error loading a missing script")
+	}
+}
+
 func TestInvalidBooleanForDirectives(t *testing.T) {
 	waf := corazawaf.NewWAF()
 	p := NewParser(waf)
@@ -176,6 +265,11 @@ func TestDirectives(t *testing.T) {
 			{"On", func(w *corazawaf.WAF) bool { return w.RuleEngine == types.RuleEngineOn }},
 			{"Off", func(w *corazawaf.WAF) bool { return w.RuleEngine == types.RuleEngineOff }},
 		},
+		"SecRuleScript": {
+			{"", expectErrorOnDirective},
+			{"testdata/scripts/correlation.expr", expectErrorOnDirective},
+			{`testdata/scripts/correlation.expr "id:1,invalid:1"`, expectErrorOnDirective},
+		},
 		"SecAction": {
 			{"", expectErrorOnDirective},
 			{`"id:1,tag:test"`, func(w *corazawaf.WAF) bool { return w.Rules.Count() == 1 }},
@@ -241,6 +335,14 @@ func TestDirectives(t *testing.T) {
 			{"tag-1 tag-2 \"ARGS:wp_post\"", expectErrorOnDirective}, // Multiple tags in line is not supported
 			{"tag-2 \"ARGS:wp_post|RESPONSE_HEADERS|!REQUEST_BODY\"", expectNoErrorOnDirective},
 		},
+		"SecRuleUpdateTargetByMsg": {
+			{"", expectErrorOnDirective},
+			{"a", expectErrorOnDirective},
+			{"\"SQL Injection\"", expectErrorOnDirective},
+			{"\"/[a-/\" \"ARGS:wp_post\"", expectErrorOnDirective},
+			{"\"SQL Injection\" \"ARGS:wp_post\"", expectNoErrorOnDirective},
+			{"/^SQL/&tag=attack-sqli \"!ARGS:wp_post|RESPONSE_HEADERS\"", expectNoErrorOnDirective},
+		},
 		"SecResponseBodyMimeTypesClear": {
 			{"", func(w *corazawaf.WAF) bool { return len(w.ResponseBodyMimeTypes) == 0 }},
 			{"x", expectErrorOnDirective},
@@ -310,6 +412,91 @@ func TestDirectives(t *testing.T) {
 			// according to modsec docs SecArgumentsLimit 1000
 			{"1000", func(waf *corazawaf.WAF) bool { return waf.ArgumentLimit == 1000 }},
 		},
+		"SecArgumentSeparator": {
+			{"", expectErrorOnDirective},
+			{"&;", expectErrorOnDirective},
+			{";", func(waf *corazawaf.WAF) bool { return waf.ArgumentSeparator == ';' }},
+		},
+		"SecCookieFormat": {
+			{"", expectErrorOnDirective},
+			{"2", expectErrorOnDirective},
+			{"1", func(waf *corazawaf.WAF) bool { return waf.CookieFormat == cookies.FormatRFC2965 }},
+			{"0", func(waf *corazawaf.WAF) bool { return waf.CookieFormat == cookies.FormatNetscape }},
+		},
+		"SecHttpBlKey": {
+			{"", expectErrorOnDirective},
+			{"short", expectErrorOnDirective},
+			{"WHDKFIEYHTNF", expectErrorOnDirective},
+			{"whdkfieyhtnf", func(waf *corazawaf.WAF) bool { return waf.HTTPBLKey == "whdkfieyhtnf" }},
+		},
+		"SecRblTimeout": {
+			{"", expectErrorOnDirective},
+			{"a", expectErrorOnDirective},
+			{"0", expectErrorOnDirective},
+			{"200", func(waf *corazawaf.WAF) bool { return waf.RBLTimeout == 200*time.Millisecond }},
+		},
+		"SecRulePerfTime": {
+			{"", expectErrorOnDirective},
+			{"a", expectErrorOnDirective},
+			{"-1", expectErrorOnDirective},
+			{"0", func(waf *corazawaf.WAF) bool { return waf.RulePerfTime == 0 }},
+			{"1500", func(waf *corazawaf.WAF) bool { return waf.RulePerfTime == 1500*time.Microsecond }},
+		},
+		"SecContentInjection": {
+			{"", expectErrorOnDirective},
+			{"sure", expectErrorOnDirective},
+			{"On", func(waf *corazawaf.WAF) bool { return waf.ContentInjection }},
+			{"Off", func(waf *corazawaf.WAF) bool { return !waf.ContentInjection }},
+		},
+		"SecHashEngine": {
+			{"", expectErrorOnDirective},
+			{"sure", expectErrorOnDirective},
+			{"On", func(waf *corazawaf.WAF) bool { return waf.HashEngine }},
+			{"Off", func(waf *corazawaf.WAF) bool { return !waf.HashEngine }},
+		},
+		"SecHashKey": {
+			{"", expectErrorOnDirective},
+			{`"unterminated`, expectErrorOnDirective},
+			{"key Unknown", expectErrorOnDirective},
+			{"key", func(waf *corazawaf.WAF) bool {
+				return string(waf.HashKey) == "key" && waf.HashKeyMode == corazawaf.HashKeyOnly
+			}},
+			{`"this is my key" SessionID`, func(waf *corazawaf.WAF) bool {
+				return string(waf.HashKey) == "this is my key" && waf.HashKeyMode == corazawaf.HashKeySessionID
+			}},
+			{"rand RemoteIP", func(waf *corazawaf.WAF) bool {
+				return len(waf.HashKey) == 32 && waf.HashKeyMode == corazawaf.HashKeyRemoteIP
+			}},
+		},
+		"SecHashParam": {
+			{"", expectErrorOnDirective},
+			{`"a&b"`, expectErrorOnDirective},
+			{`"hmac"`, func(waf *corazawaf.WAF) bool { return waf.HashParam == "hmac" }},
+		},
+		"SecHashMethodRx": {
+			{"", expectErrorOnDirective},
+			{"HashHref", expectErrorOnDirective},
+			{`HashUnknown "product"`, expectErrorOnDirective},
+			{`HashHref "("`, expectErrorOnDirective},
+			{`HashHref "product_info|list_product"`, func(waf *corazawaf.WAF) bool {
+				return len(waf.HashMethods) == 1 && waf.HashMethods[0].Target == corazawaf.HashHref &&
+					waf.HashMethods[0].Match("/list_product") && !waf.HashMethods[0].Match("/about")
+			}},
+		},
+		"SecHashMethodPm": {
+			{"", expectErrorOnDirective},
+			{`HashFormAction ""`, expectErrorOnDirective},
+			{`HashFormAction "product_info list_product"`, func(waf *corazawaf.WAF) bool {
+				return len(waf.HashMethods) == 1 && waf.HashMethods[0].Target == corazawaf.HashFormAction &&
+					waf.HashMethods[0].Match("/LIST_PRODUCT") && !waf.HashMethods[0].Match("/about")
+			}},
+		},
+		"SecInspectFileTimeout": {
+			{"", expectErrorOnDirective},
+			{"a", expectErrorOnDirective},
+			{"-5", expectErrorOnDirective},
+			{"2000", func(waf *corazawaf.WAF) bool { return waf.InspectFileTimeout == 2*time.Second }},
+		},
 	}
 	if environment.HasAccessToFS {
 		directiveCases["SecUploadDir"] = []directiveCase{
@@ -355,3 +542,59 @@ func TestDirectives(t *testing.T) {
 		})
 	}
 }
+
+func TestSecUnicodeMap(t *testing.T) {
+	root := fstest.MapFS{
+		"conf/unicode.mapping": &fstest.MapFile{Data: []byte("(MAC - Roman)\n\n" +
+			"1252  (ANSI - Latin I)\n0101:61 ff1c:3e\n\n" +
+			"20127  (US-ASCII)\n0101:61\n")},
+	}
+
+	for _, tc := range []struct {
+		directives string
+		expectErr  bool
+	}{
+		{directives: "SecUnicodeMap", expectErr: true},
+		{directives: "SecUnicodeMap conf/unicode.mapping 1 2", expectErr: true},
+		{directives: "SecUnicodeMap conf/unicode.mapping abc", expectErr: true},
+		{directives: "SecUnicodeMap conf/missing.mapping", expectErr: true},
+		{directives: "SecUnicodeMap conf/unicode.mapping 437", expectErr: true},
+		{directives: "SecUnicodeMap conf/unicode.mapping"},
+		{directives: "SecUnicodeMap conf/unicode.mapping 1252"},
+	} {
+		t.Run(tc.directives, func(t *testing.T) {
+			p := NewParser(corazawaf.NewWAF())
+			p.SetRoot(root)
+			if err := p.FromString(tc.directives); (err != nil) != tc.expectErr {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+
+	waf := corazawaf.NewWAF()
+	p := NewParser(waf)
+	p.SetRoot(root)
+	if err := p.FromString(`
+SecRule ARGS_GET "@rx ^\x01<$" "id:1,phase:1,t:urlDecodeUni,log,pass"
+SecUnicodeMap conf/unicode.mapping 1252
+SecRule ARGS_GET "@streq a>" "id:2,phase:1,t:none,t:urlDecodeUni,log,pass"
+`); err != nil {
+		t.Fatal(err)
+	}
+
+	tx := waf.NewTransaction()
+	defer tx.Close()
+	tx.AddGetRequestArgument("q", "%u0101%uff1c")
+	tx.ProcessRequestHeaders()
+
+	matched := map[int]bool{}
+	for _, r := range tx.MatchedRules() {
+		matched[r.Rule().ID()] = true
+	}
+	if !matched[1] {
+		t.Error("expected match of the rule using the default unicode map")
+	}
+	if !matched[2] {
+		t.Error("expected match of the rule using the loaded unicode map")
+	}
+}
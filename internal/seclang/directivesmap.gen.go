@@ -10,6 +10,7 @@ var (
 	_ directive = directiveSecMarker
 	_ directive = directiveSecAction
 	_ directive = directiveSecRule
+	_ directive = directiveSecRuleScript
 	_ directive = directiveSecResponseBodyAccess
 	_ directive = directiveSecRequestBodyLimit
 	_ directive = directiveSecRequestBodyAccess
@@ -33,12 +34,16 @@ var (
 	_ directive = directiveSecPcreMatchLimitRecursion
 	_ directive = directiveSecPcreMatchLimit
 	_ directive = directiveSecHTTPBlKey
+	_ directive = directiveSecRblTimeout
+	_ directive = directiveSecRulePerfTime
+	_ directive = directiveSecInspectFileTimeout
 	_ directive = directiveSecGsbLookupDb
 	_ directive = directiveSecHashMethodPm
 	_ directive = directiveSecHashMethodRx
 	_ directive = directiveSecHashParam
 	_ directive = directiveSecHashKey
 	_ directive = directiveSecHashEngine
+	_ directive = directiveSecContentInjection
 	_ directive = directiveSecDefaultAction
 	_ directive = directiveSecConnEngine
 	_ directive = directiveSecCollectionTimeout
@@ -62,9 +67,13 @@ var (
 	_ directive = directiveSecRuleUpdateTargetByID
 	_ directive = directiveSecRuleUpdateActionByID
 	_ directive = directiveSecRuleUpdateTargetByTag
+	_ directive = directiveSecRuleUpdateTargetByMsg
 	_ directive = directiveSecIgnoreRuleCompilationErrors
 	_ directive = directiveSecDataset
+	_ directive = directiveSecUnicodeMap
 	_ directive = directiveSecArgumentsLimit
+	_ directive = directiveSecArgumentSeparator
+	_ directive = directiveSecCookieFormat
 )
 
 var directivesMap = map[string]directive{
@@ -72,6 +81,7 @@ var directivesMap = map[string]directive{
 	"secmarker":                      directiveSecMarker,
 	"secaction":                      directiveSecAction,
 	"secrule":                        directiveSecRule,
+	"secrulescript":                  directiveSecRuleScript,
 	"secresponsebodyaccess":          directiveSecResponseBodyAccess,
 	"secrequestbodylimit":            directiveSecRequestBodyLimit,
 	"secrequestbodyaccess":           directiveSecRequestBodyAccess,
@@ -95,12 +105,16 @@ var directivesMap = map[string]directive{
 	"secpcrematchlimitrecursion":     directiveSecPcreMatchLimitRecursion,
 	"secpcrematchlimit":              directiveSecPcreMatchLimit,
 	"sechttpblkey":                   directiveSecHTTPBlKey,
+	"secrbltimeout":                  directiveSecRblTimeout,
+	"secruleperftime":                directiveSecRulePerfTime,
+	"secinspectfiletimeout":          directiveSecInspectFileTimeout,
 	"secgsblookupdb":                 directiveSecGsbLookupDb,
 	"sechashmethodpm":                directiveSecHashMethodPm,
 	"sechashmethodrx":                directiveSecHashMethodRx,
 	"sechashparam":                   directiveSecHashParam,
 	"sechashkey":                     directiveSecHashKey,
 	"sechashengine":                  directiveSecHashEngine,
+	"seccontentinjection":            directiveSecContentInjection,
 	"secdefaultaction":               directiveSecDefaultAction,
 	"secconnengine":                  directiveSecConnEngine,
 	"seccollectiontimeout":           directiveSecCollectionTimeout,
@@ -124,16 +138,14 @@ var directivesMap = map[string]directive{
 	"secruleupdatetargetbyid":        directiveSecRuleUpdateTargetByID,
 	"secruleupdateactionbyid":        directiveSecRuleUpdateActionByID,
 	"secruleupdatetargetbytag":       directiveSecRuleUpdateTargetByTag,
+	"secruleupdatetargetbymsg":       directiveSecRuleUpdateTargetByMsg,
 	"secignorerulecompilationerrors": directiveSecIgnoreRuleCompilationErrors,
 	"secdataset":                     directiveSecDataset,
+	"secunicodemap":                  directiveSecUnicodeMap,
 	"secargumentslimit":              directiveSecArgumentsLimit,
+	"secargumentseparator":           directiveSecArgumentSeparator,
+	"seccookieformat":                directiveSecCookieFormat,
 
 	// Unsupported directives
-	"secargumentseparator":     directiveUnsupported,
-	"seccookieformat":          directiveUnsupported,
-	"secruleupdatetargetbymsg": directiveUnsupported,
-	"secrulescript":            directiveUnsupported,
-	"secruleperftime":          directiveUnsupported,
-	"secunicodemap":            directiveUnsupported,
-	"sectmpdir":                directiveUnsupported,
+	"sectmpdir": directiveUnsupported,
 }
@@ -10,11 +10,18 @@ import (
 	"io/fs"
 	"os"
 	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
 	"strings"
 
 	"github.com/corazawaf/coraza/v3/internal/corazawaf"
 	"github.com/corazawaf/coraza/v3/internal/environment"
 	"github.com/corazawaf/coraza/v3/internal/io"
+	"github.com/corazawaf/coraza/v3/internal/operators"
+	utils "github.com/corazawaf/coraza/v3/internal/strings"
+	"github.com/corazawaf/coraza/v3/internal/transformations"
+	"github.com/corazawaf/coraza/v3/types"
 )
 
 // maxIncludeRecursion is used to avoid DDOS by including files that include
@@ -28,6 +35,37 @@ type Parser struct {
 	currentDir   string
 	root         fs.FS
 	includeCount int
+	// blocks are the lowercase names of the open blocks, e.g. virtualhost
+	blocks []string
+	// defines are the variables set by Define, expanded as ${NAME} in the directives
+	defines map[string]string
+	// skipping is the number of open blocks when the condition of the last one was not
+	// met, 0 when the directives are evaluated
+	skipping int
+	// directiveLine and directiveColumn are the position of the directive being evaluated
+	directiveLine   int
+	directiveColumn int
+	// collectErrors makes the parser continue after the errors, they are kept in errors
+	collectErrors bool
+	errors        []*types.ParseError
+}
+
+// scopedDirectives are the directives supported within <VirtualHost> and <Location> blocks
+var scopedDirectives = map[string]struct{}{
+	"secaction":                {},
+	"secmarker":                {},
+	"secrequestbodyaccess":     {},
+	"secrequestbodylimit":      {},
+	"secresponsebodyaccess":    {},
+	"secresponsebodylimit":     {},
+	"secrule":                  {},
+	"secruleengine":            {},
+	"secruleremovebyid":        {},
+	"secruleremovebymsg":       {},
+	"secruleremovebytag":       {},
+	"secruleupdateactionbyid":  {},
+	"secruleupdatetargetbyid":  {},
+	"secruleupdatetargetbytag": {},
 }
 
 // FromFile imports directives from a file
@@ -38,6 +76,9 @@ type Parser struct {
 // It will return an error if there are no files matching the pattern.
 func (p *Parser) FromFile(profilePath string) error {
 	originalDir := p.currentDir
+	// the included files are numbered from their first line, the position in the including
+	// file is restored afterwards
+	originalFile, originalLine := p.currentFile, p.currentLine
 
 	var files []string
 	if strings.Contains(profilePath, "*") {
@@ -61,51 +102,56 @@ func (p *Parser) FromFile(profilePath string) error {
 			profilePath = filepath.Join(p.currentDir, profilePath)
 		}
 		p.currentFile = profilePath
+		p.currentLine = 0
 		lastDir := p.currentDir
 		p.currentDir = filepath.Dir(profilePath)
 		file, err := fs.ReadFile(p.root, profilePath)
 		if err != nil {
 			// we don't use defer for this as tinygo does not seem to like it
 			p.currentDir = originalDir
-			p.currentFile = ""
-			return fmt.Errorf("failed to readfile: %s", err.Error())
+			p.currentFile, p.currentLine = originalFile, originalLine
+			return fmt.Errorf("failed to readfile: %w", err)
 		}
 
 		err = p.parseString(string(file))
 		if err != nil {
 			// we don't use defer for this as tinygo does not seem to like it
 			p.currentDir = originalDir
-			p.currentFile = ""
-			return fmt.Errorf("failed to parse string: %s", err.Error())
+			p.currentFile, p.currentLine = originalFile, originalLine
+			// the error carries its position in the file
+			return err
 		}
 		// restore the lastDir post processing all includes
 		p.currentDir = lastDir
 	}
 	// we don't use defer for this as tinygo does not seem to like it
 	p.currentDir = originalDir
-	p.currentFile = ""
+	p.currentFile, p.currentLine = originalFile, originalLine
 
 	return nil
 }
 
 // FromString imports directives from a string
 // It will return error if any directive fails to parse
-// or arguments are invalid
+// or arguments are invalid. The lines are counted from
+// the start of the string.
 func (p *Parser) FromString(data string) error {
-	oldCurrentFile := p.currentFile
-	p.currentFile = "_inline_"
+	originalFile, originalLine := p.currentFile, p.currentLine
+	p.currentFile, p.currentLine = "_inline_", 0
 	err := p.parseString(data)
-	p.currentFile = oldCurrentFile
+	p.currentFile, p.currentLine = originalFile, originalLine
 	return err
 }
 
 func (p *Parser) parseString(data string) error {
+	openBlocks := len(p.blocks)
 	scanner := bufio.NewScanner(strings.NewReader(data))
 	var linebuffer strings.Builder
 	inBackticks := false
 	for scanner.Scan() {
 		p.currentLine++
-		line := strings.TrimSpace(scanner.Text())
+		raw := scanner.Text()
+		line := strings.TrimSpace(raw)
 		lineLen := len(line)
 		if lineLen == 0 {
 			continue
@@ -114,6 +160,10 @@ func (p *Parser) parseString(data string) error {
 		if line[0] == '#' {
 			continue
 		}
+		if linebuffer.Len() == 0 {
+			p.directiveLine = p.currentLine
+			p.directiveColumn = len(raw) - len(strings.TrimLeft(raw, " \t")) + 1
+		}
 
 		// Looks for a line like "SecDataset test `". The backtick starts an action list.
 		// The list will be closed only with a single "`" line.
@@ -134,31 +184,123 @@ func (p *Parser) parseString(data string) error {
 			linebuffer.WriteString(strings.TrimSuffix(line, "\\"))
 		} else {
 			linebuffer.WriteString(line)
-			err := p.evaluateLine(linebuffer.String())
-			if err != nil {
-				return err
-			}
+			l := linebuffer.String()
 			linebuffer.Reset()
+			if err := p.evaluateLine(l); err != nil {
+				if err := p.directiveError(l, err); err != nil {
+					return err
+				}
+			}
 		}
 	}
 	if inBackticks {
-		return errors.New("backticks left open")
+		if err := p.directiveError(linebuffer.String(), errors.New("backticks left open")); err != nil {
+			return err
+		}
+	}
+	if len(p.blocks) > openBlocks {
+		err := fmt.Errorf("<%s> block left open", p.blocks[len(p.blocks)-1])
+		// the blocks of the file are closed so that the following files aren't scoped
+		for len(p.blocks) > openBlocks {
+			p.closeBlock()
+		}
+		p.directiveLine, p.directiveColumn = p.currentLine, 1
+		return p.directiveError("", err)
+	}
+	return nil
+}
+
+// directiveError returns the error of the directive with its position, or records it and
+// returns nil when the errors are collected. The errors of the included files keep their
+// own position.
+func (p *Parser) directiveError(l string, err error) error {
+	var pe *types.ParseError
+	if !errors.As(err, &pe) {
+		directive, opts := splitDirective(p.expandDefines(l))
+		pe = &types.ParseError{
+			File:      p.currentFile,
+			Line:      p.directiveLine,
+			Column:    p.directiveColumn,
+			Directive: directive,
+			RuleID:    p.directiveRuleID(directive, opts),
+			Err:       err,
+		}
+	}
+	switch {
+	case p.options.linter != nil:
+		p.options.linter.recover(pe)
+	case p.collectErrors:
+		p.errors = append(p.errors, pe)
+	default:
+		return pe
 	}
 	return nil
 }
 
+// ruleIDRegex matches the id action in the actions of a rule
+var ruleIDRegex = regexp.MustCompile(`(?:^|[\s,"])id\s*:\s*'?(\d+)`)
+
+// directiveRuleID returns the ID of the rule created by the directive, or of the rule it is
+// chained to, 0 if there is none
+func (p *Parser) directiveRuleID(directive, opts string) int {
+	switch directive {
+	case "secrule", "secaction", "secrulescript":
+	default:
+		return 0
+	}
+	if m := ruleIDRegex.FindStringSubmatch(ruleActions(directive, opts)); m != nil {
+		id, _ := strconv.Atoi(m[1])
+		return id
+	}
+	rules := &p.options.WAF.Rules
+	if p.options.Scope != nil {
+		rules = p.options.Scope.Rules()
+	}
+	if parent := getLastRuleExpectingChain(rules); parent != nil {
+		return parent.ID_
+	}
+	return 0
+}
+
+// splitDirective splits the line into the lowercase name of the directive and its options
+func splitDirective(l string) (string, string) {
+	dir, opts, _ := strings.Cut(l, " ")
+	if len(opts) >= 3 && opts[0] == '"' && opts[len(opts)-1] == '"' {
+		opts = strings.Trim(opts, `"`)
+	}
+	return strings.ToLower(dir), opts
+}
+
 func (p *Parser) evaluateLine(l string) error {
 	if l == "" || l[0] == '#' {
 		panic("invalid line")
 	}
+	if p.skipping == 0 {
+		l = strings.TrimSpace(p.expandDefines(l))
+		// a line made only of references may expand to nothing or to a comment
+		if l == "" || l[0] == '#' {
+			return nil
+		}
+	}
+	if l[0] == '<' {
+		return p.evaluateBlock(l)
+	}
+	if p.skipping > 0 {
+		return nil
+	}
 	// first we get the directive
-	dir, opts, _ := strings.Cut(l, " ")
+	directive, opts := splitDirective(l)
 
 	p.options.WAF.Logger.Debug().Str("line", l).Msg("Parsing directive")
-	directive := strings.ToLower(dir)
 
-	if len(opts) >= 3 && opts[0] == '"' && opts[len(opts)-1] == '"' {
-		opts = strings.Trim(opts, `"`)
+	if directive == "define" {
+		// like Include, Define changes the state of the parser
+		name, value, _ := strings.Cut(opts, " ")
+		if !defineNameRegex.MatchString(name) {
+			return p.logAndReturnErr(fmt.Sprintf("invalid variable name %q", name))
+		}
+		p.Define(name, utils.MaybeRemoveQuotes(strings.TrimSpace(value)))
+		return nil
 	}
 
 	if directive == "include" {
@@ -177,6 +319,13 @@ func (p *Parser) evaluateLine(l string) error {
 	if !ok || d == nil {
 		return p.logAndReturnErr(fmt.Sprintf("unknown directive %q", directive))
 	}
+	if _, ok := scopedDirectives[directive]; !ok && p.options.Scope != nil {
+		return p.logAndReturnErr(fmt.Sprintf("directive %q is not supported within <%s>", directive, p.scopeBlock()))
+	}
+
+	if p.options.linter != nil && !p.options.linter.directive(directive, opts, p.options.Scope, p.currentFile, p.directiveLine, p.currentLine) {
+		return nil
+	}
 
 	p.options.Raw = l
 	p.options.Opts = opts
@@ -199,6 +348,185 @@ func (p *Parser) evaluateLine(l string) error {
 	return nil
 }
 
+// evaluateBlock opens or closes a block scoping the directives it contains:
+//
+//	<VirtualHost HOST...> matches the requests whose server name is one of the hosts
+//	<Location PATH> matches the requests whose path starts with PATH, it may be nested
+//	in a <VirtualHost> block.
+//
+// or a conditional block, whose directives are evaluated only if its condition is met, in
+// the scope of the enclosing block. The condition is negated by a "!" before its argument.
+//
+//	<IfDefined NAME> is met if NAME is defined by Define, or is one of the build features:
+//	coraza.rule.multiphase_evaluation, no_fs_access and tinygo.
+//	<IfOperator NAME> is met if the operator, e.g. rbl, is available in the build.
+//	<IfEnv VAR> is met if the environment variable is set.
+func (p *Parser) evaluateBlock(l string) error {
+	if l[len(l)-1] != '>' {
+		return p.logAndReturnErr(fmt.Sprintf("malformed block %q", l))
+	}
+	name, args, _ := strings.Cut(l[1:len(l)-1], " ")
+	name = strings.ToLower(name)
+	args = strings.TrimSpace(args)
+
+	if closing, ok := strings.CutPrefix(name, "/"); ok {
+		if len(p.blocks) == 0 || p.blocks[len(p.blocks)-1] != closing {
+			return p.logAndReturnErr(fmt.Sprintf("unexpected closing block %q", l))
+		}
+		scope := p.options.Scope
+		p.closeBlock()
+		if scope != p.options.Scope {
+			// the exclusions of the scope fail when loading the configuration, like the
+			// ones outside of a scope
+			if err := scope.Apply(p.options.WAF); err != nil {
+				return fmt.Errorf("failed to apply the rules of <%s>: %w", closing, err)
+			}
+		}
+		return nil
+	}
+
+	if p.skipping > 0 {
+		// the blocks are only tracked to find the end of the conditional block
+		p.blocks = append(p.blocks, name)
+		return nil
+	}
+
+	if cond, ok := blockConditions[name]; ok {
+		arg, negated := strings.CutPrefix(args, "!")
+		arg = strings.TrimSpace(arg)
+		if arg == "" || strings.ContainsAny(arg, " \t") {
+			return p.logAndReturnErr(fmt.Sprintf("block %q expects a single argument", l))
+		}
+		p.blocks = append(p.blocks, name)
+		if cond(p, arg) == negated {
+			p.skipping = len(p.blocks)
+		}
+		return nil
+	}
+
+	var scope *corazawaf.Scope
+	switch name {
+	case "virtualhost":
+		if p.options.Scope != nil {
+			return p.logAndReturnErr("<VirtualHost> blocks cannot be nested")
+		}
+		hosts := strings.Fields(args)
+		if len(hosts) == 0 {
+			return p.logAndReturnErr("<VirtualHost> expects at least one host")
+		}
+		scope = corazawaf.NewScope(nil, hosts, "")
+	case "location":
+		if b := p.scopeBlock(); b != "" && b != "virtualhost" {
+			return p.logAndReturnErr("<Location> blocks can only be nested in <VirtualHost> blocks")
+		}
+		path := strings.Trim(args, `"`)
+		if !strings.HasPrefix(path, "/") {
+			return p.logAndReturnErr(fmt.Sprintf("<Location> expects an absolute path, got %q", args))
+		}
+		scope = corazawaf.NewScope(p.options.Scope, nil, path)
+	default:
+		return p.logAndReturnErr(fmt.Sprintf("unknown block %q", l))
+	}
+
+	p.options.WAF.Scopes = append(p.options.WAF.Scopes, scope)
+	p.options.Scope = scope
+	p.blocks = append(p.blocks, name)
+	return nil
+}
+
+// defineNameRegex matches the names of the variables of Define
+var defineNameRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.]*$`)
+
+// defineRefRegex matches the references to the variables, e.g. ${NAME}
+var defineRefRegex = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_.]*)\}`)
+
+// expandDefines replaces the references to the variables in the directive by their value.
+// The references in the variables and the operator of the rules, which may have to match
+// them literally, e.g. to detect injections, are only replaced by the defined variables.
+// Elsewhere the references to the variables not defined are replaced by the environment
+// variables. The references to undefined variables are kept as is, like Apache does.
+func (p *Parser) expandDefines(l string) string {
+	if !strings.Contains(l, "${") {
+		return l
+	}
+	directive, opts := splitDirective(l)
+	switch directive {
+	case "secrule", "secrulescript":
+		actions := ruleActions(directive, opts)
+		if i := strings.LastIndex(l, actions); actions != "" && i != -1 {
+			return p.expandRefs(l[:i], false) + p.expandRefs(l[i:], true)
+		}
+		return p.expandRefs(l, false)
+	}
+	return p.expandRefs(l, true)
+}
+
+// expandRefs replaces the references to the variables in s, falling back to the
+// environment variables if env is set
+func (p *Parser) expandRefs(s string, env bool) string {
+	return defineRefRegex.ReplaceAllStringFunc(s, func(ref string) string {
+		name := ref[2 : len(ref)-1]
+		if v, ok := p.defines[name]; ok {
+			return v
+		}
+		if !env {
+			return ref
+		}
+		if v, ok := os.LookupEnv(name); ok {
+			return v
+		}
+		p.options.WAF.Logger.Warn().Str("name", name).Int("line", p.currentLine).Msg("undefined variable")
+		return ref
+	})
+}
+
+// closeBlock closes the last block, restoring the enclosing scope
+func (p *Parser) closeBlock() {
+	name := p.blocks[len(p.blocks)-1]
+	if p.skipping == len(p.blocks) {
+		p.skipping = 0
+	}
+	p.blocks = p.blocks[:len(p.blocks)-1]
+	if _, ok := blockConditions[name]; !ok && p.skipping == 0 {
+		p.options.Scope = p.options.Scope.Parent()
+	}
+}
+
+// scopeBlock returns the name of the innermost block scoping the directives, "" if none
+func (p *Parser) scopeBlock() string {
+	for i := len(p.blocks) - 1; i >= 0; i-- {
+		if _, ok := blockConditions[p.blocks[i]]; !ok {
+			return p.blocks[i]
+		}
+	}
+	return ""
+}
+
+// blockConditions are the conditions of the conditional blocks, given their argument
+var blockConditions = map[string]func(p *Parser, arg string) bool{
+	"ifdefined": func(p *Parser, name string) bool {
+		if _, ok := p.defines[name]; ok {
+			return true
+		}
+		switch name {
+		case "coraza.rule.multiphase_evaluation":
+			return corazawaf.MultiphaseEvaluation()
+		case "no_fs_access":
+			return !environment.HasAccessToFS
+		case "tinygo":
+			return runtime.Compiler == "tinygo"
+		}
+		return false
+	},
+	"ifoperator": func(_ *Parser, name string) bool {
+		return operators.Available(strings.TrimPrefix(name, "@"))
+	},
+	"ifenv": func(_ *Parser, name string) bool {
+		_, ok := os.LookupEnv(name)
+		return ok
+	},
+}
+
 func (p *Parser) logAndReturnErr(msg string) error {
 	p.options.WAF.Logger.Error().Int("line", p.currentLine).Msg(msg)
 	return errors.New(msg)
@@ -214,6 +542,27 @@ func (p *Parser) SetRoot(root fs.FS) {
 	p.root = root
 }
 
+// SetCollectErrors sets whether the parser continues after the directives failing to
+// compile. The errors are then returned by Errors instead of FromFile and FromString,
+// which only fail on the errors of the files themselves, e.g. a file not found.
+func (p *Parser) SetCollectErrors(collect bool) {
+	p.collectErrors = collect
+}
+
+// Define sets a variable, the references to it in the following directives, e.g. ${NAME},
+// are replaced by the value. It's the equivalent of the Define directive.
+func (p *Parser) Define(name, value string) {
+	if p.defines == nil {
+		p.defines = map[string]string{}
+	}
+	p.defines[name] = value
+}
+
+// Errors returns the errors of the directives collected so far, see SetCollectErrors
+func (p *Parser) Errors() []*types.ParseError {
+	return p.errors
+}
+
 // NewParser creates a new parser from a WAF instance
 // Rules and settings will be inserted into the WAF
 // rule container (RuleGroup).
@@ -239,4 +588,7 @@ type ParserConfig struct {
 	ConfigDir                   string
 	Root                        fs.FS
 	WorkingDir                  string
+	// UnicodeMap is used by the t:urlDecodeUni of the following rules,
+	// it is set by SecUnicodeMap
+	UnicodeMap *transformations.UnicodeMap
 }
@@ -6,10 +6,12 @@ package seclang
 import (
 	"bufio"
 	"embed"
+	"errors"
 	"fmt"
 	"io/fs"
 	"os"
 	"path/filepath"
+	"regexp/syntax"
 	"strings"
 	"testing"
 
@@ -18,6 +20,7 @@ import (
 
 	coreruleset "github.com/corazawaf/coraza-coreruleset"
 	coraza "github.com/corazawaf/coraza/v3/internal/corazawaf"
+	"github.com/corazawaf/coraza/v3/types"
 )
 
 //go:embed testdata
@@ -289,3 +292,339 @@ func BenchmarkParseFromString(b *testing.B) {
 		_ = parser.FromString(parsingRule)
 	}
 }
+
+func TestScopes(t *testing.T) {
+	waf := coraza.NewWAF()
+	p := NewParser(waf)
+	err := p.FromString(`
+SecRuleEngine On
+SecRule ARGS "@contains attack" "id:1,phase:1,deny,status:403"
+SecRule ARGS "@contains evil" "id:2,phase:1,deny,status:403,tag:evil"
+
+<VirtualHost api.example.com *.api.example.org:443>
+	SecRuleRemoveById 1
+	<Location /admin>
+		SecRuleEngine DetectionOnly
+	</Location>
+</VirtualHost>
+
+<Location "/upload">
+	SecRuleUpdateTargetById 2 !ARGS:file
+	SecRule ARGS:file "@contains bad" "id:10,phase:1,deny,status:406,chain"
+		SecRule REQUEST_METHOD "POST"
+	SecRequestBodyLimit 10
+</Location>
+
+<Location /legacy>
+	SecRule ARGS "@contains attack" "id:1,phase:1,deny,status:418"
+</Location>
+
+SecRule ARGS "@contains late" "id:3,phase:1,deny,status:403"
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		host       string
+		uri        string
+		method     string
+		status     int
+		ruleEngine string
+	}{
+		{"base rules", "www.example.com", "/?a=attack", "GET", 403, "On"},
+		{"rules after scopes are inherited", "api.example.com", "/?a=late", "GET", 403, "On"},
+		{"rule removed in virtual host", "api.example.com", "/?a=attack", "GET", 0, "On"},
+		{"wildcard host with port", "v1.api.example.org:443", "/?a=attack", "GET", 0, "On"},
+		{"other rules in virtual host", "api.example.com", "/?a=evil", "GET", 403, "On"},
+		{"location inherits its virtual host", "api.example.com", "/admin/users?a=attack", "GET", 0, "DetectionOnly"},
+		{"location in virtual host", "api.example.com", "/admin/users?a=evil", "GET", 0, "DetectionOnly"},
+		{"target excluded in location", "www.example.com", "/upload?file=evil", "GET", 0, "On"},
+		{"other targets in location", "www.example.com", "/upload?name=evil", "GET", 403, "On"},
+		{"chained rule in location", "www.example.com", "/upload?file=bad", "POST", 406, "On"},
+		{"chained rule not matching", "www.example.com", "/upload?file=bad", "GET", 0, "On"},
+		{"rule outside of location", "www.example.com", "/download?file=evil", "GET", 403, "On"},
+		{"rule overridden in location", "www.example.com", "/legacy?a=attack", "GET", 418, "On"},
+		{"base rules are not modified", "www.example.com", "/?file=evil", "GET", 403, "On"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tx := waf.NewTransaction()
+			defer tx.Close()
+			tx.ProcessURI(tc.uri, tc.method, "HTTP/1.1")
+			tx.SetServerName(tc.host)
+			if want, have := tc.ruleEngine, tx.RuleEngine.String(); want != have {
+				t.Errorf("unexpected rule engine, want %q, have %q", want, have)
+			}
+			it := tx.ProcessRequestHeaders()
+			status := 0
+			if it != nil {
+				status = it.Status
+			}
+			if want, have := tc.status, status; want != have {
+				t.Errorf("unexpected status, want %d, have %d", want, have)
+			}
+		})
+	}
+
+	tx := waf.NewTransaction()
+	defer tx.Close()
+	tx.ProcessURI("/upload", "POST", "HTTP/1.1")
+	if want, have := int64(10), tx.RequestBodyLimit; want != have {
+		t.Errorf("unexpected request body limit, want %d, have %d", want, have)
+	}
+}
+
+func TestConditionalBlocks(t *testing.T) {
+	t.Setenv("CORAZA_TEST_IF_ENV", "")
+	waf := coraza.NewWAF()
+	p := NewParser(waf)
+	err := p.FromString(`
+<IfOperator rx>
+	SecAction "id:1,phase:1,pass,nolog"
+	<IfOperator !@unknownOperator>
+		SecAction "id:2,phase:1,pass,nolog"
+	</IfOperator>
+</IfOperator>
+<IfOperator unknownOperator>
+	SecRule ARGS "@unknownOperator" "id:3,phase:1,deny"
+	<Location /admin>
+		SecUnknownDirective On
+	</Location>
+	Include ./testdata/nonexistent.conf
+</IfOperator>
+<IfEnv CORAZA_TEST_IF_ENV>
+	SecAction "id:4,phase:1,pass,nolog"
+</IfEnv>
+<IfEnv !CORAZA_TEST_UNSET_ENV>
+	SecAction "id:5,phase:1,pass,nolog"
+</IfEnv>
+<IfDefined UNDEFINED>
+	SecAction "id:6,phase:1,pass,nolog"
+</IfDefined>
+<IfDefined !UNDEFINED>
+	<Location /admin>
+		<IfDefined !UNDEFINED>
+			SecRequestBodyLimit 10
+		</IfDefined>
+		<IfDefined UNDEFINED>
+			SecRequestBodyLimit 20
+		</IfDefined>
+	</Location>
+	SecAction "id:7,phase:1,pass,nolog"
+</IfDefined>
+<IfDefined coraza.rule.multiphase_evaluation>
+	SecAction "id:8,phase:1,pass,nolog"
+</IfDefined>
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for id, want := range map[int]bool{1: true, 2: true, 3: false, 4: true, 5: true, 6: false, 7: true, 8: coraza.MultiphaseEvaluation()} {
+		if have := waf.Rules.FindByID(id) != nil; want != have {
+			t.Errorf("unexpected presence of rule %d, want %t, have %t", id, want, have)
+		}
+	}
+	if len(waf.Scopes) != 1 {
+		t.Fatalf("unexpected number of scopes, want 1, have %d", len(waf.Scopes))
+	}
+	tx := waf.NewTransaction()
+	defer tx.Close()
+	tx.ProcessURI("/admin", "POST", "HTTP/1.1")
+	if want, have := int64(10), tx.RequestBodyLimit; want != have {
+		t.Errorf("unexpected request body limit, want %d, have %d", want, have)
+	}
+}
+
+func TestDefines(t *testing.T) {
+	t.Setenv("CORAZA_TEST_STATUS", "406")
+	waf := coraza.NewWAF()
+	p := NewParser(waf)
+	p.Define("INCLUDES", "./testdata/includes")
+	err := p.FromString(`
+Define SUBINCLUDE "${INCLUDES}/subinclude"
+Define PREFIX /admin
+Define BLOCKING
+Include ${SUBINCLUDE}/rules1.conf
+SecRule REQUEST_URI "@beginsWith ${PREFIX}" "id:10,phase:1,deny,status:${CORAZA_TEST_STATUS}"
+SecRule REQUEST_URI "@contains ${UNDEFINED}" "id:11,phase:1,deny,status:403,t:urlDecode"
+<IfDefined BLOCKING>
+	SecRule REQUEST_URI "@contains evil" "id:12,phase:1,deny,status:401"
+</IfDefined>
+<Location ${PREFIX}/public>
+	SecRuleRemoveById 10
+</Location>
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if waf.Rules.FindByID(300) == nil {
+		t.Error("expected the rules of the included files")
+	}
+
+	tests := []struct {
+		uri    string
+		status int
+	}{
+		{"/admin", 406},
+		{"/admin/public", 0},
+		{"/${UNDEFINED}", 403},
+		{"/evil", 401},
+	}
+	for _, tc := range tests {
+		tx := waf.NewTransaction()
+		tx.ProcessURI(tc.uri, "GET", "HTTP/1.1")
+		status := 0
+		if it := tx.ProcessRequestHeaders(); it != nil {
+			status = it.Status
+		}
+		if status != tc.status {
+			t.Errorf("unexpected status for %q, want %d, have %d", tc.uri, tc.status, status)
+		}
+		_ = tx.Close()
+	}
+
+	// the environment variables are not expanded in the operators, which may detect them
+	t.Setenv("CORAZA_TEST_HOME", "/root")
+	if err := p.FromString(`SecRule ARGS:home "@contains ${CORAZA_TEST_HOME}" "id:13,phase:1,deny,status:400,msg:'${CORAZA_TEST_HOME}'"`); err != nil {
+		t.Fatal(err)
+	}
+	tx := waf.NewTransaction()
+	tx.AddGetRequestArgument("home", "${CORAZA_TEST_HOME}")
+	if it := tx.ProcessRequestHeaders(); it == nil || it.Status != 400 {
+		t.Errorf("expected the literal reference to match, got %v", it)
+	}
+	if mr := tx.MatchedRules(); len(mr) == 0 || mr[len(mr)-1].Message() != "/root" {
+		t.Errorf("expected the reference in the actions to be expanded, got %v", mr)
+	}
+	_ = tx.Close()
+
+	for _, directives := range []string{
+		"Define",
+		"Define 1NAME value",
+		"Define NA-ME value",
+		`SecAction "id:20,phase:1,deny,status:${UNDEFINED_STATUS}"`,
+	} {
+		if err := p.FromString(directives); err == nil {
+			t.Errorf("expected an error for %q", directives)
+		}
+	}
+}
+
+func TestDefinesExpandingToNothing(t *testing.T) {
+	t.Setenv("CORAZA_TEST_EMPTY", "")
+	tests := map[string]string{
+		"empty":       "Define EMPTY \"\"\n${EMPTY}",
+		"empty env":   "${CORAZA_TEST_EMPTY}",
+		"comment":     "Define COMMENT #x\n${COMMENT}",
+		"whitespaces": "Define BLANK \"   \"\n${BLANK}",
+	}
+	for name, directives := range tests {
+		t.Run(name, func(t *testing.T) {
+			waf := coraza.NewWAF()
+			if err := NewParser(waf).FromString(directives + "\nSecRuleEngine DetectionOnly"); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if waf.RuleEngine != types.RuleEngineDetectionOnly {
+				t.Error("expected the following directives to be evaluated")
+			}
+		})
+	}
+}
+
+func TestScopeErrors(t *testing.T) {
+	tests := map[string]string{
+		"unclosed block":           "<Location /admin>\nSecRuleEngine Off",
+		"unexpected closing":       "</Location>",
+		"mismatched closing":       "<VirtualHost example.com>\n</Location>",
+		"nested virtual hosts":     "<VirtualHost a.com>\n<VirtualHost b.com>",
+		"nested locations":         "<Location /a>\n<Location /a/b>",
+		"relative location":        "<Location admin>",
+		"virtual host no hosts":    "<VirtualHost>",
+		"unknown block":            "<Directory /var/www>",
+		"malformed block":          "<Location /admin",
+		"unsupported directive":    "<Location /admin>\nSecAuditEngine On\n</Location>",
+		"invalid body limit":       "<Location /admin>\nSecRequestBodyLimit 0\n</Location>",
+		"duplicated id in scope":   "<Location /admin>\nSecAction \"id:1\"\nSecAction \"id:1\"\n</Location>",
+		"invalid engine in scope":  "<Location /admin>\nSecRuleEngine Maybe\n</Location>",
+		"condition no argument":    "<IfDefined>\n</IfDefined>",
+		"condition two arguments":  "<IfEnv A B>\n</IfEnv>",
+		"unclosed condition":       "<IfEnv !A>\nSecRuleEngine Off",
+		"unclosed skipped block":   "<IfEnv A_NOT_SET>\n<Location /admin>\n</IfEnv>",
+		"nested hosts condition":   "<VirtualHost a.com>\n<IfEnv !A_NOT_SET>\n<VirtualHost b.com>",
+		"error in met condition":   "<IfOperator rx>\nSecUnknownDirective On\n</IfOperator>",
+		"unknown rule in host":     "<VirtualHost a.com>\nSecRuleUpdateTargetById 999 \"!ARGS:x\"\n</VirtualHost>",
+		"unknown rule in location": "<VirtualHost a.com>\n<Location /a>\nSecRuleUpdateTargetById 999 \"!ARGS:x\"\n</Location>\n</VirtualHost>",
+	}
+	for name, directives := range tests {
+		t.Run(name, func(t *testing.T) {
+			if err := NewParser(coraza.NewWAF()).FromString(directives); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestParseErrorPosition(t *testing.T) {
+	err := NewParser(coraza.NewWAF()).FromFile("./testdata/errors/main.conf")
+	var pe *types.ParseError
+	if !errors.As(err, &pe) {
+		t.Fatalf("expected a parse error, got %v", err)
+	}
+	want := types.ParseError{File: "testdata/errors/rules.conf", Line: 2, Column: 5, Directive: "secrule", RuleID: 1}
+	if pe.File != want.File || pe.Line != want.Line || pe.Column != want.Column || pe.Directive != want.Directive || pe.RuleID != want.RuleID {
+		t.Errorf("unexpected position, want %+v, have %+v", want, *pe)
+	}
+	if want := "testdata/errors/rules.conf:2:5: rule 1: failed to compile the directive"; !strings.HasPrefix(err.Error(), want) {
+		t.Errorf("unexpected error, want prefix %q, have %q", want, err.Error())
+	}
+}
+
+func TestParseErrorCollection(t *testing.T) {
+	p := NewParser(coraza.NewWAF())
+	p.SetCollectErrors(true)
+	if err := p.FromFile("./testdata/errors/main.conf"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := p.FromString("SecRuleEngine On\n<Location /admin>\nSecDataset test `\nvalue"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []string{
+		"testdata/errors/rules.conf:2:5 secrule 1",
+		"testdata/errors/rules.conf:4:1 secaction 2",
+		"testdata/errors/main.conf:4:3 secunknowndirective 0",
+		"testdata/errors/main.conf:5:1 secrule 3",
+		"_inline_:3:1 secdataset 0",
+		"_inline_:4:1  0",
+	}
+	var have []string
+	for _, pe := range p.Errors() {
+		have = append(have, fmt.Sprintf("%s:%d:%d %s %d", pe.File, pe.Line, pe.Column, pe.Directive, pe.RuleID))
+	}
+	if strings.Join(have, "\n") != strings.Join(want, "\n") {
+		t.Errorf("unexpected errors\nwant:\n%s\nhave:\n%s", strings.Join(want, "\n"), strings.Join(have, "\n"))
+	}
+
+	var rxErr *syntax.Error
+	if !errors.As(p.Errors()[3], &rxErr) {
+		t.Errorf("expected a regex error, got %v", p.Errors()[3])
+	}
+}
+
+func TestParseErrorPositionFromStrings(t *testing.T) {
+	p := NewParser(coraza.NewWAF())
+	if err := p.FromString("SecRuleEngine On\nSecRequestBodyAccess On"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	err := p.FromString("SecUnknownDirective On")
+	var pe *types.ParseError
+	if !errors.As(err, &pe) {
+		t.Fatalf("expected a parse error, got %v", err)
+	}
+	if want, have := "_inline_:1:1", fmt.Sprintf("%s:%d:%d", pe.File, pe.Line, pe.Column); want != have {
+		t.Errorf("unexpected position, want %q, have %q", want, have)
+	}
+}
@@ -13,6 +13,7 @@ import (
 	"github.com/corazawaf/coraza/v3/internal/corazawaf"
 	"github.com/corazawaf/coraza/v3/internal/operators"
 	utils "github.com/corazawaf/coraza/v3/internal/strings"
+	"github.com/corazawaf/coraza/v3/internal/transformations"
 	"github.com/corazawaf/coraza/v3/types"
 	"github.com/corazawaf/coraza/v3/types/variables"
 )
@@ -195,6 +196,12 @@ func (rp *RuleParser) ParseOperator(operator string) error {
 		Datasets: rp.options.Datasets,
 	}
 
+	if w := rp.options.WAF; w != nil {
+		opts.RBLTimeout = w.RBLTimeout
+		opts.HTTPBLKey = w.HTTPBLKey
+		opts.InspectFileTimeout = w.InspectFileTimeout
+	}
+
 	if wd := rp.options.ParserConfig.WorkingDir; wd != "" {
 		opts.Path = append(opts.Path, wd)
 	}
@@ -290,7 +297,13 @@ func (rp *RuleParser) ParseActions(actions string) error {
 		if action.Atype == plugintypes.ActionTypeMetadata {
 			continue
 		}
-		if err := action.F.Init(rp.rule, action.Value); err != nil {
+		if m := rp.options.ParserConfig.UnicodeMap; m != nil && action.Key == "t" && strings.EqualFold(action.Value, "urlDecodeUni") {
+			// urlDecodeUni is bound to the code page loaded by SecUnicodeMap, the transformation
+			// name includes the code page so that it is cached apart from the default one.
+			if err := rp.rule.AddTransformation(action.Value+":"+m.Name(), transformations.NewURLDecodeUni(m)); err != nil {
+				return err
+			}
+		} else if err := action.F.Init(rp.rule, action.Value); err != nil {
 			return err
 		}
 		if err := rp.rule.AddAction(action.Key, action.F); err != nil {
@@ -314,6 +327,9 @@ type RuleOptions struct {
 	Directive    string
 	Data         string
 	Datasets     map[string][]string
+	// Scope is the configuration scope of the rule, its chained rules are attached
+	// to the last rule of the scope.
+	Scope *corazawaf.Scope
 }
 
 // ParseRule parses a rule from a string
@@ -385,7 +401,11 @@ func ParseRule(options RuleOptions) (*corazawaf.Rule, error) {
 	rule.File_ = options.ParserConfig.ConfigFile
 	rule.Line_ = options.ParserConfig.LastLine
 
-	if parent := getLastRuleExpectingChain(options.WAF); parent != nil {
+	rules := &options.WAF.Rules
+	if options.Scope != nil {
+		rules = options.Scope.Rules()
+	}
+	if parent := getLastRuleExpectingChain(rules); parent != nil {
 		rule.ParentID_ = parent.ID_
 		// While the ID_ will be kept to 0 being a chain rule, the LogID_ is meant to be
 		// the printable ID that represents the chain rule, therefore the parent's ID is inherited.
@@ -461,8 +481,8 @@ func cutQuotedString(s string) (string, string, error) {
 	return "", "", fmt.Errorf("expected terminating quote: %q", s)
 }
 
-func getLastRuleExpectingChain(w *corazawaf.WAF) *corazawaf.Rule {
-	rules := w.Rules.GetRules()
+func getLastRuleExpectingChain(rg *corazawaf.RuleGroup) *corazawaf.Rule {
+	rules := rg.GetRules()
 	if len(rules) == 0 {
 		return nil
 	}
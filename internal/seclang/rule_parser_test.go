@@ -10,6 +10,7 @@ import (
 	"testing"
 
 	"github.com/corazawaf/coraza/v3/internal/corazawaf"
+	"github.com/corazawaf/coraza/v3/types"
 )
 
 func TestInvalidRule(t *testing.T) {
@@ -95,6 +96,16 @@ func TestSecRuleInlineVariableNegation(t *testing.T) {
 	}
 }
 
+// directiveCause returns the cause of the error of the directive failing to compile
+func directiveCause(t *testing.T, err error) error {
+	t.Helper()
+	var pe *types.ParseError
+	if !errors.As(err, &pe) {
+		t.Fatalf("expected a parse error, got %v", err)
+	}
+	return errors.Unwrap(pe.Err)
+}
+
 func TestSecRuleUpdateTargetVariableNegation(t *testing.T) {
 	waf := corazawaf.NewWAF()
 	p := NewParser(waf)
@@ -112,8 +123,8 @@ func TestSecRuleUpdateTargetVariableNegation(t *testing.T) {
 		SecRuleUpdateTargetById 8 "!REQUEST_HEADERS:"
 	`)
 	expectedErr := errors.New("unknown variable")
-	if errors.Unwrap(err).Error() != expectedErr.Error() {
-		t.Fatalf("unexpexted error, want %q, have %q", expectedErr, errors.Unwrap(err).Error())
+	if have := directiveCause(t, err); have.Error() != expectedErr.Error() {
+		t.Fatalf("unexpexted error, want %q, have %q", expectedErr, have.Error())
 	}
 
 	// Try to update undefined rule
@@ -122,8 +133,8 @@ func TestSecRuleUpdateTargetVariableNegation(t *testing.T) {
 		SecRuleUpdateTargetById 99 "!REQUEST_HEADERS:xyz"
 	`)
 	expectedErr = errors.New("SecRuleUpdateTargetById: rule \"99\" not found")
-	if errors.Unwrap(err).Error() != expectedErr.Error() {
-		t.Fatalf("unexpected error, want %q, have %q", expectedErr, errors.Unwrap(err).Error())
+	if have := directiveCause(t, err); have.Error() != expectedErr.Error() {
+		t.Fatalf("unexpected error, want %q, have %q", expectedErr, have.Error())
 	}
 }
 
@@ -1032,3 +1032,44 @@ BINARYDATA
 		t.Error("failed test for rx captured")
 	}
 }
+
+func TestMacroExpressionsInActions(t *testing.T) {
+	waf := corazawaf.NewWAF()
+	var logs []string
+	waf.SetErrorCallback(func(mr types.MatchedRule) {
+		logs = append(logs, mr.ErrorLog())
+	})
+	parser := NewParser(waf)
+	err := parser.FromString(`
+	SecRule &ARGS_GET "@gt 1" "id:1, phase:1, log, pass, msg:'%{&ARGS_GET} args', logdata:'%{join(ARGS_GET_NAMES, \'|\')}', setvar:'tx.user_hash=%{sha1(lower(ARGS_GET.user))}'"
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := waf.NewTransaction()
+	tx.AddGetRequestArgument("user", "ADMIN")
+	tx.AddGetRequestArgument("id", "1")
+	tx.ProcessRequestHeaders()
+	if len(logs) != 1 {
+		t.Fatalf("failed to log. Expected 1 entry, got %d", len(logs))
+	}
+	for _, want := range []string{`[msg "2 args"]`, `[data "id|user"]`} {
+		if !strings.Contains(logs[0], want) {
+			t.Errorf("expected %q in %q", want, logs[0])
+		}
+	}
+	if want, have := "d033e22ae348aeb5660fc2140aec35850c4da997", tx.Variables().TX().Get("user_hash"); len(have) != 1 || want != have[0] {
+		t.Errorf("unexpected tx.user_hash, want %q, have %v", want, have)
+	}
+
+	for _, rule := range []string{
+		`SecAction "id:2, msg:'%{lower(tx.a}'"`,
+		`SecAction "id:3, logdata:'%{unknown(tx.a)}'"`,
+		`SecAction "id:4, setvar:'tx.a=%{ARGS:/[/}'"`,
+		`SecAction "id:5, initcol:'ip=%{sha256(NOPE)}'"`,
+	} {
+		if err := NewParser(corazawaf.NewWAF()).FromString(rule); err == nil {
+			t.Errorf("expected error for %s", rule)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+//go:generate go run generator/main.go
+
+package transformations
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// confusablesSkeleton replaces the characters looking like ASCII characters by them,
+// following the Unicode TR39 skeleton algorithm, e.g. "ѕеlеct" (using cyrillic letters)
+// into "select". Unlike the TR39 skeleton, ASCII characters are never replaced, so that
+// ASCII input is left untouched and can be matched by the existing patterns. The
+// prototypes are those of TR39 though, for example the look-alikes of "I" become "l".
+// Invalid UTF-8 sequences are kept as is.
+func confusablesSkeleton(data string) (string, bool, error) {
+	if isASCII(data) {
+		return data, false, nil
+	}
+
+	decomposed := norm.NFD.String(data)
+	var res strings.Builder
+	res.Grow(len(decomposed))
+	for i := 0; i < len(decomposed); {
+		r, size := utf8.DecodeRuneInString(decomposed[i:])
+		if prototype, ok := confusables[r]; ok && size > 1 {
+			res.WriteString(prototype)
+		} else {
+			res.WriteString(decomposed[i : i+size])
+		}
+		i += size
+	}
+
+	transformedData := norm.NFC.String(res.String())
+	return transformedData, transformedData != data, nil
+}
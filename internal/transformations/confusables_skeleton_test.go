@@ -0,0 +1,39 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package transformations
+
+import "testing"
+
+func TestConfusablesSkeleton(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{input: "", want: ""},
+		{input: "admin", want: "admin"},
+		{input: "I", want: "I"},
+		{input: "аdmin", want: "admin"},
+		{input: "ѕеlеct", want: "select"},
+		{input: "ΟR 1=1", want: "OR 1=1"},
+		{input: "‹script›", want: "<script>"},
+		{input: "日本", want: "日本"},
+		{input: "\xffа", want: "\xffa"},
+	}
+
+	for _, tc := range tests {
+		tt := tc
+		t.Run(tt.input, func(t *testing.T) {
+			have, changed, err := confusablesSkeleton(tt.input)
+			if err != nil {
+				t.Error(err)
+			}
+			if tt.input == tt.want && changed || tt.input != tt.want && !changed {
+				t.Errorf("input %q, have %q with changed %t", tt.input, have, changed)
+			}
+			if have != tt.want {
+				t.Errorf("have %q, want %q", have, tt.want)
+			}
+		})
+	}
+}
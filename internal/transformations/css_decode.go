@@ -11,8 +11,8 @@ import (
 
 func cssDecode(data string) (string, bool, error) {
 	if i := strings.IndexByte(data, '\\'); i != -1 {
-		// TODO: This will transform even if the backslash isn't followed by hex,
-		// but keep it simple for now.
+		// The backslash is always consumed, either with the escape it starts, as a
+		// line continuation or as an escape of the next character.
 		return cssDecodeInplace(data, i), true, nil
 	}
 	return data, false, nil
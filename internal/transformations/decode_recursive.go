@@ -0,0 +1,111 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package transformations
+
+import (
+	"encoding/base64"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	utils "github.com/corazawaf/coraza/v3/internal/strings"
+)
+
+// maxDecodeLayers is the maximum number of encoding layers peeled by decodeRecursive
+const maxDecodeLayers = 8
+
+// layerDecoders are tried in order, only the first one decoding the input is
+// applied on every layer.
+var layerDecoders = []func(string) (string, bool){
+	decodeURLLayer,
+	decodeHTMLLayer,
+	decodeJSONLayer,
+	decodeBase64Layer,
+}
+
+// decodeRecursive peels URL, HTML entity, JSON and base64 encodings until the
+// value can't be decoded anymore, or up to maxDecodeLayers layers.
+func decodeRecursive(data string) (string, bool, error) {
+	transformedData, layers := doDecodeRecursive(data)
+	return transformedData, layers > 0, nil
+}
+
+// decodeRecursiveLayers replaces the value by the number of layers peeled by
+// decodeRecursive, so that rules can score deeply nested encodings, e.g.
+// SecRule ARGS "@ge 3" "t:decodeRecursiveLayers,..."
+// It reports a change only if a layer was peeled.
+func decodeRecursiveLayers(data string) (string, bool, error) {
+	_, layers := doDecodeRecursive(data)
+	return strconv.Itoa(layers), layers > 0, nil
+}
+
+func doDecodeRecursive(data string) (string, int) {
+	layers := 0
+	for layers < maxDecodeLayers {
+		decoded := false
+		for _, decode := range layerDecoders {
+			if v, ok := decode(data); ok {
+				data = v
+				decoded = true
+				break
+			}
+		}
+		if !decoded {
+			break
+		}
+		layers++
+	}
+	return data, layers
+}
+
+// decodeURLLayer only decodes values holding at least a valid %XX sequence, a
+// single + is not considered an encoding.
+func decodeURLLayer(data string) (string, bool) {
+	for i := 0; i+2 < len(data); i++ {
+		if data[i] == '%' && utils.ValidHex(data[i+1]) && utils.ValidHex(data[i+2]) {
+			v, _, _ := urlDecode(data)
+			return v, true
+		}
+	}
+	return data, false
+}
+
+func decodeHTMLLayer(data string) (string, bool) {
+	if strings.IndexByte(data, '&') == -1 {
+		return data, false
+	}
+	v, changed, _ := htmlEntityDecode(data)
+	return v, changed
+}
+
+func decodeJSONLayer(data string) (string, bool) {
+	v, changed, _ := jsonUnescape(data)
+	return v, changed
+}
+
+// decodeBase64Layer only decodes values made of base64 characters whose decoding
+// is printable UTF-8 text, as most values would be valid base64 otherwise.
+func decodeBase64Layer(data string) (string, bool) {
+	if len(data) < 4 {
+		return data, false
+	}
+
+	enc := base64.StdEncoding
+	if strings.ContainsAny(data, "-_") {
+		enc = base64.URLEncoding
+	}
+	if !strings.HasSuffix(data, "=") && len(data)%4 != 0 {
+		enc = enc.WithPadding(base64.NoPadding)
+	}
+	decoded, err := enc.DecodeString(data)
+	if err != nil || len(decoded) == 0 || !utf8.Valid(decoded) {
+		return data, false
+	}
+	for _, c := range decoded {
+		if c < 0x20 && c != '\t' && c != '\n' && c != '\r' || c == 0x7f {
+			return data, false
+		}
+	}
+	return string(decoded), true
+}
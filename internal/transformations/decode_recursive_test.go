@@ -0,0 +1,56 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package transformations
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDecodeRecursive(t *testing.T) {
+	tests := []struct {
+		input  string
+		want   string
+		layers string
+	}{
+		{"", "", "0"},
+		{"admin", "admin", "0"},
+		{"a+b", "a+b", "0"},
+		{"test", "test", "0"},
+		{"%3Cscript%3E", "<script>", "1"},
+		{"%253Cscript%253E", "<script>", "2"},
+		{"&amp;lt;script&amp;gt;", "<script>", "2"},
+		{`{"q":"\u0027 OR 1=1"}`, `{"q":"' OR 1=1"}`, "1"},
+		{"JTI3IE9SIDE9MQ==", "' OR 1=1", "2"},
+		{"JTI3IE9SIDE9MQ", "' OR 1=1", "2"},
+		{"%" + strings.Repeat("25", 9) + "41", "%2541", "8"},
+	}
+
+	for _, tc := range tests {
+		tt := tc
+		t.Run(tt.input, func(t *testing.T) {
+			have, changed, err := decodeRecursive(tt.input)
+			if err != nil {
+				t.Error(err)
+			}
+			if tt.input == tt.want && changed || tt.input != tt.want && !changed {
+				t.Errorf("input %q, have %q with changed %t", tt.input, have, changed)
+			}
+			if have != tt.want {
+				t.Errorf("have %q, want %q", have, tt.want)
+			}
+
+			layers, changed, err := decodeRecursiveLayers(tt.input)
+			if err != nil {
+				t.Error(err)
+			}
+			if layers != tt.layers {
+				t.Errorf("have %s layers, want %s", layers, tt.layers)
+			}
+			if want := tt.layers != "0"; changed != want {
+				t.Errorf("have %s layers with changed %t", layers, changed)
+			}
+		})
+	}
+}
@@ -12,10 +12,11 @@ import (
 
 func escapeSeqDecode(input string) (string, bool, error) {
 	if i := strings.IndexByte(input, '\\'); i != -1 {
-		// TODO: This will transform even if the backslash isn't followed by an escape,
-		// but keep it simple for now.
 		transformedInput, changed := doEscapeSeqDecode(input, i)
-		return transformedInput, changed, nil
+		if !changed {
+			return input, false, nil
+		}
+		return transformedInput, true, nil
 	}
 	return input, false, nil
 }
@@ -85,7 +86,8 @@ func doEscapeSeqDecode(input string, pos int) (string, bool) {
 					j += 1
 				}
 
-				bc, _ := strconv.ParseUint(input[i+1:i+j], 8, 8)
+				// Values over \377 are truncated to their lower byte, as ModSecurity does
+				bc, _ := strconv.ParseUint(input[i+1:i+j], 8, 16)
 				data[d] = byte(bc)
 				d += 1
 				i += j
@@ -97,6 +99,7 @@ func doEscapeSeqDecode(input string, pos int) (string, bool) {
 			data[d] = input[i+1]
 			d++
 			i += 2
+			changed = true
 		} else {
 			/* Input character not a backslash, copy it. */
 			data[d] = input[i]
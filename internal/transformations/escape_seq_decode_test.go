@@ -26,6 +26,18 @@ func TestEscapeSeqDecode(t *testing.T) {
 			input: "\\\\u0000",
 			want:  "\\u0000",
 		},
+		{
+			input: "\\8\\9",
+			want:  "89",
+		},
+		{
+			input: "\\666\\0123",
+			want:  "\xb6\n3",
+		},
+		{
+			input: "\\xag",
+			want:  "xag",
+		},
 		{
 			input: "\\a\\b\\f\\n\\r\\t\\v\\u0000\\?\\'\\\"\\0\\12\\123\\x00\\xff",
 			want:  "\a\b\f\n\r\t\vu0000?'\"\x00\nS\x00\xff",
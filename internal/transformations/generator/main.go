@@ -0,0 +1,127 @@
+// Copyright 2023 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+// generator builds the table of confusables used by t:confusablesSkeleton from the
+// Unicode TR39 confusables.txt data file.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const confusablesVersion = "13.0.0"
+
+func main() {
+	input := flag.String("input", "https://www.unicode.org/Public/security/"+confusablesVersion+"/confusables.txt",
+		"path or URL of the confusables.txt file")
+	output := flag.String("output", "./confusables.gen.go", "path of the generated file")
+	flag.Parse()
+
+	data, err := read(*input)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	table, err := parse(data)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	src, err := generate(table)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := os.WriteFile(*output, src, 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func read(input string) ([]byte, error) {
+	if !strings.HasPrefix(input, "https://") {
+		return os.ReadFile(input)
+	}
+
+	res, err := http.Get(input)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d", res.StatusCode)
+	}
+	return io.ReadAll(res.Body)
+}
+
+// parse reads the mappings of non ASCII characters whose prototype is made of ASCII
+// characters only. ASCII characters are kept out of the table so that the skeleton of
+// ASCII text is the text itself.
+func parse(data []byte) (map[rune]string, error) {
+	table := map[rune]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		fields := strings.Split(line, ";")
+		if len(fields) < 2 {
+			continue
+		}
+
+		source, err := strconv.ParseUint(strings.TrimSpace(fields[0]), 16, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid source %q: %v", fields[0], err)
+		}
+		if source < 0x80 {
+			continue
+		}
+
+		var target strings.Builder
+		ascii := true
+		for _, cp := range strings.Fields(fields[1]) {
+			r, err := strconv.ParseUint(cp, 16, 32)
+			if err != nil {
+				return nil, fmt.Errorf("invalid target %q: %v", fields[1], err)
+			}
+			if r >= 0x80 {
+				ascii = false
+				break
+			}
+			target.WriteByte(byte(r))
+		}
+		if ascii {
+			table[rune(source)] = target.String()
+		}
+	}
+	return table, scanner.Err()
+}
+
+func generate(table map[rune]string) ([]byte, error) {
+	keys := make([]rune, 0, len(table))
+	for k := range table {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+
+	b := &bytes.Buffer{}
+	b.WriteString("// Copyright 2023 Juan Pablo Tosso and the OWASP Coraza contributors\n")
+	b.WriteString("// SPDX-License-Identifier: Apache-2.0\n\n")
+	b.WriteString("// Code generated by internal/transformations/generator DO NOT EDIT.\n\n")
+	b.WriteString("package transformations\n\n")
+	fmt.Fprintf(b, "// confusables maps non ASCII characters to their ASCII prototype as defined by\n// the Unicode %s TR39 confusables data\n", confusablesVersion)
+	b.WriteString("var confusables = map[rune]string{\n")
+	for _, k := range keys {
+		fmt.Fprintf(b, "\t0x%04X: %q,\n", k, table[k])
+	}
+	b.WriteString("}\n")
+	return format.Source(b.Bytes())
+}
@@ -12,10 +12,11 @@ import (
 
 func jsDecode(data string) (string, bool, error) {
 	if i := strings.IndexByte(data, '\\'); i != -1 {
-		// TODO: This will transform even if the backslash isn't followed by an escape,
-		// but keep it simple for now.
 		transformedData, changed := doJsDecode(data, i)
-		return transformedData, changed, nil
+		if !changed {
+			return data, false, nil
+		}
+		return transformedData, true, nil
 	}
 	return data, false, nil
 }
@@ -62,26 +63,24 @@ func doJsDecode(input string, pos int) (string, bool) {
 				j := 0
 
 				for (i+1+j < inputLen) && (j < 3) {
-					buf[j] = input[i+j]
+					buf[j] = input[i+1+j]
 					j++
-					if !isodigit(input[i+j]) {
+					if i+1+j >= inputLen || !isodigit(input[i+1+j]) {
 						break
 					}
 				}
 				buf = buf[:j]
 
-				if j > 0 {
-					/* Do not use 3 characters if we will be > 1 byte */
-					if (j == 3) && (buf[0] > '3') {
-						j = 2
-						buf = buf[:j]
-					}
-					nn, _ := strconv.ParseInt(string(buf), 8, 8)
-					d[c] = byte(nn)
-					changed = true
-					c++
-					i += 1 + j
+				/* Do not use 3 characters if we will be > 1 byte */
+				if (j == 3) && (buf[0] > '3') {
+					j = 2
+					buf = buf[:j]
 				}
+				nn, _ := strconv.ParseUint(string(buf), 8, 8)
+				d[c] = byte(nn)
+				changed = true
+				c++
+				i += 1 + j
 			case i+1 < inputLen:
 				/* \C */
 				cc := input[i+1]
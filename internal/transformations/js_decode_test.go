@@ -26,6 +26,18 @@ func TestCJSDecode(t *testing.T) {
 			input: "\\",
 			want:  "\\",
 		},
+		{
+			input: "\\0\\12\\123\\377\\400",
+			want:  "\x00\nS\xff 0",
+		},
+		{
+			input: "\\u0041\\uff41\\x41\\X41",
+			want:  "AaAX41",
+		},
+		{
+			input: "\\q",
+			want:  "q",
+		},
 	}
 
 	for _, tc := range tests {
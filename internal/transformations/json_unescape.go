@@ -0,0 +1,99 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package transformations
+
+import (
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	utils "github.com/corazawaf/coraza/v3/internal/strings"
+)
+
+// jsonUnescape decodes the escape sequences of a JSON string, e.g. \" or é.
+// Surrogate pairs are combined, lone surrogates are decoded as the replacement
+// character. Invalid escapes are kept as is.
+func jsonUnescape(data string) (string, bool, error) {
+	i := strings.IndexByte(data, '\\')
+	if i == -1 {
+		return data, false, nil
+	}
+
+	var res strings.Builder
+	res.Grow(len(data))
+	res.WriteString(data[:i])
+	changed := false
+	for i < len(data) {
+		if data[i] != '\\' || i+1 == len(data) {
+			res.WriteByte(data[i])
+			i++
+			continue
+		}
+
+		var c byte
+		switch data[i+1] {
+		case '"', '\\', '/':
+			c = data[i+1]
+		case 'b':
+			c = '\b'
+		case 'f':
+			c = '\f'
+		case 'n':
+			c = '\n'
+		case 'r':
+			c = '\r'
+		case 't':
+			c = '\t'
+		case 'u':
+			r, ok := decodeJSONHex(data[i+2:])
+			if !ok {
+				res.WriteByte(data[i])
+				i++
+				continue
+			}
+			i += 6
+			if utf16.IsSurrogate(r) {
+				r2, ok := rune(0), false
+				if i+1 < len(data) && data[i] == '\\' && data[i+1] == 'u' {
+					r2, ok = decodeJSONHex(data[i+2:])
+				}
+				if dec := utf16.DecodeRune(r, r2); ok && dec != utf8.RuneError {
+					r = dec
+					i += 6
+				} else {
+					r = utf8.RuneError
+				}
+			}
+			res.WriteRune(r)
+			changed = true
+			continue
+		default:
+			res.WriteByte(data[i])
+			i++
+			continue
+		}
+		res.WriteByte(c)
+		changed = true
+		i += 2
+	}
+
+	if !changed {
+		return data, false, nil
+	}
+	return res.String(), true, nil
+}
+
+func decodeJSONHex(s string) (rune, bool) {
+	if len(s) < 4 {
+		return 0, false
+	}
+	var r rune
+	for i := 0; i < 4; i++ {
+		if !utils.ValidHex(s[i]) {
+			return 0, false
+		}
+		r = r<<4 | rune(xsingle2c(s[i]))
+	}
+	return r, true
+}
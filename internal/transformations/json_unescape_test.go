@@ -0,0 +1,38 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package transformations
+
+import "testing"
+
+func TestJSONUnescape(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{input: "", want: ""},
+		{input: "TestCase", want: "TestCase"},
+		{input: `\"\\\/\b\f\n\r\t`, want: "\"\\/\b\f\n\r\t"},
+		{input: `\u003cscript\u003E`, want: "<script>"},
+		{input: `\u00e9\ud83d\ude00`, want: "é😀"},
+		{input: `\ud83dA`, want: "�A"},
+		{input: `\ud83d`, want: "�"},
+		{input: `\x41\u12\`, want: `\x41\u12\`},
+	}
+
+	for _, tc := range tests {
+		tt := tc
+		t.Run(tt.input, func(t *testing.T) {
+			have, changed, err := jsonUnescape(tt.input)
+			if err != nil {
+				t.Error(err)
+			}
+			if tt.input == tt.want && changed || tt.input != tt.want && !changed {
+				t.Errorf("input %q, have %q with changed %t", tt.input, have, changed)
+			}
+			if have != tt.want {
+				t.Errorf("have %q, want %q", have, tt.want)
+			}
+		})
+	}
+}
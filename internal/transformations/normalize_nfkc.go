@@ -0,0 +1,19 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package transformations
+
+import (
+	"golang.org/x/text/unicode/norm"
+)
+
+// normalizeNFKC applies the Unicode compatibility composition, which folds full width,
+// ligatures, super and subscripts and other compatibility characters into their
+// canonical equivalent, e.g. "ｓｅｌｅｃｔ" into "select".
+func normalizeNFKC(data string) (string, bool, error) {
+	if norm.NFKC.IsNormalString(data) {
+		return data, false, nil
+	}
+	transformedData := norm.NFKC.String(data)
+	return transformedData, transformedData != data, nil
+}
@@ -0,0 +1,58 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package transformations
+
+import (
+	"math/bits"
+
+	utils "github.com/corazawaf/coraza/v3/internal/strings"
+)
+
+// parityEven7bit sets the high bit of every byte so that it has an even number of bits set.
+// As ModSecurity does, the parity is calculated over the eight bits of the input byte.
+func parityEven7bit(data string) (string, bool, error) {
+	return parity7bit(data, func(b byte) byte {
+		if bits.OnesCount8(b)%2 == 1 {
+			return b | 0x80
+		}
+		return b & 0x7f
+	})
+}
+
+// parityOdd7bit sets the high bit of every byte so that it has an odd number of bits set.
+// As ModSecurity does, the parity is calculated over the eight bits of the input byte.
+func parityOdd7bit(data string) (string, bool, error) {
+	return parity7bit(data, func(b byte) byte {
+		if bits.OnesCount8(b)%2 == 1 {
+			return b & 0x7f
+		}
+		return b | 0x80
+	})
+}
+
+// parityZero7bit clears the high bit of every byte.
+func parityZero7bit(data string) (string, bool, error) {
+	return parity7bit(data, func(b byte) byte {
+		return b & 0x7f
+	})
+}
+
+func parity7bit(data string, fn func(byte) byte) (string, bool, error) {
+	var d []byte
+	for i := 0; i < len(data); i++ {
+		b := fn(data[i])
+		if b == data[i] && d == nil {
+			continue
+		}
+		if d == nil {
+			d = []byte(data)
+		}
+		d[i] = b
+	}
+
+	if d == nil {
+		return data, false, nil
+	}
+	return utils.WrapUnsafe(d), true, nil
+}
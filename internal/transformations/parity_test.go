@@ -0,0 +1,44 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package transformations
+
+import (
+	"testing"
+
+	"github.com/corazawaf/coraza/v3/experimental/plugins/plugintypes"
+)
+
+func TestParity7bit(t *testing.T) {
+	tests := []struct {
+		name  string
+		trans plugintypes.Transformation
+		input string
+		want  string
+	}{
+		{"even", parityEven7bit, "", ""},
+		{"even", parityEven7bit, "c0", "c0"},
+		{"even", parityEven7bit, "ab\x00", "\xe1\xe2\x00"},
+		{"even", parityEven7bit, "\xe1", "a"},
+		{"odd", parityOdd7bit, "ab", "ab"},
+		{"odd", parityOdd7bit, "c\x00", "\xe3\x80"},
+		{"zero", parityZero7bit, "abc", "abc"},
+		{"zero", parityZero7bit, "\xe1\xff", "a\x7f"},
+	}
+
+	for _, tc := range tests {
+		tt := tc
+		t.Run(tt.name+tt.input, func(t *testing.T) {
+			have, changed, err := tt.trans(tt.input)
+			if err != nil {
+				t.Error(err)
+			}
+			if tt.input == tt.want && changed || tt.input != tt.want && !changed {
+				t.Errorf("input %q, have %q with changed %t", tt.input, have, changed)
+			}
+			if have != tt.want {
+				t.Errorf("have %q, want %q", have, tt.want)
+			}
+		})
+	}
+}
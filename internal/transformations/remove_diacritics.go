@@ -0,0 +1,44 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package transformations
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// removeDiacritics removes the combining marks of the input, e.g. "sélèct" into "select".
+// The input is decomposed, the nonspacing marks are removed and the remaining characters
+// are composed again. Invalid UTF-8 sequences are kept as is.
+func removeDiacritics(data string) (string, bool, error) {
+	if isASCII(data) {
+		return data, false, nil
+	}
+
+	decomposed := norm.NFD.String(data)
+	var res strings.Builder
+	res.Grow(len(decomposed))
+	for i := 0; i < len(decomposed); {
+		r, size := utf8.DecodeRuneInString(decomposed[i:])
+		if !unicode.Is(unicode.Mn, r) {
+			res.WriteString(decomposed[i : i+size])
+		}
+		i += size
+	}
+
+	transformedData := norm.NFC.String(res.String())
+	return transformedData, transformedData != data, nil
+}
+
+func isASCII(data string) bool {
+	for i := 0; i < len(data); i++ {
+		if data[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,48 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package transformations
+
+import (
+	"strings"
+
+	utils "github.com/corazawaf/coraza/v3/internal/strings"
+)
+
+// sqlHexDecode decodes the SQL hex literals of the input, e.g. 0x414243 into ABC.
+// Literals not followed by at least a pair of hexadecimal characters are kept as is,
+// a trailing odd character is copied after the decoded bytes.
+// https://github.com/owasp-modsecurity/ModSecurity/blob/v3/master/src/actions/transformations/sql_hex_decode.cc
+func sqlHexDecode(data string) (string, bool, error) {
+	i := strings.IndexByte(data, '0')
+	if i == -1 {
+		return data, false, nil
+	}
+
+	d := []byte(data)
+	inputLen := len(data)
+	changed := false
+	c := i
+
+	for i < inputLen {
+		if data[i] == '0' && i+3 < inputLen && (data[i+1] == 'x' || data[i+1] == 'X') &&
+			utils.ValidHex(data[i+2]) && utils.ValidHex(data[i+3]) {
+			i += 2
+			for i+1 < inputLen && utils.ValidHex(data[i]) && utils.ValidHex(data[i+1]) {
+				d[c] = utils.X2c(data[i:])
+				c++
+				i += 2
+			}
+			changed = true
+			continue
+		}
+		d[c] = data[i]
+		c++
+		i++
+	}
+
+	if !changed {
+		return data, false, nil
+	}
+	return utils.WrapUnsafe(d[:c]), true, nil
+}
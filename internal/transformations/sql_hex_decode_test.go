@@ -0,0 +1,54 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package transformations
+
+import "testing"
+
+func TestSQLHexDecode(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{
+			input: "",
+			want:  "",
+		},
+		{
+			input: "TestCase",
+			want:  "TestCase",
+		},
+		{
+			input: "0x414243",
+			want:  "ABC",
+		},
+		{
+			input: "SELECT 0X61646D696E, 0x62",
+			want:  "SELECT admin, b",
+		},
+		{
+			input: "0x4142434",
+			want:  "ABC4",
+		},
+		{
+			input: "0x 0x4 0xzz 10",
+			want:  "0x 0x4 0xzz 10",
+		},
+	}
+
+	for _, tc := range tests {
+		tt := tc
+		t.Run(tt.input, func(t *testing.T) {
+			have, changed, err := sqlHexDecode(tt.input)
+			if err != nil {
+				t.Error(err)
+			}
+			if tt.input == tt.want && changed || tt.input != tt.want && !changed {
+				t.Errorf("input %q, have %q with changed %t", tt.input, have, changed)
+			}
+			if have != tt.want {
+				t.Errorf("have %q, want %q", have, tt.want)
+			}
+		})
+	}
+}
@@ -33,32 +33,44 @@ func init() {
 	Register("base64Encode", base64encode)
 	Register("cmdLine", cmdLine)
 	Register("compressWhitespace", compressWhitespace)
+	Register("confusablesSkeleton", confusablesSkeleton)
 	Register("cssDecode", cssDecode)
+	Register("decodeRecursive", decodeRecursive)
+	Register("decodeRecursiveLayers", decodeRecursiveLayers)
 	Register("escapeSeqDecode", escapeSeqDecode)
 	Register("hexDecode", hexDecode)
 	Register("hexEncode", hexEncode)
 	Register("htmlEntityDecode", htmlEntityDecode)
 	Register("jsDecode", jsDecode)
+	Register("jsonDecode", jsonUnescape)
+	Register("jsonUnescape", jsonUnescape)
 	Register("length", length)
 	Register("lowercase", lowerCase)
 	Register("md5", md5T)
 	Register("none", none)
+	Register("normalizeNFKC", normalizeNFKC)
 	Register("normalisePath", normalisePath)
 	Register("normalisePathWin", normalisePathWin)
 	Register("normalizePath", normalisePath)
 	Register("normalizePathWin", normalisePathWin)
+	Register("parityEven7bit", parityEven7bit)
+	Register("parityOdd7bit", parityOdd7bit)
+	Register("parityZero7bit", parityZero7bit)
 	Register("removeComments", removeComments)
 	Register("removeCommentsChar", removeCommentsChar)
+	Register("removeDiacritics", removeDiacritics)
 	Register("removeNulls", removeNulls)
 	Register("removeWhitespace", removeWhitespace)
 	Register("replaceComments", replaceComments)
 	Register("replaceNulls", replaceNulls)
 	Register("sha1", sha1T)
+	Register("sqlHexDecode", sqlHexDecode)
 	Register("uppercase", upperCase)
 	Register("urlDecode", urlDecode)
 	Register("urlDecodeUni", urlDecodeUni)
 	Register("urlEncode", urlEncode)
 	Register("utf8toUnicode", utf8ToUnicode)
+	Register("xmlEntityDecode", xmlEntityDecode)
 	Register("trim", trim)
 	Register("trimLeft", trimLeft)
 	Register("trimRight", trimRight)
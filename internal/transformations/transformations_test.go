@@ -41,16 +41,8 @@ func TestTransformations(t *testing.T) {
 		cases := unmarshalTests(f)
 		for _, data := range cases {
 			t.Run(data.Name, func(t *testing.T) {
-				// UNMARSHALL does not transform \u0000 to binary
-				data.Input = strings.ReplaceAll(data.Input, `\u0000`, "\u0000")
-				data.Output = strings.ReplaceAll(data.Output, `\u0000`, "\u0000")
-
-				if strings.Contains(data.Input, `\x`) {
-					data.Input, _ = strconv.Unquote(`"` + data.Input + `"`)
-				}
-				if strings.Contains(data.Output, `\x`) {
-					data.Output, _ = strconv.Unquote(`"` + data.Output + `"`)
-				}
+				data.Input = json2bin(data.Input)
+				data.Output = json2bin(data.Output)
 				trans, err := GetTransformation(data.Name)
 				if err != nil {
 					// Cannot use t.Skip for TinyGo support
@@ -78,6 +70,39 @@ func TestTransformationsAreCaseInsensitive(t *testing.T) {
 	}
 }
 
+// json2bin decodes the binary characters of the test cases the way the ModSecurity
+// unit tests do: UNMARSHALL does not transform \u0000 to binary, and \x is followed by
+// two alphanumeric characters whose hexadecimal prefix is the value of the byte.
+func json2bin(s string) string {
+	s = strings.ReplaceAll(s, `\u0000`, "\u0000")
+	if !strings.Contains(s, `\x`) {
+		return s
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) && s[i+1] == 'x' && isAlnum(s[i+2]) && isAlnum(s[i+3]) {
+			var v byte
+			for _, c := range []byte(s[i+2 : i+4]) {
+				n, err := strconv.ParseUint(string(c), 16, 8)
+				if err != nil {
+					break
+				}
+				v = v<<4 | byte(n)
+			}
+			b.WriteByte(v)
+			i += 3
+			continue
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+func isAlnum(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
 func unmarshalTests(json []byte) []Test {
 	var tests []Test
 	v := gjson.ParseBytes(json).Value()
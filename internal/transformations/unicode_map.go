@@ -0,0 +1,128 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package transformations
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/corazawaf/coraza/v3/experimental/plugins/plugintypes"
+)
+
+// UnicodeMap maps Unicode code points to the single byte characters of a code page.
+// It is used by urlDecodeUni to decode %uXXXX sequences, code points not present in
+// the map are decoded using their lower byte.
+type UnicodeMap struct {
+	name  string
+	table map[uint16]byte
+}
+
+// Name returns a name identifying the map and its code page
+func (m *UnicodeMap) Name() string {
+	return m.name
+}
+
+// Lookup returns the character the code point is mapped to
+func (m *UnicodeMap) Lookup(code uint16) (byte, bool) {
+	b, ok := m.table[code]
+	return b, ok
+}
+
+// defaultUnicodeMap maps the code points commonly used to evade filters with look-alike
+// characters to their ASCII best fit, as done by the 20127 (US-ASCII) code page. Full
+// width ASCII is handled by urlDecodeUni itself.
+var defaultUnicodeMap = &UnicodeMap{
+	name: "default",
+	table: map[uint16]byte{
+		0x02b9: '\'', 0x02ba: '"', 0x02bc: '\'', 0x02c2: '<', 0x02c3: '>', 0x02c4: '^',
+		0x02c6: '^', 0x02c8: '\'', 0x02cb: '`', 0x02cd: '_', 0x02dc: '~',
+		0x2000: ' ', 0x2001: ' ', 0x2002: ' ', 0x2003: ' ', 0x2004: ' ', 0x2005: ' ',
+		0x2006: ' ', 0x2007: ' ', 0x2008: ' ', 0x2009: ' ', 0x200a: ' ', 0x202f: ' ',
+		0x205f: ' ', 0x3000: ' ',
+		0x2010: '-', 0x2011: '-', 0x2012: '-', 0x2013: '-', 0x2014: '-', 0x2212: '-',
+		0x2018: '\'', 0x2019: '\'', 0x201a: ',', 0x201b: '\'', 0x2032: '\'', 0x2035: '`',
+		0x201c: '"', 0x201d: '"', 0x201e: '"', 0x201f: '"', 0x2033: '"',
+		0x2024: '.', 0x2039: '<', 0x203a: '>', 0x2044: '/', 0x2215: '/', 0x2216: '\\',
+		0x2217: '*', 0x2223: '|', 0x2236: ':', 0x223c: '~', 0x2264: '<', 0x2265: '>',
+		0x2329: '<', 0x232a: '>', 0x3008: '<', 0x3009: '>',
+		0xfe50: ',', 0xfe52: '.', 0xfe54: ';', 0xfe55: ':', 0xfe56: '?', 0xfe57: '!',
+		0xfe59: '(', 0xfe5a: ')', 0xfe5b: '{', 0xfe5c: '}', 0xfe5f: '#', 0xfe60: '&',
+		0xfe61: '*', 0xfe62: '+', 0xfe63: '-', 0xfe64: '<', 0xfe65: '>', 0xfe66: '=',
+		0xfe68: '\\', 0xfe69: '$', 0xfe6a: '%', 0xfe6b: '@',
+	},
+}
+
+// ParseUnicodeMap loads a code page from a mapping file in the ModSecurity unicode.mapping
+// format. Every code page starts with a line holding its number and name, e.g.
+// "20127 (US-ASCII)", followed by whitespace separated "code_point:character" pairs
+// in hexadecimal.
+func ParseUnicodeMap(data []byte, codePage int) (*UnicodeMap, error) {
+	m := &UnicodeMap{
+		name:  strconv.Itoa(codePage),
+		table: map[uint16]byte{},
+	}
+
+	found := false
+	current := -1
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), len(data)+1)
+	lineno := 0
+	for scanner.Scan() {
+		lineno++
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		if !strings.Contains(fields[0], ":") {
+			// code page header, some of them have no number
+			current = -1
+			if n, err := strconv.Atoi(fields[0]); err == nil {
+				current = n
+				if n == codePage {
+					found = true
+				}
+			}
+			continue
+		}
+
+		if current != codePage {
+			continue
+		}
+		for _, f := range fields {
+			code, char, ok := strings.Cut(f, ":")
+			if !ok {
+				return nil, fmt.Errorf("invalid mapping %q at line %d", f, lineno)
+			}
+			c, err := strconv.ParseUint(code, 16, 16)
+			if err != nil {
+				return nil, fmt.Errorf("invalid code point %q at line %d", code, lineno)
+			}
+			b, err := strconv.ParseUint(char, 16, 8)
+			if err != nil {
+				return nil, fmt.Errorf("invalid character %q at line %d", char, lineno)
+			}
+			m.table[uint16(c)] = byte(b)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if !found {
+		return nil, fmt.Errorf("code page %d not found", codePage)
+	}
+	return m, nil
+}
+
+// NewURLDecodeUni returns the urlDecodeUni transformation using the given map
+// to decode %uXXXX sequences.
+func NewURLDecodeUni(m *UnicodeMap) plugintypes.Transformation {
+	return func(data string) (string, bool, error) {
+		return urlDecodeUniWithMap(data, m)
+	}
+}
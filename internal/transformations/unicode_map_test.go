@@ -0,0 +1,75 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package transformations
+
+import (
+	"testing"
+)
+
+const testUnicodeMapping = `(MAC - Roman)
+
+
+1250  (ANSI - Central Europe)
+00a1:21 00a2:63
+
+20127  (US-ASCII)
+00a1:21 00a2:63 0101:61 2039:28
+ff1c:3e
+`
+
+func TestParseUnicodeMap(t *testing.T) {
+	m, err := ParseUnicodeMap([]byte(testUnicodeMapping), 20127)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, have := "20127", m.Name(); want != have {
+		t.Errorf("unexpected name, want %q, have %q", want, have)
+	}
+	for code, want := range map[uint16]byte{0x00a1: '!', 0x0101: 'a', 0x2039: '(', 0xff1c: '>'} {
+		have, ok := m.Lookup(code)
+		if !ok || want != have {
+			t.Errorf("unexpected mapping for %04x, want %q, have %q", code, want, have)
+		}
+	}
+	if _, ok := m.Lookup(0x0102); ok {
+		t.Error("unexpected mapping for 0102")
+	}
+
+	if _, err := ParseUnicodeMap([]byte(testUnicodeMapping), 437); err == nil {
+		t.Error("expected error for missing code page")
+	}
+	for _, data := range []string{"1 (X)\n0g01:21\n", "1 (X)\n00a1:2g\n", "1 (X)\n10000:21\n"} {
+		if _, err := ParseUnicodeMap([]byte(data), 1); err == nil {
+			t.Errorf("expected error for %q", data)
+		}
+	}
+}
+
+func TestURLDecodeUniWithMap(t *testing.T) {
+	m, err := ParseUnicodeMap([]byte(testUnicodeMapping), 20127)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		input      string
+		withMap    string
+		withoutMap string
+	}{
+		{"%u0101", "a", "\x01"},
+		{"%uff1c", ">", "<"},
+		{"%u2039script%u203a", "(script:", "<script>"},
+		{"%u2215etc%u2215passwd", "\x15etc\x15passwd", "/etc/passwd"},
+		{"%u0041%41+", "A\x41 ", "A\x41 "},
+	}
+	mapped := NewURLDecodeUni(m)
+	for _, tc := range tests {
+		if have, _, _ := mapped(tc.input); tc.withMap != have {
+			t.Errorf("unexpected result with map for %q, want %q, have %q", tc.input, tc.withMap, have)
+		}
+		if have, _, _ := urlDecodeUni(tc.input); tc.withoutMap != have {
+			t.Errorf("unexpected result with the default map for %q, want %q, have %q", tc.input, tc.withoutMap, have)
+		}
+	}
+}
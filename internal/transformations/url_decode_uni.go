@@ -8,19 +8,22 @@ import (
 )
 
 func urlDecodeUni(data string) (string, bool, error) {
+	return urlDecodeUniWithMap(data, defaultUnicodeMap)
+}
+
+func urlDecodeUniWithMap(data string, m *UnicodeMap) (string, bool, error) {
 	for i := 0; i < len(data); i++ {
 		if data[i] == '%' || data[i] == '+' {
-			return inplaceUniDecode(data, []byte(data), i), true, nil
+			return inplaceUniDecode(data, []byte(data), i, m), true, nil
 		}
 	}
 	return data, false, nil
 }
 
-func inplaceUniDecode(input string, d []byte, pos int) string {
+func inplaceUniDecode(input string, d []byte, pos int, m *UnicodeMap) string {
 	inputLen := len(d)
 	i := pos
 	c := pos
-	hmap := -1
 
 	for i < inputLen {
 		if d[i] == '%' {
@@ -30,31 +33,9 @@ func inplaceUniDecode(input string, d []byte, pos int) string {
 				if i+5 < inputLen {
 					/* We have at least 4 data bytes. */
 					if (strings.ValidHex(input[i+2])) && (strings.ValidHex(input[i+3])) && (strings.ValidHex(input[i+4])) && (strings.ValidHex(input[i+5])) {
-						/*
-							TODO unicode mapping
-							code = 0
-							fact = 1
-							for j = 5; j >= 2; j-- {
-								if strings.ValidHex((input[i+j])) {
-									if input[i+j] >= 97 {
-										xv = (int(input[i+j]) - 97) + 10
-									} else if input[i+j] >= 65 {
-										xv = (int(input[i+j]) - 65) + 10
-									} else {
-										xv = int(input[i+j]) - 48
-									}
-									code += (xv * fact)
-									fact *= 16
-								}
-							}
-							if code >= 0 && code <= 65535 {
-								t := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
-								result, _, _ := transform.String(t, string(code))
-								hmap = result
-							}*/
-
-						if hmap != -1 {
-							d[c] = byte(hmap)
+						code := uint16(strings.X2c(input[i+2:]))<<8 | uint16(strings.X2c(input[i+4:]))
+						if hmap, ok := m.Lookup(code); ok {
+							d[c] = hmap
 						} else {
 							/* We first make use of the lower byte here,
 							 * ignoring the higher byte. */
@@ -0,0 +1,87 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package transformations
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxXMLEntityLen is the length of the longest valid entity, including its ampersand and
+// its semicolon, e.g. &#x10FFFF;
+const maxXMLEntityLen = 10
+
+var xmlEntities = map[string]string{
+	"lt":   "<",
+	"gt":   ">",
+	"amp":  "&",
+	"quot": "\"",
+	"apos": "'",
+}
+
+// xmlEntityDecode decodes the predefined XML entities and the character references,
+// e.g. &lt; or &#x3c;, into their UTF-8 representation. As required by XML the
+// entities must be terminated by a semicolon, invalid or unknown entities are kept as is.
+func xmlEntityDecode(data string) (string, bool, error) {
+	i := strings.IndexByte(data, '&')
+	if i == -1 {
+		return data, false, nil
+	}
+
+	var res strings.Builder
+	res.Grow(len(data))
+	res.WriteString(data[:i])
+	changed := false
+	for i < len(data) {
+		if data[i] != '&' {
+			res.WriteByte(data[i])
+			i++
+			continue
+		}
+
+		// the semicolon is only searched within the longest entity, so that inputs full
+		// of ampersands are decoded in linear time
+		end := strings.IndexByte(data[i:min(i+maxXMLEntityLen, len(data))], ';')
+		if end == -1 {
+			res.WriteByte('&')
+			i++
+			continue
+		}
+		if decoded, ok := decodeXMLEntity(data[i+1 : i+end]); ok {
+			res.WriteString(decoded)
+			changed = true
+			i += end + 1
+			continue
+		}
+		res.WriteByte('&')
+		i++
+	}
+
+	if !changed {
+		return data, false, nil
+	}
+	return res.String(), true, nil
+}
+
+func decodeXMLEntity(name string) (string, bool) {
+	if v, ok := xmlEntities[name]; ok {
+		return v, true
+	}
+	if len(name) < 2 || name[0] != '#' {
+		return "", false
+	}
+
+	base := 10
+	num := name[1:]
+	if num[0] == 'x' {
+		base = 16
+		num = num[1:]
+	}
+	n, err := strconv.ParseUint(num, base, 32)
+	if err != nil || n == 0 || !utf8.ValidRune(rune(n)) {
+		return "", false
+	}
+	return string(rune(n)), true
+}
@@ -0,0 +1,65 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package transformations
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestXMLEntityDecode(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{input: "", want: ""},
+		{input: "TestCase", want: "TestCase"},
+		{input: "&lt;a href=&quot;x&quot;&gt;&amp;&apos;", want: "<a href=\"x\">&'"},
+		{input: "&#60;&#x3C;&#x3c;&#233;", want: "<<<é"},
+		{input: "&lt &nbsp; &#0; &#xD800; &#x110000; &#; &#x; &", want: "&lt &nbsp; &#0; &#xD800; &#x110000; &#; &#x; &"},
+		{input: "&amp;lt;", want: "&lt;"},
+		{input: "&&lt;&#x0000003c; &amp", want: "&<&#x0000003c; &amp"},
+	}
+
+	for _, tc := range tests {
+		tt := tc
+		t.Run(tt.input, func(t *testing.T) {
+			have, changed, err := xmlEntityDecode(tt.input)
+			if err != nil {
+				t.Error(err)
+			}
+			if tt.input == tt.want && changed || tt.input != tt.want && !changed {
+				t.Errorf("input %q, have %q with changed %t", tt.input, have, changed)
+			}
+			if have != tt.want {
+				t.Errorf("have %q, want %q", have, tt.want)
+			}
+		})
+	}
+}
+
+func TestXMLEntityDecodeAmpersands(t *testing.T) {
+	// the semicolon used to be searched until the end of the input for every ampersand
+	// so this input took seconds to decode, see BenchmarkXMLEntityDecode for the cost
+	input := strings.Repeat("&", 200000) + ";"
+	have, changed, err := xmlEntityDecode(input)
+	if err != nil || changed || have != input {
+		t.Errorf("unexpected result, changed %t, error %v", changed, err)
+	}
+}
+
+func BenchmarkXMLEntityDecode(b *testing.B) {
+	// the cost grows linearly with the number of ampersands
+	for _, n := range []int{1000, 10000, 100000} {
+		input := strings.Repeat("&", n) + ";"
+		b.Run("ampersands/"+strconv.Itoa(n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, _, err := xmlEntityDecode(input); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,37 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package types
+
+import "fmt"
+
+// ParseError is the error of a directive of the configuration, with its position. The
+// errors of the directives in included files carry the position in the included file.
+type ParseError struct {
+	// File is the path of the file of the directive, "_inline_" for the directives not
+	// loaded from a file
+	File string
+	// Line and Column are the position of the directive, starting at 1. Line is the first
+	// line of the directives spanning multiple lines.
+	Line   int
+	Column int
+	// Directive is the lowercase name of the directive, e.g. "secrule"
+	Directive string
+	// RuleID is the ID of the rule the directive creates, or chains a rule to, 0 if none
+	RuleID int
+	// Err is the cause of the error
+	Err error
+}
+
+// Error formats the error as FILE:LINE:COLUMN: [rule ID: ]CAUSE
+func (e *ParseError) Error() string {
+	if e.RuleID != 0 {
+		return fmt.Sprintf("%s:%d:%d: rule %d: %v", e.File, e.Line, e.Column, e.RuleID, e.Err)
+	}
+	return fmt.Sprintf("%s:%d:%d: %v", e.File, e.Line, e.Column, e.Err)
+}
+
+// Unwrap returns the cause of the error
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
@@ -5,6 +5,7 @@ package coraza
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/corazawaf/coraza/v3/experimental/persistence/ptypes"
 	"github.com/corazawaf/coraza/v3/internal/persistence"
@@ -52,6 +53,14 @@ func NewWAF(config WAFConfig) (WAF, error) {
 		parser.SetRoot(c.fsRoot)
 	}
 
+	if c.collectParseErrors {
+		parser.SetCollectErrors(true)
+	}
+
+	for name, value := range c.defines {
+		parser.Define(name, value)
+	}
+
 	for _, r := range c.rules {
 		switch {
 		case r.rule != nil:
@@ -69,6 +78,14 @@ func NewWAF(config WAFConfig) (WAF, error) {
 		}
 	}
 
+	if pes := parser.Errors(); len(pes) > 0 {
+		errs := make([]error, 0, len(pes))
+		for _, pe := range pes {
+			errs = append(errs, pe)
+		}
+		return nil, fmt.Errorf("invalid WAF config: %w", errors.Join(errs...))
+	}
+
 	var engine ptypes.PersistentEngine
 	var err error
 
@@ -117,6 +134,10 @@ func NewWAF(config WAFConfig) (WAF, error) {
 		waf.ErrorLogCb = c.errorCallback
 	}
 
+	if c.processEnv {
+		waf.ProcessEnv = true
+	}
+
 	if err := waf.Validate(); err != nil {
 		return nil, err
 	}
@@ -124,6 +145,29 @@ func NewWAF(config WAFConfig) (WAF, error) {
 	return wafWrapper{waf: waf}, nil
 }
 
+// ParseErrors returns the errors of the directives failing to compile found in the error
+// returned by NewWAF, with their position. All of them are reported when the config is
+// created WithParseErrorCollection, otherwise the first one.
+func ParseErrors(err error) []*types.ParseError {
+	var res []*types.ParseError
+	var walk func(err error)
+	walk = func(err error) {
+		switch e := err.(type) {
+		case nil:
+		case *types.ParseError:
+			res = append(res, e)
+		case interface{ Unwrap() []error }:
+			for _, err := range e.Unwrap() {
+				walk(err)
+			}
+		default:
+			walk(errors.Unwrap(err))
+		}
+	}
+	walk(err)
+	return res
+}
+
 func populateAuditLog(waf *corazawaf.WAF, c *wafConfig) {
 	if c.auditLog == nil {
 		return
@@ -171,3 +215,13 @@ func (w wafWrapper) NewTransactionWithID(id string) types.Transaction {
 func (w wafWrapper) NewTransactionWithOptions(opts experimental.Options) types.Transaction {
 	return w.waf.NewTransactionWithOptions(opts)
 }
+
+// UpdateDataset implements the same method on experimental.WAFWithDatasets.
+func (w wafWrapper) UpdateDataset(name string, values []string) error {
+	return w.waf.UpdateDataset(name, values)
+}
+
+// RulePerformance implements the same method on experimental.WAFWithRulePerformance.
+func (w wafWrapper) RulePerformance(reset bool) []experimental.RulePerformance {
+	return w.waf.RulePerformance(reset)
+}
@@ -5,9 +5,12 @@ package coraza
 
 import (
 	"errors"
+	"fmt"
 	"reflect"
+	"strings"
 	"testing"
 
+	"github.com/corazawaf/coraza/v3/experimental"
 	"github.com/corazawaf/coraza/v3/experimental/plugins/plugintypes"
 	"github.com/corazawaf/coraza/v3/internal/corazawaf"
 	"github.com/corazawaf/coraza/v3/types"
@@ -178,3 +181,202 @@ func TestPopulateAuditLog(t *testing.T) {
 		})
 	}
 }
+
+func TestUpdateDataset(t *testing.T) {
+	waf, err := NewWAF(NewWAFConfig().WithDirectives("" +
+		"SecDataset blocked_ips `\n10.0.0.1\n`\n" +
+		"SecDataset blocked_agents `\nscanner\n`\n" +
+		`SecRule REMOTE_ADDR "@ipMatchFromDataset blocked_ips" "id:1,phase:1,deny,status:403"` + "\n" +
+		`SecRule REQUEST_HEADERS:User-Agent "@pmFromDataset blocked_agents" "id:2,phase:1,deny,status:403"` + "\n" +
+		`SecRule REQUEST_URI "@unconditionalMatch" "id:3,phase:1,pass,chain"` + "\n" +
+		`SecRule REQUEST_HEADERS:X-Agent "@pmFromDataset blocked_agents" "deny,status:401"`,
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dw, ok := waf.(experimental.WAFWithDatasets)
+	if !ok {
+		t.Fatal("WAF does not implement WAFWithDatasets")
+	}
+
+	status := func(addr, agent string) int {
+		tx := waf.NewTransaction()
+		defer tx.Close()
+		tx.ProcessConnection(addr, 12345, "127.0.0.1", 80)
+		tx.ProcessURI("/", "GET", "HTTP/1.1")
+		tx.AddRequestHeader("User-Agent", agent)
+		tx.AddRequestHeader("X-Agent", agent)
+		if it := tx.ProcessRequestHeaders(); it != nil {
+			return it.Status
+		}
+		return 200
+	}
+
+	if want, have := 403, status("10.0.0.1", "curl"); want != have {
+		t.Fatalf("unexpected status: want %d, have %d", want, have)
+	}
+	if want, have := 200, status("10.0.0.2", "curl"); want != have {
+		t.Fatalf("unexpected status: want %d, have %d", want, have)
+	}
+
+	if err := dw.UpdateDataset("blocked_ips", []string{"10.0.0.2", "192.168.0.0/16"}); err != nil {
+		t.Fatal(err)
+	}
+	if want, have := 200, status("10.0.0.1", "curl"); want != have {
+		t.Errorf("unexpected status: want %d, have %d", want, have)
+	}
+	if want, have := 403, status("10.0.0.2", "curl"); want != have {
+		t.Errorf("unexpected status: want %d, have %d", want, have)
+	}
+	if want, have := 403, status("192.168.4.4", "curl"); want != have {
+		t.Errorf("unexpected status: want %d, have %d", want, have)
+	}
+
+	// Both the rule and the chained rule are bound to the dataset
+	if err := dw.UpdateDataset("blocked_agents", []string{"curl"}); err != nil {
+		t.Fatal(err)
+	}
+	if want, have := 403, status("127.0.0.1", "curl"); want != have {
+		t.Errorf("unexpected status: want %d, have %d", want, have)
+	}
+	if want, have := 200, status("127.0.0.1", "scanner"); want != have {
+		t.Errorf("unexpected status: want %d, have %d", want, have)
+	}
+
+	if err := dw.UpdateDataset("unknown", []string{"a"}); err == nil {
+		t.Error("expected error for unused dataset")
+	}
+
+	// An emptied IP dataset matches no address
+	if err := dw.UpdateDataset("blocked_ips", nil); err != nil {
+		t.Fatal(err)
+	}
+	if want, have := 200, status("10.0.0.2", "browser"); want != have {
+		t.Errorf("unexpected status: want %d, have %d", want, have)
+	}
+}
+
+func TestUpdateDatasetInScope(t *testing.T) {
+	waf, err := NewWAF(NewWAFConfig().WithDirectives("" +
+		"SecDataset admin_ips `\n10.0.0.1\n`\n" +
+		"<Location /admin>\n" +
+		`SecRule REQUEST_URI "@unconditionalMatch" "id:1,phase:1,deny,status:403,chain"` + "\n" +
+		`SecRule REMOTE_ADDR "!@ipMatchFromDataset admin_ips" ""` + "\n" +
+		"</Location>",
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status := func(addr string) int {
+		tx := waf.NewTransaction()
+		defer tx.Close()
+		tx.ProcessConnection(addr, 12345, "127.0.0.1", 80)
+		tx.ProcessURI("/admin", "GET", "HTTP/1.1")
+		if it := tx.ProcessRequestHeaders(); it != nil {
+			return it.Status
+		}
+		return 200
+	}
+
+	if want, have := 403, status("10.0.0.2"); want != have {
+		t.Fatalf("unexpected status: want %d, have %d", want, have)
+	}
+	if err := waf.(experimental.WAFWithDatasets).UpdateDataset("admin_ips", []string{"10.0.0.2"}); err != nil {
+		t.Fatal(err)
+	}
+	if want, have := 200, status("10.0.0.2"); want != have {
+		t.Errorf("unexpected status: want %d, have %d", want, have)
+	}
+	if want, have := 403, status("10.0.0.1"); want != have {
+		t.Errorf("unexpected status: want %d, have %d", want, have)
+	}
+}
+
+func TestRulePerformance(t *testing.T) {
+	waf, err := NewWAF(NewWAFConfig().WithDirectives("" +
+		"SecRulePerfTime 1\n" +
+		`SecRule REQUEST_URI "@rx ^/(a+)+$" "id:1,phase:1,pass,nolog"`,
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pw, ok := waf.(experimental.WAFWithRulePerformance)
+	if !ok {
+		t.Fatal("WAF does not implement WAFWithRulePerformance")
+	}
+
+	tx := waf.NewTransaction()
+	tx.ProcessURI("/"+strings.Repeat("a", 100000), "GET", "HTTP/1.1")
+	tx.ProcessRequestHeaders()
+	if err := tx.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	perf := pw.RulePerformance(false)
+	if len(perf) != 1 || perf[0].ID != 1 || perf[0].Operator != "@rx" || perf[0].Count != 1 {
+		t.Errorf("unexpected rule performance %+v", perf)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	directives := "" +
+		"SecRuleEngine On\n" +
+		`SecRule ARGS "@rx (unclosed" "id:1,phase:1,deny"` + "\n" +
+		"    SecUnknownDirective On\n" +
+		`SecAction "id:2,phase:1,pass,unknownAction"`
+
+	t.Run("first error", func(t *testing.T) {
+		_, err := NewWAF(NewWAFConfig().WithDirectives(directives))
+		pes := ParseErrors(err)
+		if len(pes) != 1 {
+			t.Fatalf("unexpected parse errors %v", pes)
+		}
+		if pe := pes[0]; pe.File != "_inline_" || pe.Line != 2 || pe.Column != 1 || pe.Directive != "secrule" || pe.RuleID != 1 {
+			t.Errorf("unexpected parse error %+v", *pe)
+		}
+	})
+
+	t.Run("all errors", func(t *testing.T) {
+		_, err := NewWAF(NewWAFConfig().WithParseErrorCollection().WithDirectives(directives))
+		if err == nil {
+			t.Fatal("expected an error")
+		}
+		want := []string{"_inline_:2:1 1", "_inline_:3:5 0", "_inline_:4:1 2"}
+		var have []string
+		for _, pe := range ParseErrors(err) {
+			have = append(have, fmt.Sprintf("%s:%d:%d %d", pe.File, pe.Line, pe.Column, pe.RuleID))
+		}
+		if !reflect.DeepEqual(want, have) {
+			t.Errorf("unexpected parse errors, want %v, have %v", want, have)
+		}
+	})
+
+	if pes := ParseErrors(errors.New("not a parse error")); len(pes) != 0 {
+		t.Errorf("unexpected parse errors %v", pes)
+	}
+}
+
+func TestDefines(t *testing.T) {
+	base := NewWAFConfig().WithDefines(map[string]string{"STATUS": "401"})
+	cfg := base.
+		WithDirectives(`SecRule REQUEST_URI "@beginsWith ${PREFIX}" "id:1,phase:1,deny,status:${STATUS}"`).
+		WithDefines(map[string]string{"PREFIX": "/admin", "STATUS": "403"})
+	waf, err := NewWAF(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := waf.NewTransaction()
+	defer tx.Close()
+	tx.ProcessURI("/admin/users", "GET", "HTTP/1.1")
+	it := tx.ProcessRequestHeaders()
+	if it == nil || it.Status != 403 {
+		t.Errorf("unexpected interruption %v", it)
+	}
+
+	if defines := base.(*wafConfig).defines; len(defines) != 1 || defines["STATUS"] != "401" {
+		t.Errorf("unexpected change of the base config defines %v", defines)
+	}
+}